@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"namer/internal/fakeapi"
+	"net/http"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// namer-fakeapi serves stand-ins of the agify, genderize and nationalize APIs for local
+// development, point AGIFY_URL, GENDERIZE_URL and NATIONALIZE_URL at the listen addresses.
+//
+//	namer-fakeapi -seed names.json -rate-limit 100 -error-rate 0.05
+func main() {
+	agifyAddr := flag.String("agify-addr", "localhost:8091", "listen address of the agify API")
+	genderizeAddr := flag.String("genderize-addr", "localhost:8092", "listen address of the genderize API")
+	nationalizeAddr := flag.String("nationalize-addr", "localhost:8093", "listen address of the nationalize API")
+	seedPath := flag.String("seed", "", "JSON file with the name statistics, the embedded sample by default")
+	apiKey := flag.String("api-key", "", "API key the requests have to send")
+	randSeed := flag.Int64("rand-seed", 1, "seed of the choice of the requests failed by -error-rate")
+
+	var faults fakeapi.Faults
+
+	flag.DurationVar(&faults.Latency, "latency", 0, "delay of every response")
+	flag.IntVar(&faults.FailNext, "fail-next", 0, "number of requests answered with a 503 first")
+	flag.IntVar(&faults.Status, "status", 0, "status every request is answered with")
+	flag.Float64Var(&faults.ErrorRate, "error-rate", 0, "share of the requests answered with a 500")
+	flag.IntVar(&faults.RateLimit, "rate-limit", 0, "names allowed per rate limit window, unlimited when 0")
+	flag.DurationVar(&faults.RateLimitWindow, "rate-limit-window", time.Hour*24, "rate limit window")
+
+	flag.Parse()
+
+	opts := []fakeapi.Option{fakeapi.WithAPIKey(*apiKey), fakeapi.WithRandSeed(*randSeed)}
+
+	if *seedPath != "" {
+		entries, err := fakeapi.LoadSeedFile(*seedPath)
+		if err != nil {
+			log.Fatal("invalid -seed: ", errors.Wrap(err, "main #1"))
+		}
+
+		opts = append(opts, fakeapi.WithSeed(entries))
+	}
+
+	addrs := map[string]string{
+		fakeapi.Agify:       *agifyAddr,
+		fakeapi.Genderize:   *genderizeAddr,
+		fakeapi.Nationalize: *nationalizeAddr,
+	}
+
+	for name := range addrs {
+		opts = append(opts, fakeapi.WithFaults(name, faults))
+	}
+
+	fake, err := fakeapi.New(opts...)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "main #2"))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var wg sync.WaitGroup
+
+	for name, addr := range addrs {
+		server := &http.Server{
+			Addr:              addr,
+			Handler:           fake.Handler(name),
+			ReadHeaderTimeout: time.Second * 15,
+		}
+
+		wg.Add(2)
+
+		go func(name string) {
+			defer wg.Done()
+
+			log.Infof("serving %s at %s", name, server.Addr)
+
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Error(errors.Wrap(err, "main #3"))
+				stop()
+			}
+		}(name)
+
+		go func() {
+			defer wg.Done()
+
+			<-ctx.Done()
+
+			timeout, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+
+			if err := server.Shutdown(timeout); err != nil {
+				log.Error(errors.Wrap(err, "main #4"))
+			}
+		}()
+	}
+
+	wg.Wait()
+}
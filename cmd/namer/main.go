@@ -1,7 +1,16 @@
 package main
 
-import "namer/internal/app"
+import (
+	"namer/internal/app"
+	"os"
+)
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "enrich" {
+		app.Enrich(os.Args[2:])
+
+		return
+	}
+
 	app.Start()
 }
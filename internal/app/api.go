@@ -0,0 +1,191 @@
+package app
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	personAPI "namer/internal/storage/repository/api/person"
+	"namer/internal/storage/usecase/person"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultEnrichmentTimeout   = time.Second * 15
+	defaultEnrichmentUserAgent = "namer"
+	defaultEnrichmentCacheSize = 1000
+	defaultEnrichmentProviders = personAPI.ProviderAgify + "," + personAPI.ProviderGenderize + "," + personAPI.ProviderNationalize
+	defaultEnrichmentCacheTTL  = time.Hour * 24
+
+	defaultEnrichmentMaxAttempts    = 3
+	defaultEnrichmentRetryBaseDelay = time.Millisecond * 200
+	defaultEnrichmentRetryMaxDelay  = time.Second * 5
+
+	defaultEnrichmentBreakerThreshold = 5
+	defaultEnrichmentBreakerCooldown  = time.Second * 30
+)
+
+// newAPIRepository configures the name providers client from the environment. The base URLs
+// can point at a local stand-in or a paid tier, ENRICHMENT_PROXY_URL overrides the proxy
+// taken from HTTPS_PROXY. ENRICHMENT_PROVIDERS lists the providers to ask, the first one
+// takes precedence, the dictionary answers from ENRICHMENT_DICTIONARY_PATH or the embedded
+// sample. Results are cached in memory and in store unless ENRICHMENT_CACHE_TTL is 0, the
+// second repository returned skips the cache for re-enrichment.
+func newAPIRepository(store personAPI.CacheStore) (person.APIRepository, person.APIRepository, error) {
+	timeout := defaultEnrichmentTimeout
+
+	if value := os.Getenv("ENRICHMENT_TIMEOUT"); value != "" {
+		var err error
+
+		if timeout, err = time.ParseDuration(value); err != nil {
+			return nil, nil, errors.Wrap(err, "newAPIRepository #1")
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if value := os.Getenv("ENRICHMENT_PROXY_URL"); value != "" {
+		proxyURL, err := url.Parse(value)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "newAPIRepository #2")
+		}
+
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	maxAttempts := defaultEnrichmentMaxAttempts
+
+	if value := os.Getenv("ENRICHMENT_MAX_ATTEMPTS"); value != "" {
+		var err error
+
+		if maxAttempts, err = strconv.Atoi(value); err != nil {
+			return nil, nil, errors.Wrap(err, "newAPIRepository #3")
+		}
+	}
+
+	retryBaseDelay, retryMaxDelay := defaultEnrichmentRetryBaseDelay, defaultEnrichmentRetryMaxDelay
+
+	if value := os.Getenv("ENRICHMENT_RETRY_BASE_DELAY"); value != "" {
+		var err error
+
+		if retryBaseDelay, err = time.ParseDuration(value); err != nil {
+			return nil, nil, errors.Wrap(err, "newAPIRepository #4")
+		}
+	}
+
+	if value := os.Getenv("ENRICHMENT_RETRY_MAX_DELAY"); value != "" {
+		var err error
+
+		if retryMaxDelay, err = time.ParseDuration(value); err != nil {
+			return nil, nil, errors.Wrap(err, "newAPIRepository #5")
+		}
+	}
+
+	breakerThreshold, breakerCooldown := defaultEnrichmentBreakerThreshold, defaultEnrichmentBreakerCooldown
+
+	if value := os.Getenv("ENRICHMENT_BREAKER_THRESHOLD"); value != "" {
+		var err error
+
+		if breakerThreshold, err = strconv.Atoi(value); err != nil {
+			return nil, nil, errors.Wrap(err, "newAPIRepository #6")
+		}
+	}
+
+	if value := os.Getenv("ENRICHMENT_BREAKER_COOLDOWN"); value != "" {
+		var err error
+
+		if breakerCooldown, err = time.ParseDuration(value); err != nil {
+			return nil, nil, errors.Wrap(err, "newAPIRepository #7")
+		}
+	}
+
+	userAgent := os.Getenv("ENRICHMENT_USER_AGENT")
+	if userAgent == "" {
+		userAgent = defaultEnrichmentUserAgent
+	}
+
+	apiRepository := personAPI.NewRepository(
+		personAPI.WithClient(&http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+		}),
+		personAPI.WithBaseURLs(
+			os.Getenv("AGIFY_URL"),
+			os.Getenv("GENDERIZE_URL"),
+			os.Getenv("NATIONALIZE_URL"),
+		),
+		personAPI.WithUserAgent(userAgent),
+		personAPI.WithAPIKey(os.Getenv("ENRICHMENT_API_KEY")),
+		personAPI.WithRetry(maxAttempts, retryBaseDelay, retryMaxDelay),
+		personAPI.WithCircuitBreaker(breakerThreshold, breakerCooldown),
+	)
+
+	dictionary, err := personAPI.LoadDictionary(os.Getenv("ENRICHMENT_DICTIONARY_PATH"))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "newAPIRepository #8")
+	}
+
+	registry, err := newRegistry(os.Getenv("ENRICHMENT_PROVIDERS"), timeout, append(apiRepository.Providers(), dictionary)...)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "newAPIRepository #9")
+	}
+
+	cacheSize, cacheTTL := defaultEnrichmentCacheSize, defaultEnrichmentCacheTTL
+
+	if value := os.Getenv("ENRICHMENT_CACHE_SIZE"); value != "" {
+		var err error
+
+		if cacheSize, err = strconv.Atoi(value); err != nil {
+			return nil, nil, errors.Wrap(err, "newAPIRepository #10")
+		}
+	}
+
+	if value := os.Getenv("ENRICHMENT_CACHE_TTL"); value != "" {
+		var err error
+
+		if cacheTTL, err = time.ParseDuration(value); err != nil {
+			return nil, nil, errors.Wrap(err, "newAPIRepository #11")
+		}
+	}
+
+	if cacheTTL <= 0 {
+		return registry, registry, nil
+	}
+
+	return personAPI.NewCachedRepository(registry, store, cacheSize, cacheTTL), registry, nil
+}
+
+// newRegistry registers the available providers named in the comma separated order, the
+// online ones when it is empty. The lookups of a call share the deadline of timeout.
+func newRegistry(order string, timeout time.Duration, available ...personAPI.EnrichmentProvider) (*personAPI.Registry, error) {
+	if order == "" {
+		order = defaultEnrichmentProviders
+	}
+
+	byName := make(map[string]personAPI.EnrichmentProvider, len(available))
+
+	for _, p := range available {
+		byName[p.Name()] = p
+	}
+
+	var providers []personAPI.EnrichmentProvider
+
+	for _, name := range strings.Split(order, ",") {
+		p, ok := byName[strings.TrimSpace(name)]
+		if !ok {
+			return nil, errors.Wrap(fmt.Errorf("unknown enrichment provider %q", strings.TrimSpace(name)), "newRegistry #1")
+		}
+
+		providers = append(providers, p)
+	}
+
+	registry, err := personAPI.NewRegistry(timeout, providers...)
+	if err != nil {
+		return nil, errors.Wrap(err, "newRegistry #2")
+	}
+
+	return registry, nil
+}
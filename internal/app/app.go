@@ -3,6 +3,7 @@ package app
 import (
 	"context"
 	"database/sql"
+	"expvar"
 	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -10,15 +11,30 @@ import (
 	log "github.com/sirupsen/logrus"
 	handler "namer/internal/delivery/http"
 	"namer/internal/delivery/http/middlewares"
+	"namer/internal/storage/repository/postgres/cache"
+	"namer/internal/storage/usecase/person"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
+)
+
+const (
+	defaultPurgeRetention = 30 * 24 * time.Hour
+	shutdownTimeout       = time.Second * 15
 )
 
 type app struct {
 	db     *sql.DB
 	server *http.Server
+	// internal serves the operator endpoints, nil unless INTERNAL_SERVER_PORT is set.
+	internal *http.Server
+	// cancel aborts the requests still running when the shutdown timeout runs out
+	// and stops the enrichment workers.
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
 }
 
 func Start() {
@@ -34,6 +50,16 @@ func Start() {
 		}
 	}()
 
+	if a.internal != nil {
+		go func() {
+			log.Info("starting internal server at ", a.internal.Addr)
+
+			if err := a.internal.ListenAndServe(); err != nil {
+				log.Error(errors.Wrap(err, "Start #2"))
+			}
+		}()
+	}
+
 	a.quit(ctx)
 }
 
@@ -51,23 +77,105 @@ func newApp(ctx context.Context) *app {
 		log.Fatalf("failed to connect to database: %v", errors.Wrap(err, "newApp #2"))
 	}
 
-	a.server = newServer(initRouter(a.db))
+	cacheRepository := cache.NewRepository(a.db)
+
+	apiRepository, reenrichRepository, err := newAPIRepository(cacheRepository)
+	if err != nil {
+		log.Fatal("invalid enrichment config: ", errors.Wrap(err, "newApp #3"))
+	}
+
+	cfg, err := newEnrichmentConfig()
+	if err != nil {
+		log.Fatal("invalid enrichment config: ", errors.Wrap(err, "newApp #4"))
+	}
+
+	usecase := person.NewUsecase(a.db, apiRepository, person.Config{
+		EnrichmentPolicy:   cfg.policy,
+		AsyncEnrichment:    cfg.async,
+		MaxJobAttempts:     cfg.maxJobAttempts,
+		NationHint:         cfg.nationHint,
+		ReenrichRepository: reenrichRepository,
+	})
+
+	var baseCtx context.Context
+
+	baseCtx, a.cancel = context.WithCancel(ctx)
+
+	handlerCfg := newHandlerConfig()
+
+	a.server = newServer(baseCtx, os.Getenv("SERVER_HOST"), os.Getenv("SERVER_PORT"), initRouter(handler.NewHandler(usecase, handlerCfg)))
+
+	// deleted persons, the purge and the metrics are kept off the public listener
+	if port := os.Getenv("INTERNAL_SERVER_PORT"); port != "" {
+		handlerCfg.AllowDeleted = true
+
+		a.internal = newServer(baseCtx, os.Getenv("INTERNAL_SERVER_HOST"), port, initInternalRouter(handler.NewHandler(usecase, handlerCfg)))
+	}
+
+	startWorkers(baseCtx, &a.workers, usecase, cfg)
+	startCacheSweeper(baseCtx, &a.workers, cacheRepository)
 
 	return &a
 }
 
-func initRouter(db *sql.DB) *echo.Echo {
-	e := echo.New()
+func newHandlerConfig() handler.Config {
+	purgeRetention := defaultPurgeRetention
+
+	if value := os.Getenv("PURGE_RETENTION"); value != "" {
+		var err error
+
+		if purgeRetention, err = time.ParseDuration(value); err != nil {
+			log.Fatal("invalid PURGE_RETENTION: ", errors.Wrap(err, "newHandlerConfig #1"))
+		}
+
+		if purgeRetention <= 0 {
+			log.Fatal("invalid PURGE_RETENTION: retention must be positive")
+		}
+	}
+
+	return handler.Config{
+		RequireIfMatch: os.Getenv("REQUIRE_IF_MATCH") == "true",
+		PurgeRetention: purgeRetention,
+	}
+}
 
-	h := handler.NewHandler(db)
+func initRouter(h *handler.Handler) *echo.Echo {
+	e := echo.New()
 
-	api := e.Group("/api/person", middleware.Logger(), middlewares.ErrLogger())
+	api := e.Group("/api/person", middleware.RequestID(), middleware.Logger(), middlewares.ErrLogger())
 
 	api.POST("", h.NewPerson)
+	api.POST("/bulk", h.NewPersons)
 	api.GET("/:id", h.GetPerson)
 	api.POST("/filter", h.GetPersons)
 	api.PUT("/:id", h.UpdatePerson)
+	api.PATCH("/:id", h.PatchPerson)
 	api.DELETE("/:id", h.DeletePerson)
+	api.POST("/:id/restore", h.RestorePerson)
+	api.GET("/:id/history", h.GetPersonHistory)
+	api.POST("/:id/enrich", h.ReenrichPerson)
+
+	return e
+}
+
+// initInternalRouter routes the operator endpoints, the listener is meant to be reachable
+// from the internal network only.
+func initInternalRouter(h *handler.Handler) *echo.Echo {
+	e := echo.New()
+
+	api := e.Group("/api/person", middleware.RequestID(), middleware.Logger(), middlewares.ErrLogger())
+
+	api.GET("/:id", h.GetPerson)
+	api.POST("/filter", h.GetPersons)
+	api.GET("/:id/history", h.GetPersonHistory)
+	api.POST("/purge", h.PurgePersons)
+
+	jobs := e.Group("/api/enrichment/jobs", middleware.RequestID(), middleware.Logger(), middlewares.ErrLogger())
+
+	jobs.GET("", h.GetEnrichmentJobs)
+	jobs.POST("/:id/retry", h.RetryEnrichmentJob)
+
+	e.GET("/debug/vars", echo.WrapHandler(expvar.Handler()))
 
 	return e
 }
@@ -85,12 +193,24 @@ func (a *app) quit(ctx context.Context) {
 }
 
 func (a *app) shutdown(ctx context.Context) {
-	if err := a.server.Shutdown(ctx); err != nil {
+	timeout, cancel := context.WithTimeout(ctx, shutdownTimeout)
+	defer cancel()
+
+	if err := a.server.Shutdown(timeout); err != nil {
 		log.Error(errors.Wrap(err, "shutdown #1"))
 	}
 
+	if a.internal != nil {
+		if err := a.internal.Shutdown(timeout); err != nil {
+			log.Error(errors.Wrap(err, "shutdown #2"))
+		}
+	}
+
+	a.cancel()
+	a.workers.Wait()
+
 	if err := a.db.Close(); err != nil {
-		log.Error(errors.Wrap(err, "shutdown #2"))
+		log.Error(errors.Wrap(err, "shutdown #3"))
 	}
 
 	log.Info("services closed")
@@ -0,0 +1,42 @@
+package app
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"namer/internal/storage/repository/postgres/cache"
+	"sync"
+	"time"
+)
+
+// cacheSweepInterval is how often the expired enrichment cache entries are deleted.
+const cacheSweepInterval = time.Hour
+
+// startCacheSweeper deletes the expired entries of the db cache every cacheSweepInterval until
+// ctx is canceled, Get only drops the expired entries it is asked about.
+func startCacheSweeper(ctx context.Context, wg *sync.WaitGroup, store *cache.CacheRepository) {
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(cacheSweepInterval):
+			}
+
+			deleted, err := store.DeleteExpired(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Warn("failed to sweep enrichment cache: ", errors.Wrap(err, "startCacheSweeper #1"))
+
+				continue
+			}
+
+			if deleted > 0 {
+				log.Info("swept expired enrichment cache entries: ", deleted)
+			}
+		}
+	}()
+}
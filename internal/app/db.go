@@ -10,11 +10,12 @@ import (
 	"time"
 )
 
+// connectToDB runs the sessions in UTC, the timestamp columns have no time zone.
 func connectToDB(ctx context.Context) (*sql.DB, error) {
 	db, err := sql.Open(
 		"postgres",
 		fmt.Sprintf(
-			"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+			"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable timezone=UTC",
 			os.Getenv("DB_HOST"),
 			os.Getenv("DB_PORT"),
 			os.Getenv("DB_USER"),
@@ -0,0 +1,119 @@
+package app
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"namer/internal/storage/usecase/person"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultEnrichmentWorkers      = 2
+	defaultEnrichmentPollInterval = time.Second * 5
+	// enrichmentJobBatch matches the number of names the providers take in one request.
+	enrichmentJobBatch = 10
+)
+
+type enrichmentConfig struct {
+	policy         string
+	async          bool
+	workers        int
+	pollInterval   time.Duration
+	maxJobAttempts int
+	nationHint     bool
+}
+
+// newEnrichmentConfig reads ENRICHMENT_POLICY, reject by default, ENRICHMENT_ASYNC,
+// ENRICHMENT_NATION_HINT and the settings of the workers running the enrichment jobs.
+func newEnrichmentConfig() (*enrichmentConfig, error) {
+	cfg := enrichmentConfig{
+		policy:         person.PolicyReject,
+		async:          os.Getenv("ENRICHMENT_ASYNC") == "true",
+		nationHint:     os.Getenv("ENRICHMENT_NATION_HINT") == "true",
+		workers:        defaultEnrichmentWorkers,
+		pollInterval:   defaultEnrichmentPollInterval,
+		maxJobAttempts: person.DefaultMaxJobAttempts,
+	}
+
+	if value := os.Getenv("ENRICHMENT_POLICY"); value != "" {
+		if value != person.PolicyReject && value != person.PolicyDefer {
+			return nil, errors.Wrap(errors.Errorf("unknown policy %q", value), "newEnrichmentConfig #1")
+		}
+
+		cfg.policy = value
+	}
+
+	if value := os.Getenv("ENRICHMENT_WORKERS"); value != "" {
+		var err error
+
+		if cfg.workers, err = strconv.Atoi(value); err != nil {
+			return nil, errors.Wrap(err, "newEnrichmentConfig #2")
+		}
+	}
+
+	// with async enrichment nobody else runs the jobs
+	if cfg.async && cfg.workers < 1 {
+		return nil, errors.Wrap(errors.New("async enrichment needs at least one worker"), "newEnrichmentConfig #3")
+	}
+
+	if value := os.Getenv("ENRICHMENT_POLL_INTERVAL"); value != "" {
+		var err error
+
+		if cfg.pollInterval, err = time.ParseDuration(value); err != nil {
+			return nil, errors.Wrap(err, "newEnrichmentConfig #4")
+		}
+
+		if cfg.pollInterval <= 0 {
+			return nil, errors.Wrap(errors.New("poll interval must be positive"), "newEnrichmentConfig #5")
+		}
+	}
+
+	if value := os.Getenv("ENRICHMENT_JOB_MAX_ATTEMPTS"); value != "" {
+		var err error
+
+		if cfg.maxJobAttempts, err = strconv.Atoi(value); err != nil {
+			return nil, errors.Wrap(err, "newEnrichmentConfig #6")
+		}
+	}
+
+	return &cfg, nil
+}
+
+// startWorkers runs the enrichment job workers until ctx is canceled, wg is done once all of
+// them have returned.
+func startWorkers(ctx context.Context, wg *sync.WaitGroup, usecase *person.Usecase, cfg *enrichmentConfig) {
+	for i := 0; i < cfg.workers; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			runWorker(ctx, usecase, cfg.pollInterval)
+		}()
+	}
+}
+
+// runWorker keeps claiming jobs while there are any and waits for pollInterval when the queue
+// is empty or the database fails.
+func runWorker(ctx context.Context, usecase *person.Usecase, pollInterval time.Duration) {
+	for {
+		claimed, err := usecase.ProcessJobs(ctx, enrichmentJobBatch)
+		if err != nil && ctx.Err() == nil {
+			log.Warn("failed to process enrichment jobs: ", errors.Wrap(err, "runWorker #1"))
+		}
+
+		if err == nil && claimed > 0 {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(pollInterval):
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/joho/godotenv"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"namer/internal/domain"
+	"namer/internal/storage/repository/postgres/cache"
+	"namer/internal/storage/usecase/person"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// reenrichActor is recorded in the history of persons changed by the enrich command.
+const reenrichActor = "enrich-command"
+
+// Enrich runs the enrich command: it looks up again the persons matching -where whose
+// enrichment is older than -older-than and prints what changes, -dry-run writes nothing.
+//
+//	namer enrich -where '{"operator":"and","filter":[{"field":"nation","value":"US"}]}' -older-than 30d -dry-run
+func Enrich(args []string) {
+	flags := flag.NewFlagSet("enrich", flag.ExitOnError)
+
+	where := flags.String("where", "", "filter group in the format of the where of a filter request")
+	olderThan := flags.String("older-than", "", "only persons enriched longer ago than this, such as 30d or 12h")
+	dryRun := flags.Bool("dry-run", false, "show what would change without writing it")
+
+	_ = flags.Parse(args)
+
+	var group *domain.FilterGroup
+
+	if *where != "" {
+		if err := json.Unmarshal([]byte(*where), &group); err != nil {
+			log.Fatal("invalid -where: ", errors.Wrap(err, "Enrich #1"))
+		}
+	}
+
+	age, err := parseAge(*olderThan)
+	if err != nil {
+		log.Fatal("invalid -older-than: ", errors.Wrap(err, "Enrich #2"))
+	}
+
+	if err = godotenv.Load(".env"); err != nil {
+		log.Fatal("failed to load env: ", errors.Wrap(err, "Enrich #3"))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	db, err := connectToDB(ctx)
+	if err != nil {
+		log.Fatalf("failed to connect to database: %v", errors.Wrap(err, "Enrich #4"))
+	}
+
+	defer db.Close()
+
+	apiRepository, reenrichRepository, err := newAPIRepository(cache.NewRepository(db))
+	if err != nil {
+		log.Fatal("invalid enrichment config: ", errors.Wrap(err, "Enrich #5"))
+	}
+
+	usecase := person.NewUsecase(db, apiRepository, person.Config{
+		NationHint:         os.Getenv("ENRICHMENT_NATION_HINT") == "true",
+		ReenrichRepository: reenrichRepository,
+	})
+
+	var changed, failed int
+
+	matched, err := usecase.ReenrichAll(ctx, group, age, *dryRun, domain.Audit{Actor: reenrichActor}, func(p *domain.Person, res *domain.Reenrichment, err error) {
+		switch {
+		case err != nil:
+			failed++
+
+			fmt.Printf("%d %s %s: %v\n", p.ID, p.Name, p.Surname, err)
+		case len(res.Changes) != 0:
+			changed++
+
+			fmt.Printf("%d %s %s\n", p.ID, p.Name, p.Surname)
+
+			fields := make([]string, 0, len(res.Changes))
+
+			for field := range res.Changes {
+				fields = append(fields, field)
+			}
+
+			slices.Sort(fields)
+
+			for _, field := range fields {
+				fmt.Printf("\t%s: %s -> %s\n", field, formatValue(res.Changes[field].Old), formatValue(res.Changes[field].New))
+			}
+		}
+	})
+
+	summary := fmt.Sprintf("%d matched, %d changed, %d failed", matched, changed, failed)
+	if *dryRun {
+		summary += ", dry run: nothing was written"
+	}
+
+	fmt.Println(summary)
+
+	if err != nil {
+		log.Error("enrich stopped: ", errors.Wrap(err, "Enrich #6"))
+
+		os.Exit(1)
+	}
+}
+
+// parseAge reads a duration like time.ParseDuration does and also takes whole days, such as 30d.
+// An empty value means no age limit.
+func parseAge(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	var (
+		age time.Duration
+		err error
+	)
+
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		var n int
+
+		n, err = strconv.Atoi(days)
+		age = time.Duration(n) * time.Hour * 24
+	} else {
+		age, err = time.ParseDuration(value)
+	}
+
+	if err != nil {
+		return 0, errors.Wrap(err, "parseAge #1")
+	}
+
+	if age <= 0 {
+		return 0, errors.Wrap(errors.New("age must be positive"), "parseAge #2")
+	}
+
+	return age, nil
+}
+
+func formatValue(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+
+	return string(b)
+}
@@ -1,23 +1,29 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"github.com/labstack/echo/v4"
+	"net"
 	"net/http"
-	"os"
 	"time"
 )
 
-func newServer(e *echo.Echo) *http.Server {
+// newServer creates the HTTP server, request contexts derive from ctx so that
+// canceling it aborts the requests in flight.
+func newServer(ctx context.Context, host, port string, e *echo.Echo) *http.Server {
 	s := &http.Server{
 		Addr: fmt.Sprintf(
 			"%s:%s",
-			os.Getenv("SERVER_HOST"),
-			os.Getenv("SERVER_PORT"),
+			host,
+			port,
 		),
 		Handler:      e,
 		ReadTimeout:  time.Second * 15,
 		WriteTimeout: time.Second * 15,
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
 	}
 
 	return s
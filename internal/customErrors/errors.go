@@ -4,6 +4,7 @@ import "github.com/pkg/errors"
 
 type Error struct {
 	Message    string
+	Details    any
 	Err        error
 	StatusCode int
 }
@@ -16,6 +17,15 @@ func New(message string, err error, code int) error {
 	}
 }
 
+func NewWithDetails(message string, details any, err error, code int) error {
+	return Error{
+		Message:    message,
+		Details:    details,
+		Err:        err,
+		StatusCode: code,
+	}
+}
+
 func Wrap(err error, message string) error {
 	ce, ok := err.(Error)
 	if !ok {
@@ -1,37 +1,87 @@
 package http
 
 import (
-	"database/sql"
+	"context"
+	"encoding/json"
 	"github.com/labstack/echo/v4"
 	"github.com/pkg/errors"
+	"mime"
 	"namer/internal/customErrors"
 	"namer/internal/domain"
-	"namer/internal/storage/usecase/person"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 )
 
 //go:generate mockery --name Usecase
 type Usecase interface {
-	NewPerson(req *domain.Person) (*domain.Response, error)
-	GetByID(id int) (*domain.Response, error)
-	GetWithFilterAndPagination(req *domain.FilterWithPagination) (*domain.Response, error)
-	Update(req *domain.Person) (*domain.Response, error)
-	Delete(id int) (*domain.Response, error)
+	NewPerson(ctx context.Context, req *domain.Person, audit domain.Audit) (*domain.Response, error)
+	NewPersons(ctx context.Context, reqs []domain.Person, audit domain.Audit) (*domain.Response, error)
+	GetByID(ctx context.Context, id int, includeDeleted bool) (*domain.Response, error)
+	GetWithFilterAndPagination(ctx context.Context, req *domain.FilterWithPagination) (*domain.Response, error)
+	GetHistory(ctx context.Context, id int, includeDeleted bool, req *domain.FilterWithPagination) (*domain.Response, error)
+	Update(ctx context.Context, req *domain.Person, version *int, audit domain.Audit) (*domain.Response, error)
+	Patch(ctx context.Context, req *domain.PersonPatch, version *int, audit domain.Audit) (*domain.Response, error)
+	JSONPatch(ctx context.Context, id int, ops []domain.PatchOperation, version *int, audit domain.Audit) (*domain.Response, error)
+	Delete(ctx context.Context, id int, version *int, audit domain.Audit) (*domain.Response, error)
+	Restore(ctx context.Context, id int, version *int, audit domain.Audit) (*domain.Response, error)
+	Purge(ctx context.Context, retention time.Duration, audit domain.Audit) (*domain.Response, error)
+	GetJobs(ctx context.Context, status string, limit int) (*domain.Response, error)
+	RequeueJob(ctx context.Context, id int64, audit domain.Audit) (*domain.Response, error)
+	Reenrich(ctx context.Context, id int, version *int, dryRun bool, audit domain.Audit) (*domain.Response, error)
 }
 
+const (
+	defaultHistoryLimit = 20
+	defaultJobsLimit    = 20
+)
+
+const (
+	mimeMergePatch = "application/merge-patch+json"
+	mimeJSONPatch  = "application/json-patch+json"
+
+	headerETag        = "ETag"
+	headerIfMatch     = "If-Match"
+	headerIfNoneMatch = "If-None-Match"
+	headerActor       = "X-Actor"
+)
+
 var (
-	invalidParameterErr   = "invalid uri parameter"
-	invalidRequestBodyErr = "invalid request body"
+	invalidParameterErr     = "invalid uri parameter"
+	invalidRequestBodyErr   = "invalid request body"
+	unsupportedMediaTypeErr = "unsupported media type"
+	invalidIfMatchErr       = "invalid If-Match header"
+	ifMatchRequiredErr      = "If-Match header is required"
+	ifMatchFailedErr        = "If-Match header does not match the person"
+	includeDeletedErr       = "deleted persons are only available on the internal listener"
 )
 
+type Config struct {
+	// RequireIfMatch rejects writes to an existing person unless the client sends
+	// the ETag it last saw.
+	RequireIfMatch bool
+	// PurgeRetention is how long deleted persons are kept before a purge removes them.
+	PurgeRetention time.Duration
+	// AllowDeleted lets include_deleted show deleted persons, only the handler of the
+	// internal listener sets it.
+	AllowDeleted bool
+}
+
 type Handler struct {
-	usecase Usecase
+	usecase        Usecase
+	requireIfMatch bool
+	purgeRetention time.Duration
+	allowDeleted   bool
 }
 
-func NewHandler(db *sql.DB) *Handler {
+func NewHandler(usecase Usecase, cfg Config) *Handler {
 	return &Handler{
-		usecase: person.NewUsecase(db),
+		usecase:        usecase,
+		requireIfMatch: cfg.RequireIfMatch,
+		purgeRetention: cfg.PurgeRetention,
+		allowDeleted:   cfg.AllowDeleted,
 	}
 }
 
@@ -46,7 +96,7 @@ func (h *Handler) NewPerson(c echo.Context) error {
 		)
 	}
 
-	res, err := h.usecase.NewPerson(&req)
+	res, err := h.usecase.NewPerson(c.Request().Context(), &req, audit(c))
 	if err != nil {
 		return customErrors.Wrap(err, "NewPerson #2")
 	}
@@ -54,6 +104,25 @@ func (h *Handler) NewPerson(c echo.Context) error {
 	return c.JSON(res.StatusCode, res)
 }
 
+func (h *Handler) NewPersons(c echo.Context) error {
+	var reqs []domain.Person
+
+	if err := c.Bind(&reqs); err != nil {
+		return customErrors.New(
+			invalidRequestBodyErr,
+			errors.Wrap(err, "NewPersons #1"),
+			http.StatusBadRequest,
+		)
+	}
+
+	res, err := h.usecase.NewPersons(c.Request().Context(), reqs, audit(c))
+	if err != nil {
+		return customErrors.Wrap(err, "NewPersons #2")
+	}
+
+	return c.JSON(res.StatusCode, res)
+}
+
 func (h *Handler) GetPerson(c echo.Context) error {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -64,9 +133,30 @@ func (h *Handler) GetPerson(c echo.Context) error {
 		)
 	}
 
-	res, err := h.usecase.GetByID(id)
+	includeDeleted, err := queryBool(c, "include_deleted")
+	if err != nil {
+		return customErrors.New(
+			invalidParameterErr,
+			errors.Wrap(err, "GetPerson #2"),
+			http.StatusBadRequest,
+		)
+	}
+
+	if includeDeleted && !h.allowDeleted {
+		return customErrors.New(
+			includeDeletedErr,
+			errors.Wrap(errors.New(includeDeletedErr), "GetPerson #3"),
+			http.StatusForbidden,
+		)
+	}
+
+	res, err := h.usecase.GetByID(c.Request().Context(), id, includeDeleted)
 	if err != nil {
-		return customErrors.Wrap(err, "GetPerson #2")
+		return customErrors.Wrap(err, "GetPerson #4")
+	}
+
+	if etag := setETag(c, res); etag != "" && matchETag(c.Request().Header.Get(headerIfNoneMatch), etag) {
+		return c.NoContent(http.StatusNotModified)
 	}
 
 	return c.JSON(res.StatusCode, res)
@@ -83,9 +173,64 @@ func (h *Handler) GetPersons(c echo.Context) error {
 		)
 	}
 
-	res, err := h.usecase.GetWithFilterAndPagination(&req)
+	if req.IncludeDeleted && !h.allowDeleted {
+		return customErrors.New(
+			includeDeletedErr,
+			errors.Wrap(errors.New(includeDeletedErr), "GetPersons #2"),
+			http.StatusForbidden,
+		)
+	}
+
+	res, err := h.usecase.GetWithFilterAndPagination(c.Request().Context(), &req)
+	if err != nil {
+		return customErrors.Wrap(err, "GetPersons #3")
+	}
+
+	resB, ok := res.Data.([]byte)
+	if !ok {
+		return c.JSON(res.StatusCode, res)
+	}
+
+	return c.JSONBlob(res.StatusCode, resB)
+}
+
+// GetPersonHistory lists the recorded changes of the person, of a deleted one only on the
+// internal listener. Pagination is read from the limit, page, mode, cursor and count query
+// parameters, as in the filter request body.
+func (h *Handler) GetPersonHistory(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return customErrors.New(
+			invalidParameterErr,
+			errors.Wrap(err, "GetPersonHistory #1"),
+			http.StatusBadRequest,
+		)
+	}
+
+	pagination := domain.Pagination{
+		Limit: defaultHistoryLimit,
+		Page:  1,
+	}
+
+	if err = echo.QueryParamsBinder(c).
+		Int("limit", &pagination.Limit).
+		Int("page", &pagination.Page).
+		String("mode", &pagination.Mode).
+		String("cursor", &pagination.Cursor).
+		String("count", &pagination.Count).
+		BindError(); err != nil {
+		return customErrors.New(
+			invalidParameterErr,
+			errors.Wrap(err, "GetPersonHistory #2"),
+			http.StatusBadRequest,
+		)
+	}
+
+	res, err := h.usecase.GetHistory(c.Request().Context(), id, h.allowDeleted, &domain.FilterWithPagination{
+		Pagination: &pagination,
+	})
 	if err != nil {
-		return customErrors.Wrap(err, "GetPersons #2")
+		return customErrors.Wrap(err, "GetPersonHistory #3")
 	}
 
 	resB, ok := res.Data.([]byte)
@@ -110,19 +255,94 @@ func (h *Handler) UpdatePerson(c echo.Context) error {
 		)
 	}
 
+	version, err := h.ifMatch(c, req.ID)
+	if err != nil {
+		return customErrors.Wrap(err, "UpdatePerson #2")
+	}
+
 	if err = c.Bind(&req); err != nil {
 		return customErrors.New(
 			invalidRequestBodyErr,
-			errors.Wrap(err, "UpdatePerson #2"),
+			errors.Wrap(err, "UpdatePerson #3"),
+			http.StatusBadRequest,
+		)
+	}
+
+	res, err := h.usecase.Update(c.Request().Context(), &req, version, audit(c))
+	if err != nil {
+		return customErrors.Wrap(err, "UpdatePerson #4")
+	}
+
+	setETag(c, res)
+
+	return c.JSON(res.StatusCode, res)
+}
+
+// PatchPerson accepts a JSON Merge Patch (RFC 7396) or, with the application/json-patch+json
+// content type, a JSON Patch (RFC 6902).
+func (h *Handler) PatchPerson(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return customErrors.New(
+			invalidParameterErr,
+			errors.Wrap(err, "PatchPerson #1"),
 			http.StatusBadRequest,
 		)
 	}
 
-	res, err := h.usecase.Update(&req)
+	version, err := h.ifMatch(c, id)
+	if err != nil {
+		return customErrors.Wrap(err, "PatchPerson #2")
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+
+	var res *domain.Response
+
+	switch mediaType {
+	case mimeMergePatch, echo.MIMEApplicationJSON:
+		req := domain.PersonPatch{
+			ID: id,
+		}
+
+		decoder := json.NewDecoder(c.Request().Body)
+		decoder.DisallowUnknownFields()
+
+		if err = decoder.Decode(&req); err != nil {
+			return customErrors.New(
+				invalidRequestBodyErr,
+				errors.Wrap(err, "PatchPerson #3"),
+				http.StatusBadRequest,
+			)
+		}
+
+		res, err = h.usecase.Patch(c.Request().Context(), &req, version, audit(c))
+	case mimeJSONPatch:
+		var ops []domain.PatchOperation
+
+		if err = json.NewDecoder(c.Request().Body).Decode(&ops); err != nil {
+			return customErrors.New(
+				invalidRequestBodyErr,
+				errors.Wrap(err, "PatchPerson #4"),
+				http.StatusBadRequest,
+			)
+		}
+
+		res, err = h.usecase.JSONPatch(c.Request().Context(), id, ops, version, audit(c))
+	default:
+		return customErrors.New(
+			unsupportedMediaTypeErr,
+			errors.Wrap(errors.New(unsupportedMediaTypeErr), "PatchPerson #5"),
+			http.StatusUnsupportedMediaType,
+		)
+	}
+
 	if err != nil {
-		return customErrors.Wrap(err, "UpdatePerson #3")
+		return customErrors.Wrap(err, "PatchPerson #6")
 	}
 
+	setETag(c, res)
+
 	return c.JSON(res.StatusCode, res)
 }
 
@@ -136,10 +356,269 @@ func (h *Handler) DeletePerson(c echo.Context) error {
 		)
 	}
 
-	res, err := h.usecase.Delete(id)
+	version, err := h.ifMatch(c, id)
 	if err != nil {
 		return customErrors.Wrap(err, "DeletePerson #2")
 	}
 
+	res, err := h.usecase.Delete(c.Request().Context(), id, version, audit(c))
+	if err != nil {
+		return customErrors.Wrap(err, "DeletePerson #3")
+	}
+
 	return c.JSON(res.StatusCode, res)
 }
+
+func (h *Handler) RestorePerson(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return customErrors.New(
+			invalidParameterErr,
+			errors.Wrap(err, "RestorePerson #1"),
+			http.StatusBadRequest,
+		)
+	}
+
+	version, err := h.ifMatch(c, id)
+	if err != nil {
+		return customErrors.Wrap(err, "RestorePerson #2")
+	}
+
+	res, err := h.usecase.Restore(c.Request().Context(), id, version, audit(c))
+	if err != nil {
+		return customErrors.Wrap(err, "RestorePerson #3")
+	}
+
+	setETag(c, res)
+
+	return c.JSON(res.StatusCode, res)
+}
+
+// ReenrichPerson looks the person up again and overwrites what the providers know about it.
+// With the dry_run query parameter nothing is written, the response shows what would change.
+func (h *Handler) ReenrichPerson(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return customErrors.New(
+			invalidParameterErr,
+			errors.Wrap(err, "ReenrichPerson #1"),
+			http.StatusBadRequest,
+		)
+	}
+
+	dryRun, err := queryBool(c, "dry_run")
+	if err != nil {
+		return customErrors.New(
+			invalidParameterErr,
+			errors.Wrap(err, "ReenrichPerson #2"),
+			http.StatusBadRequest,
+		)
+	}
+
+	version, err := h.ifMatch(c, id)
+	if err != nil {
+		return customErrors.Wrap(err, "ReenrichPerson #3")
+	}
+
+	res, err := h.usecase.Reenrich(c.Request().Context(), id, version, dryRun, audit(c))
+	if err != nil {
+		return customErrors.Wrap(err, "ReenrichPerson #4")
+	}
+
+	setETag(c, res)
+
+	return c.JSON(res.StatusCode, res)
+}
+
+// PurgePersons removes the persons deleted longer than the retention window ago for good,
+// it is only routed on the internal listener.
+func (h *Handler) PurgePersons(c echo.Context) error {
+	res, err := h.usecase.Purge(c.Request().Context(), h.purgeRetention, audit(c))
+	if err != nil {
+		return customErrors.Wrap(err, "PurgePersons #1")
+	}
+
+	return c.JSON(res.StatusCode, res)
+}
+
+// GetEnrichmentJobs lists the enrichment jobs with the status query parameter, by default
+// the dead letters.
+func (h *Handler) GetEnrichmentJobs(c echo.Context) error {
+	var status string
+
+	limit := defaultJobsLimit
+
+	if err := echo.QueryParamsBinder(c).
+		String("status", &status).
+		Int("limit", &limit).
+		BindError(); err != nil {
+		return customErrors.New(
+			invalidParameterErr,
+			errors.Wrap(err, "GetEnrichmentJobs #1"),
+			http.StatusBadRequest,
+		)
+	}
+
+	res, err := h.usecase.GetJobs(c.Request().Context(), status, limit)
+	if err != nil {
+		return customErrors.Wrap(err, "GetEnrichmentJobs #2")
+	}
+
+	return c.JSON(res.StatusCode, res)
+}
+
+func (h *Handler) RetryEnrichmentJob(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return customErrors.New(
+			invalidParameterErr,
+			errors.Wrap(err, "RetryEnrichmentJob #1"),
+			http.StatusBadRequest,
+		)
+	}
+
+	res, err := h.usecase.RequeueJob(c.Request().Context(), id, audit(c))
+	if err != nil {
+		return customErrors.Wrap(err, "RetryEnrichmentJob #2")
+	}
+
+	return c.JSON(res.StatusCode, res)
+}
+
+// audit tells who makes the request: the actor comes from the X-Actor header set by
+// the gateway in front of the service, the request id from the RequestID middleware.
+func audit(c echo.Context) domain.Audit {
+	return domain.Audit{
+		Actor:     c.Request().Header.Get(headerActor),
+		RequestID: c.Response().Header().Get(echo.HeaderXRequestID),
+	}
+}
+
+func queryBool(c echo.Context, name string) (bool, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return false, nil
+	}
+
+	return strconv.ParseBool(value)
+}
+
+// ifMatch returns the version required by the If-Match header, nil means any version. The
+// header is "*" or a list of ETags compared strongly, so a weak ETag never matches. Of a list,
+// the ETag of the current version is required, the write checks the version again.
+func (h *Handler) ifMatch(c echo.Context, id int) (*int, error) {
+	header := strings.TrimSpace(c.Request().Header.Get(headerIfMatch))
+
+	switch header {
+	case "":
+		if h.requireIfMatch {
+			return nil, customErrors.New(
+				ifMatchRequiredErr,
+				errors.Wrap(errors.New(ifMatchRequiredErr), "ifMatch #1"),
+				http.StatusPreconditionRequired,
+			)
+		}
+
+		return nil, nil
+	case "*":
+		return nil, nil
+	}
+
+	var versions []int
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		weak := strings.HasPrefix(tag, "W/")
+
+		version, ok := parseETag(strings.TrimPrefix(tag, "W/"))
+		if !ok {
+			return nil, customErrors.New(
+				invalidIfMatchErr,
+				errors.Wrap(errors.Errorf("invalid entity tag %q", tag), "ifMatch #2"),
+				http.StatusBadRequest,
+			)
+		}
+
+		if !weak {
+			versions = append(versions, version)
+		}
+	}
+
+	switch len(versions) {
+	case 0:
+		return nil, customErrors.New(
+			ifMatchFailedErr,
+			errors.Wrap(errors.New(ifMatchFailedErr), "ifMatch #3"),
+			http.StatusPreconditionFailed,
+		)
+	case 1:
+		return &versions[0], nil
+	}
+
+	res, err := h.usecase.GetByID(c.Request().Context(), id, true)
+	if err != nil {
+		return nil, customErrors.Wrap(err, "ifMatch #4")
+	}
+
+	if p, ok := res.Data.(*domain.Person); ok && slices.Contains(versions, p.Version) {
+		return &p.Version, nil
+	}
+
+	return nil, customErrors.New(
+		ifMatchFailedErr,
+		errors.Wrap(errors.New(ifMatchFailedErr), "ifMatch #5"),
+		http.StatusPreconditionFailed,
+	)
+}
+
+// parseETag returns the version of an ETag made by setETag, a quoted decimal number.
+func parseETag(tag string) (int, bool) {
+	if len(tag) < 3 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false
+	}
+
+	digits := tag[1 : len(tag)-1]
+
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return 0, false
+		}
+	}
+
+	version, err := strconv.Atoi(digits)
+
+	return version, err == nil
+}
+
+// setETag sets the ETag header when the response carries a person and returns its value.
+func setETag(c echo.Context, res *domain.Response) string {
+	var p *domain.Person
+
+	switch data := res.Data.(type) {
+	case *domain.Person:
+		p = data
+	case *domain.Reenrichment:
+		p = data.Person
+	default:
+		return ""
+	}
+
+	etag := strconv.Quote(strconv.Itoa(p.Version))
+
+	c.Response().Header().Set(headerETag, etag)
+
+	return etag
+}
+
+// matchETag reports whether an If-None-Match header matches etag, weak comparison applies.
+func matchETag(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -6,10 +6,12 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"namer/internal/customErrors"
 	"namer/internal/delivery/http/middlewares"
 	"namer/internal/delivery/http/mocks"
 	"namer/internal/domain"
+	"namer/pkg/utils"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -40,7 +42,7 @@ func TestNewPerson(t *testing.T) {
 
 		rec := httptest.NewRecorder()
 
-		mockUsecase.On("NewPerson", &person).Return(&res, nil).Once()
+		mockUsecase.On("NewPerson", mock.Anything, &person, domain.Audit{}).Return(&res, nil).Once()
 
 		b, err := json.Marshal(person)
 		assert.NoError(t, err)
@@ -112,7 +114,7 @@ func TestNewPerson(t *testing.T) {
 
 		badPerson := domain.Person{}
 
-		mockUsecase.On("NewPerson", &badPerson).Return(
+		mockUsecase.On("NewPerson", mock.Anything, &badPerson, domain.Audit{}).Return(
 			nil,
 			customErrors.New(
 				"empty name or surname",
@@ -141,18 +143,641 @@ func TestNewPerson(t *testing.T) {
 	})
 }
 
+func TestNewPersons(t *testing.T) {
+	persons := []domain.Person{
+		{Name: "Helen", Surname: "Johnson"},
+		{Name: "Anna", Surname: "Smith"},
+	}
+
+	t.Run("success", func(t *testing.T) {
+		mockUsecase := new(mocks.Usecase)
+
+		h := &Handler{
+			usecase: mockUsecase,
+		}
+
+		e := echo.New()
+
+		e.POST("/api/person/bulk", h.NewPersons)
+
+		rec := httptest.NewRecorder()
+
+		mockUsecase.On("NewPersons", mock.Anything, persons, domain.Audit{}).Return(&domain.Response{
+			Data:       persons,
+			StatusCode: http.StatusCreated,
+		}, nil).Once()
+
+		b, err := json.Marshal(persons)
+		assert.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/person/bulk", bytes.NewBuffer(b))
+		req.Header.Add("content-type", "application/json")
+
+		e.ServeHTTP(rec, req)
+
+		httpResponse := make(map[string][]domain.Person)
+
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &httpResponse))
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Equal(t, persons, httpResponse["data"])
+
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("error_bind", func(t *testing.T) {
+		mockUsecase := new(mocks.Usecase)
+
+		h := &Handler{
+			usecase: mockUsecase,
+		}
+
+		e := echo.New()
+
+		e.POST("/api/person/bulk", h.NewPersons, middlewares.ErrLogger())
+
+		rec := httptest.NewRecorder()
+
+		req := httptest.NewRequest(http.MethodPost, "/api/person/bulk", bytes.NewBufferString(`{"name": "Helen"}`))
+		req.Header.Add("content-type", "application/json")
+
+		e.ServeHTTP(rec, req)
+
+		var httpResponse domain.Response
+
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &httpResponse))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, invalidRequestBodyErr, *httpResponse.Error)
+	})
+
+	t.Run("error_bulk_size", func(t *testing.T) {
+		mockUsecase := new(mocks.Usecase)
+
+		h := &Handler{
+			usecase: mockUsecase,
+		}
+
+		e := echo.New()
+
+		e.POST("/api/person/bulk", h.NewPersons, middlewares.ErrLogger())
+
+		rec := httptest.NewRecorder()
+
+		mockUsecase.On("NewPersons", mock.Anything, []domain.Person{}, domain.Audit{}).Return(
+			nil,
+			customErrors.New(
+				"persons count must be between 1 and 100",
+				errors.New("persons count must be between 1 and 100"),
+				http.StatusBadRequest,
+			),
+		).Once()
+
+		req := httptest.NewRequest(http.MethodPost, "/api/person/bulk", bytes.NewBufferString(`[]`))
+		req.Header.Add("content-type", "application/json")
+
+		e.ServeHTTP(rec, req)
+
+		var httpResponse domain.Response
+
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &httpResponse))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, "persons count must be between 1 and 100", *httpResponse.Error)
+
+		mockUsecase.AssertExpectations(t)
+	})
+}
+
 func TestGetPerson(t *testing.T) {
-	//
+	res := domain.Response{
+		Data:       &domain.Person{ID: 1, Name: "Helen", Surname: "Johnson", Version: 2},
+		StatusCode: http.StatusOK,
+	}
+
+	t.Run("success", func(t *testing.T) {
+		mockUsecase := new(mocks.Usecase)
+
+		h := &Handler{
+			usecase: mockUsecase,
+		}
+
+		e := echo.New()
+
+		e.GET("/api/person/:id", h.GetPerson)
+
+		mockUsecase.On("GetByID", mock.Anything, 1, false).Return(&res, nil).Once()
+
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/person/1", nil))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, `"2"`, rec.Header().Get(headerETag))
+
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("success_include_deleted", func(t *testing.T) {
+		mockUsecase := new(mocks.Usecase)
+
+		h := &Handler{
+			usecase:      mockUsecase,
+			allowDeleted: true,
+		}
+
+		e := echo.New()
+
+		e.GET("/api/person/:id", h.GetPerson)
+
+		mockUsecase.On("GetByID", mock.Anything, 1, true).Return(&res, nil).Once()
+
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/person/1?include_deleted=true", nil))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("error_include_deleted", func(t *testing.T) {
+		mockUsecase := new(mocks.Usecase)
+
+		h := &Handler{
+			usecase: mockUsecase,
+		}
+
+		e := echo.New()
+
+		e.GET("/api/person/:id", h.GetPerson, middlewares.ErrLogger())
+
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/person/1?include_deleted=true", nil))
+
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("success_not_modified", func(t *testing.T) {
+		mockUsecase := new(mocks.Usecase)
+
+		h := &Handler{
+			usecase: mockUsecase,
+		}
+
+		e := echo.New()
+
+		e.GET("/api/person/:id", h.GetPerson)
+
+		mockUsecase.On("GetByID", mock.Anything, 1, false).Return(&res, nil).Once()
+
+		rec := httptest.NewRecorder()
+
+		req := httptest.NewRequest(http.MethodGet, "/api/person/1", nil)
+		req.Header.Add(headerIfNoneMatch, `"1", W/"2"`)
+
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusNotModified, rec.Code)
+		assert.Empty(t, rec.Body.Bytes())
+
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("success_not_modified_weak", func(t *testing.T) {
+		mockUsecase := new(mocks.Usecase)
+
+		h := &Handler{
+			usecase: mockUsecase,
+		}
+
+		e := echo.New()
+
+		e.GET("/api/person/:id", h.GetPerson)
+
+		mockUsecase.On("GetByID", mock.Anything, 1, false).Return(&res, nil).Twice()
+
+		// If-None-Match compares weakly
+		for ifNoneMatch, code := range map[string]int{
+			`W/"2"`: http.StatusNotModified,
+			`"1"`:   http.StatusOK,
+		} {
+			rec := httptest.NewRecorder()
+
+			req := httptest.NewRequest(http.MethodGet, "/api/person/1", nil)
+			req.Header.Add(headerIfNoneMatch, ifNoneMatch)
+
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(t, code, rec.Code, ifNoneMatch)
+		}
+
+		mockUsecase.AssertExpectations(t)
+	})
 }
 
 func TestGetPersons(t *testing.T) {
-	//
+	t.Run("error_include_deleted", func(t *testing.T) {
+		mockUsecase := new(mocks.Usecase)
+
+		h := &Handler{
+			usecase: mockUsecase,
+		}
+
+		e := echo.New()
+
+		e.POST("/api/person/filter", h.GetPersons, middlewares.ErrLogger())
+
+		rec := httptest.NewRecorder()
+
+		req := httptest.NewRequest(http.MethodPost, "/api/person/filter", bytes.NewBufferString(`{"include_deleted":true}`))
+		req.Header.Add("content-type", "application/json")
+
+		e.ServeHTTP(rec, req)
+
+		var httpResponse domain.Response
+
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &httpResponse))
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Equal(t, includeDeletedErr, *httpResponse.Error)
+
+		mockUsecase.AssertExpectations(t)
+	})
+}
+
+func TestGetPersonHistory(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		mockUsecase := new(mocks.Usecase)
+
+		h := &Handler{
+			usecase: mockUsecase,
+		}
+
+		e := echo.New()
+
+		e.GET("/api/person/:id/history", h.GetPersonHistory)
+
+		mockUsecase.On("GetHistory", mock.Anything, 1, false, &domain.FilterWithPagination{
+			Pagination: &domain.Pagination{Limit: 10, Page: 1, Mode: "cursor"},
+		}).Return(&domain.Response{
+			Data:       []byte(`{"data":[],"meta":{}}`),
+			StatusCode: http.StatusOK,
+		}, nil).Once()
+
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/person/1/history?limit=10&mode=cursor", nil))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"data":[],"meta":{}}`, rec.Body.String())
+
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("error_bad_request", func(t *testing.T) {
+		h := &Handler{
+			usecase: new(mocks.Usecase),
+		}
+
+		e := echo.New()
+
+		e.GET("/api/person/:id/history", h.GetPersonHistory, middlewares.ErrLogger())
+
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/person/1/history?limit=ten", nil))
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
 }
 
 func TestUpdate(t *testing.T) {
 	//
 }
 
+func TestPatchPerson(t *testing.T) {
+	newRequest := func(contentType, body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPatch, "/api/person/1", bytes.NewBufferString(body))
+		req.Header.Add("content-type", contentType)
+
+		return req
+	}
+
+	t.Run("success_merge_patch", func(t *testing.T) {
+		mockUsecase := new(mocks.Usecase)
+
+		h := &Handler{
+			usecase: mockUsecase,
+		}
+
+		e := echo.New()
+
+		e.PATCH("/api/person/:id", h.PatchPerson, middlewares.ErrLogger())
+
+		mockUsecase.On("Patch", mock.Anything, &domain.PersonPatch{
+			ID:      1,
+			Surname: domain.NewField("Smith"),
+			Age:     domain.NullField[int](),
+		}, (*int)(nil), domain.Audit{}).Return(&domain.Response{
+			Data:       &domain.Person{ID: 1},
+			StatusCode: http.StatusOK,
+		}, nil).Once()
+
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, newRequest(mimeMergePatch, `{"surname":"Smith","age":null}`))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("success_json_patch", func(t *testing.T) {
+		mockUsecase := new(mocks.Usecase)
+
+		h := &Handler{
+			usecase: mockUsecase,
+		}
+
+		e := echo.New()
+
+		e.PATCH("/api/person/:id", h.PatchPerson, middlewares.ErrLogger())
+
+		mockUsecase.On("JSONPatch", mock.Anything, 1, []domain.PatchOperation{
+			{Op: "remove", Path: "/age"},
+		}, utils.IntToPtr(3), domain.Audit{Actor: "admin"}).Return(&domain.Response{
+			Data:       &domain.Person{ID: 1, Version: 4},
+			StatusCode: http.StatusOK,
+		}, nil).Once()
+
+		rec := httptest.NewRecorder()
+
+		req := newRequest(mimeJSONPatch, `[{"op":"remove","path":"/age"}]`)
+		req.Header.Add(headerIfMatch, `"3"`)
+		req.Header.Add(headerActor, "admin")
+
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, `"4"`, rec.Header().Get(headerETag))
+
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("error_bad_request", func(t *testing.T) {
+		h := &Handler{
+			usecase: new(mocks.Usecase),
+		}
+
+		e := echo.New()
+
+		e.PATCH("/api/person/:id", h.PatchPerson, middlewares.ErrLogger())
+
+		for _, req := range []*http.Request{
+			newRequest(mimeMergePatch, `{"id":2}`),
+			newRequest(mimeMergePatch, `{"age":"old"}`),
+			newRequest(mimeJSONPatch, `{"op":"remove","path":"/age"}`),
+		} {
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, req)
+
+			var httpResponse domain.Response
+
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &httpResponse))
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Equal(t, invalidRequestBodyErr, *httpResponse.Error)
+		}
+	})
+
+	t.Run("error_if_match", func(t *testing.T) {
+		h := &Handler{
+			usecase:        new(mocks.Usecase),
+			requireIfMatch: true,
+		}
+
+		e := echo.New()
+
+		e.PATCH("/api/person/:id", h.PatchPerson, middlewares.ErrLogger())
+
+		for ifMatch, code := range map[string]int{
+			"":             http.StatusPreconditionRequired,
+			`W/"3"`:        http.StatusPreconditionFailed,
+			`W/"3", W/"4"`: http.StatusPreconditionFailed,
+			`"three"`:      http.StatusBadRequest,
+			`'3'`:          http.StatusBadRequest,
+			"`3`":          http.StatusBadRequest,
+			`"+3"`:         http.StatusBadRequest,
+			`"3", 4`:       http.StatusBadRequest,
+		} {
+			req := newRequest(mimeMergePatch, `{"surname":"Smith"}`)
+			if ifMatch != "" {
+				req.Header.Add(headerIfMatch, ifMatch)
+			}
+
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(t, code, rec.Code, ifMatch)
+		}
+	})
+
+	t.Run("if_match_list", func(t *testing.T) {
+		mockUsecase := new(mocks.Usecase)
+
+		h := &Handler{
+			usecase: mockUsecase,
+		}
+
+		e := echo.New()
+
+		e.PATCH("/api/person/:id", h.PatchPerson, middlewares.ErrLogger())
+
+		// the ETag of the current version is the one required
+		mockUsecase.On("GetByID", mock.Anything, 1, true).Return(&domain.Response{
+			Data:       &domain.Person{ID: 1, Version: 4},
+			StatusCode: http.StatusOK,
+		}, nil).Twice()
+
+		mockUsecase.On("Patch", mock.Anything, mock.Anything, utils.IntToPtr(4), domain.Audit{}).Return(&domain.Response{
+			Data:       &domain.Person{ID: 1, Version: 5},
+			StatusCode: http.StatusOK,
+		}, nil).Once()
+
+		for ifMatch, code := range map[string]int{
+			`"3", W/"5", "4"`: http.StatusOK,
+			`"2", "3"`:        http.StatusPreconditionFailed,
+		} {
+			req := newRequest(mimeMergePatch, `{"surname":"Smith"}`)
+			req.Header.Add(headerIfMatch, ifMatch)
+
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(t, code, rec.Code, ifMatch)
+		}
+
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("error_unsupported_media_type", func(t *testing.T) {
+		h := &Handler{
+			usecase: new(mocks.Usecase),
+		}
+
+		e := echo.New()
+
+		e.PATCH("/api/person/:id", h.PatchPerson, middlewares.ErrLogger())
+
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, newRequest("text/plain", `name=Helen`))
+
+		assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+	})
+}
+
 func TestDelete(t *testing.T) {
 	//
 }
+
+func TestReenrichPerson(t *testing.T) {
+	t.Run("success_dry_run", func(t *testing.T) {
+		mockUsecase := new(mocks.Usecase)
+
+		h := &Handler{
+			usecase: mockUsecase,
+		}
+
+		e := echo.New()
+
+		e.POST("/api/person/:id/enrich", h.ReenrichPerson)
+
+		mockUsecase.On("Reenrich", mock.Anything, 1, utils.IntToPtr(2), true, domain.Audit{}).Return(&domain.Response{
+			Data: &domain.Reenrichment{
+				Person:  &domain.Person{ID: 1, Name: "Helen", Surname: "Johnson", Version: 2},
+				Changes: map[string]domain.Change{"age": {Old: nil, New: utils.IntToPtr(40)}},
+			},
+			StatusCode: http.StatusOK,
+		}, nil).Once()
+
+		rec := httptest.NewRecorder()
+
+		req := httptest.NewRequest(http.MethodPost, "/api/person/1/enrich?dry_run=true", nil)
+		req.Header.Add(headerIfMatch, `"2"`)
+
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, `"2"`, rec.Header().Get(headerETag))
+
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("error_bad_request", func(t *testing.T) {
+		h := &Handler{
+			usecase: new(mocks.Usecase),
+		}
+
+		e := echo.New()
+
+		e.POST("/api/person/:id/enrich", h.ReenrichPerson, middlewares.ErrLogger())
+
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/person/1/enrich?dry_run=maybe", nil))
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestGetEnrichmentJobs(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		mockUsecase := new(mocks.Usecase)
+
+		h := &Handler{
+			usecase: mockUsecase,
+		}
+
+		e := echo.New()
+
+		e.GET("/api/enrichment/jobs", h.GetEnrichmentJobs)
+
+		mockUsecase.On("GetJobs", mock.Anything, domain.JobDead, defaultJobsLimit).Return(&domain.Response{
+			Data:       []domain.EnrichmentJob{{ID: 1, PersonID: 1, Status: domain.JobDead}},
+			StatusCode: http.StatusOK,
+		}, nil).Once()
+
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/enrichment/jobs?status=dead", nil))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("error_bad_request", func(t *testing.T) {
+		h := &Handler{
+			usecase: new(mocks.Usecase),
+		}
+
+		e := echo.New()
+
+		e.GET("/api/enrichment/jobs", h.GetEnrichmentJobs, middlewares.ErrLogger())
+
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/enrichment/jobs?limit=ten", nil))
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestRetryEnrichmentJob(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		mockUsecase := new(mocks.Usecase)
+
+		h := &Handler{
+			usecase: mockUsecase,
+		}
+
+		e := echo.New()
+
+		e.POST("/api/enrichment/jobs/:id/retry", h.RetryEnrichmentJob)
+
+		mockUsecase.On("RequeueJob", mock.Anything, int64(1), domain.Audit{Actor: "admin"}).Return(&domain.Response{
+			Data:       &domain.EnrichmentJob{ID: 1, PersonID: 1, Status: domain.JobQueued},
+			StatusCode: http.StatusOK,
+		}, nil).Once()
+
+		rec := httptest.NewRecorder()
+
+		req := httptest.NewRequest(http.MethodPost, "/api/enrichment/jobs/1/retry", nil)
+		req.Header.Add(headerActor, "admin")
+
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		mockUsecase.AssertExpectations(t)
+	})
+
+	t.Run("error_bad_request", func(t *testing.T) {
+		h := &Handler{
+			usecase: new(mocks.Usecase),
+		}
+
+		e := echo.New()
+
+		e.POST("/api/enrichment/jobs/:id/retry", h.RetryEnrichmentJob, middlewares.ErrLogger())
+
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/enrichment/jobs/one/retry", nil))
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
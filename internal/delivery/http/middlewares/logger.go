@@ -23,7 +23,8 @@ func ErrLogger() echo.MiddlewareFunc {
 				log.Errorln(errors.Wrap(customErr.Err, "ErrLogger #2"))
 
 				return c.JSON(customErr.StatusCode, domain.Response{
-					Error: &customErr.Message,
+					Error:   &customErr.Message,
+					Details: customErr.Details,
 				})
 			}
 
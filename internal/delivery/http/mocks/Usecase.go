@@ -3,8 +3,12 @@
 package mocks
 
 import (
+	context "context"
+
 	domain "namer/internal/domain"
 
+	time "time"
+
 	mock "github.com/stretchr/testify/mock"
 )
 
@@ -13,25 +17,259 @@ type Usecase struct {
 	mock.Mock
 }
 
-// Delete provides a mock function with given fields: id
-func (_m *Usecase) Delete(id int) (*domain.Response, error) {
-	ret := _m.Called(id)
+// Delete provides a mock function with given fields: ctx, id, version, audit
+func (_m *Usecase) Delete(ctx context.Context, id int, version *int, audit domain.Audit) (*domain.Response, error) {
+	ret := _m.Called(ctx, id, version, audit)
+
+	var r0 *domain.Response
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int, *int, domain.Audit) (*domain.Response, error)); ok {
+		return rf(ctx, id, version, audit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int, *int, domain.Audit) *domain.Response); ok {
+		r0 = rf(ctx, id, version, audit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*domain.Response)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int, *int, domain.Audit) error); ok {
+		r1 = rf(ctx, id, version, audit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetByID provides a mock function with given fields: ctx, id, includeDeleted
+func (_m *Usecase) GetByID(ctx context.Context, id int, includeDeleted bool) (*domain.Response, error) {
+	ret := _m.Called(ctx, id, includeDeleted)
+
+	var r0 *domain.Response
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int, bool) (*domain.Response, error)); ok {
+		return rf(ctx, id, includeDeleted)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int, bool) *domain.Response); ok {
+		r0 = rf(ctx, id, includeDeleted)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*domain.Response)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int, bool) error); ok {
+		r1 = rf(ctx, id, includeDeleted)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetHistory provides a mock function with given fields: ctx, id, includeDeleted, req
+func (_m *Usecase) GetHistory(ctx context.Context, id int, includeDeleted bool, req *domain.FilterWithPagination) (*domain.Response, error) {
+	ret := _m.Called(ctx, id, includeDeleted, req)
+
+	var r0 *domain.Response
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int, bool, *domain.FilterWithPagination) (*domain.Response, error)); ok {
+		return rf(ctx, id, includeDeleted, req)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int, bool, *domain.FilterWithPagination) *domain.Response); ok {
+		r0 = rf(ctx, id, includeDeleted, req)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*domain.Response)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int, bool, *domain.FilterWithPagination) error); ok {
+		r1 = rf(ctx, id, includeDeleted, req)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetJobs provides a mock function with given fields: ctx, status, limit
+func (_m *Usecase) GetJobs(ctx context.Context, status string, limit int) (*domain.Response, error) {
+	ret := _m.Called(ctx, status, limit)
+
+	var r0 *domain.Response
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) (*domain.Response, error)); ok {
+		return rf(ctx, status, limit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) *domain.Response); ok {
+		r0 = rf(ctx, status, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*domain.Response)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, int) error); ok {
+		r1 = rf(ctx, status, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetWithFilterAndPagination provides a mock function with given fields: ctx, req
+func (_m *Usecase) GetWithFilterAndPagination(ctx context.Context, req *domain.FilterWithPagination) (*domain.Response, error) {
+	ret := _m.Called(ctx, req)
+
+	var r0 *domain.Response
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *domain.FilterWithPagination) (*domain.Response, error)); ok {
+		return rf(ctx, req)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *domain.FilterWithPagination) *domain.Response); ok {
+		r0 = rf(ctx, req)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*domain.Response)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *domain.FilterWithPagination) error); ok {
+		r1 = rf(ctx, req)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// JSONPatch provides a mock function with given fields: ctx, id, ops, version, audit
+func (_m *Usecase) JSONPatch(ctx context.Context, id int, ops []domain.PatchOperation, version *int, audit domain.Audit) (*domain.Response, error) {
+	ret := _m.Called(ctx, id, ops, version, audit)
+
+	var r0 *domain.Response
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int, []domain.PatchOperation, *int, domain.Audit) (*domain.Response, error)); ok {
+		return rf(ctx, id, ops, version, audit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int, []domain.PatchOperation, *int, domain.Audit) *domain.Response); ok {
+		r0 = rf(ctx, id, ops, version, audit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*domain.Response)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int, []domain.PatchOperation, *int, domain.Audit) error); ok {
+		r1 = rf(ctx, id, ops, version, audit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewPerson provides a mock function with given fields: ctx, req, audit
+func (_m *Usecase) NewPerson(ctx context.Context, req *domain.Person, audit domain.Audit) (*domain.Response, error) {
+	ret := _m.Called(ctx, req, audit)
+
+	var r0 *domain.Response
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *domain.Person, domain.Audit) (*domain.Response, error)); ok {
+		return rf(ctx, req, audit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *domain.Person, domain.Audit) *domain.Response); ok {
+		r0 = rf(ctx, req, audit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*domain.Response)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *domain.Person, domain.Audit) error); ok {
+		r1 = rf(ctx, req, audit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewPersons provides a mock function with given fields: ctx, reqs, audit
+func (_m *Usecase) NewPersons(ctx context.Context, reqs []domain.Person, audit domain.Audit) (*domain.Response, error) {
+	ret := _m.Called(ctx, reqs, audit)
+
+	var r0 *domain.Response
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, []domain.Person, domain.Audit) (*domain.Response, error)); ok {
+		return rf(ctx, reqs, audit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, []domain.Person, domain.Audit) *domain.Response); ok {
+		r0 = rf(ctx, reqs, audit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*domain.Response)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, []domain.Person, domain.Audit) error); ok {
+		r1 = rf(ctx, reqs, audit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Patch provides a mock function with given fields: ctx, req, version, audit
+func (_m *Usecase) Patch(ctx context.Context, req *domain.PersonPatch, version *int, audit domain.Audit) (*domain.Response, error) {
+	ret := _m.Called(ctx, req, version, audit)
+
+	var r0 *domain.Response
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *domain.PersonPatch, *int, domain.Audit) (*domain.Response, error)); ok {
+		return rf(ctx, req, version, audit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *domain.PersonPatch, *int, domain.Audit) *domain.Response); ok {
+		r0 = rf(ctx, req, version, audit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*domain.Response)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *domain.PersonPatch, *int, domain.Audit) error); ok {
+		r1 = rf(ctx, req, version, audit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Purge provides a mock function with given fields: ctx, retention, audit
+func (_m *Usecase) Purge(ctx context.Context, retention time.Duration, audit domain.Audit) (*domain.Response, error) {
+	ret := _m.Called(ctx, retention, audit)
 
 	var r0 *domain.Response
 	var r1 error
-	if rf, ok := ret.Get(0).(func(int) (*domain.Response, error)); ok {
-		return rf(id)
+	if rf, ok := ret.Get(0).(func(context.Context, time.Duration, domain.Audit) (*domain.Response, error)); ok {
+		return rf(ctx, retention, audit)
 	}
-	if rf, ok := ret.Get(0).(func(int) *domain.Response); ok {
-		r0 = rf(id)
+	if rf, ok := ret.Get(0).(func(context.Context, time.Duration, domain.Audit) *domain.Response); ok {
+		r0 = rf(ctx, retention, audit)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*domain.Response)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(int) error); ok {
-		r1 = rf(id)
+	if rf, ok := ret.Get(1).(func(context.Context, time.Duration, domain.Audit) error); ok {
+		r1 = rf(ctx, retention, audit)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -39,25 +277,25 @@ func (_m *Usecase) Delete(id int) (*domain.Response, error) {
 	return r0, r1
 }
 
-// GetByID provides a mock function with given fields: id
-func (_m *Usecase) GetByID(id int) (*domain.Response, error) {
-	ret := _m.Called(id)
+// Reenrich provides a mock function with given fields: ctx, id, version, dryRun, audit
+func (_m *Usecase) Reenrich(ctx context.Context, id int, version *int, dryRun bool, audit domain.Audit) (*domain.Response, error) {
+	ret := _m.Called(ctx, id, version, dryRun, audit)
 
 	var r0 *domain.Response
 	var r1 error
-	if rf, ok := ret.Get(0).(func(int) (*domain.Response, error)); ok {
-		return rf(id)
+	if rf, ok := ret.Get(0).(func(context.Context, int, *int, bool, domain.Audit) (*domain.Response, error)); ok {
+		return rf(ctx, id, version, dryRun, audit)
 	}
-	if rf, ok := ret.Get(0).(func(int) *domain.Response); ok {
-		r0 = rf(id)
+	if rf, ok := ret.Get(0).(func(context.Context, int, *int, bool, domain.Audit) *domain.Response); ok {
+		r0 = rf(ctx, id, version, dryRun, audit)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*domain.Response)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(int) error); ok {
-		r1 = rf(id)
+	if rf, ok := ret.Get(1).(func(context.Context, int, *int, bool, domain.Audit) error); ok {
+		r1 = rf(ctx, id, version, dryRun, audit)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -65,25 +303,25 @@ func (_m *Usecase) GetByID(id int) (*domain.Response, error) {
 	return r0, r1
 }
 
-// GetWithFilterAndPagination provides a mock function with given fields: req
-func (_m *Usecase) GetWithFilterAndPagination(req *domain.FilterWithPagination) (*domain.Response, error) {
-	ret := _m.Called(req)
+// RequeueJob provides a mock function with given fields: ctx, id, audit
+func (_m *Usecase) RequeueJob(ctx context.Context, id int64, audit domain.Audit) (*domain.Response, error) {
+	ret := _m.Called(ctx, id, audit)
 
 	var r0 *domain.Response
 	var r1 error
-	if rf, ok := ret.Get(0).(func(*domain.FilterWithPagination) (*domain.Response, error)); ok {
-		return rf(req)
+	if rf, ok := ret.Get(0).(func(context.Context, int64, domain.Audit) (*domain.Response, error)); ok {
+		return rf(ctx, id, audit)
 	}
-	if rf, ok := ret.Get(0).(func(*domain.FilterWithPagination) *domain.Response); ok {
-		r0 = rf(req)
+	if rf, ok := ret.Get(0).(func(context.Context, int64, domain.Audit) *domain.Response); ok {
+		r0 = rf(ctx, id, audit)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*domain.Response)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(*domain.FilterWithPagination) error); ok {
-		r1 = rf(req)
+	if rf, ok := ret.Get(1).(func(context.Context, int64, domain.Audit) error); ok {
+		r1 = rf(ctx, id, audit)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -91,25 +329,25 @@ func (_m *Usecase) GetWithFilterAndPagination(req *domain.FilterWithPagination)
 	return r0, r1
 }
 
-// NewPerson provides a mock function with given fields: req
-func (_m *Usecase) NewPerson(req *domain.Person) (*domain.Response, error) {
-	ret := _m.Called(req)
+// Restore provides a mock function with given fields: ctx, id, version, audit
+func (_m *Usecase) Restore(ctx context.Context, id int, version *int, audit domain.Audit) (*domain.Response, error) {
+	ret := _m.Called(ctx, id, version, audit)
 
 	var r0 *domain.Response
 	var r1 error
-	if rf, ok := ret.Get(0).(func(*domain.Person) (*domain.Response, error)); ok {
-		return rf(req)
+	if rf, ok := ret.Get(0).(func(context.Context, int, *int, domain.Audit) (*domain.Response, error)); ok {
+		return rf(ctx, id, version, audit)
 	}
-	if rf, ok := ret.Get(0).(func(*domain.Person) *domain.Response); ok {
-		r0 = rf(req)
+	if rf, ok := ret.Get(0).(func(context.Context, int, *int, domain.Audit) *domain.Response); ok {
+		r0 = rf(ctx, id, version, audit)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*domain.Response)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(*domain.Person) error); ok {
-		r1 = rf(req)
+	if rf, ok := ret.Get(1).(func(context.Context, int, *int, domain.Audit) error); ok {
+		r1 = rf(ctx, id, version, audit)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -117,25 +355,25 @@ func (_m *Usecase) NewPerson(req *domain.Person) (*domain.Response, error) {
 	return r0, r1
 }
 
-// Update provides a mock function with given fields: req
-func (_m *Usecase) Update(req *domain.Person) (*domain.Response, error) {
-	ret := _m.Called(req)
+// Update provides a mock function with given fields: ctx, req, version, audit
+func (_m *Usecase) Update(ctx context.Context, req *domain.Person, version *int, audit domain.Audit) (*domain.Response, error) {
+	ret := _m.Called(ctx, req, version, audit)
 
 	var r0 *domain.Response
 	var r1 error
-	if rf, ok := ret.Get(0).(func(*domain.Person) (*domain.Response, error)); ok {
-		return rf(req)
+	if rf, ok := ret.Get(0).(func(context.Context, *domain.Person, *int, domain.Audit) (*domain.Response, error)); ok {
+		return rf(ctx, req, version, audit)
 	}
-	if rf, ok := ret.Get(0).(func(*domain.Person) *domain.Response); ok {
-		r0 = rf(req)
+	if rf, ok := ret.Get(0).(func(context.Context, *domain.Person, *int, domain.Audit) *domain.Response); ok {
+		r0 = rf(ctx, req, version, audit)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*domain.Response)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(*domain.Person) error); ok {
-		r1 = rf(req)
+	if rf, ok := ret.Get(1).(func(context.Context, *domain.Person, *int, domain.Audit) error); ok {
+		r1 = rf(ctx, req, version, audit)
 	} else {
 		r1 = ret.Error(1)
 	}
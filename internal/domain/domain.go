@@ -1,36 +1,198 @@
 package domain
 
-import "time"
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
 
+// ErrVersionMismatch is returned by conditional writes when the row version has moved on.
+var ErrVersionMismatch = errors.New("version mismatch")
+
+// ErrLeaseLost is returned when a worker reports back on a job it no longer holds, the job was
+// claimed again or closed in the meantime.
+var ErrLeaseLost = errors.New("job lease lost")
+
+// Enrichment statuses of a person, pending ones wait for an enrichment job and failed ones
+// have a dead job.
+const (
+	EnrichmentPending = "pending"
+	EnrichmentDone    = "done"
+	EnrichmentFailed  = "failed"
+)
+
+// Enrichment job statuses, a dead job ran out of attempts and waits for a manual retry.
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobDead    = "dead"
+)
+
+// Person holds the confidence of the name providers next to age, gender and nation: the number
+// of samples behind a guess and its probability, empty for a value set by a client.
+// Nationalities lists every country the providers consider for the name.
 type Person struct {
-	ID         int        `json:"id"`
-	Name       string     `json:"name"`
-	Surname    string     `json:"surname"`
-	Patronymic *string    `json:"patronymic"`
-	Age        *int       `json:"age"`
-	Gender     *string    `json:"gender"`
-	Nation     *string    `json:"nation"`
-	CreatedAt  time.Time  `json:"created_at"`
-	UpdatedAt  *time.Time `json:"updated_at"`
+	ID                int           `json:"id"`
+	Name              string        `json:"name"`
+	Surname           string        `json:"surname"`
+	Patronymic        *string       `json:"patronymic"`
+	Age               *int          `json:"age"`
+	Gender            *string       `json:"gender"`
+	Nation            *string       `json:"nation"`
+	AgeCount          *int          `json:"age_count"`
+	GenderProbability *float64      `json:"gender_probability"`
+	GenderCount       *int          `json:"gender_count"`
+	NationProbability *float64      `json:"nation_probability"`
+	NationCount       *int          `json:"nation_count"`
+	Nationalities     []Nationality `json:"nationalities"`
+	CreatedAt         time.Time     `json:"created_at"`
+	UpdatedAt         *time.Time    `json:"updated_at"`
+	DeletedAt         *time.Time    `json:"deleted_at,omitempty"`
+	Version           int           `json:"version"`
+	EnrichmentStatus  string        `json:"enrichment_status"`
+	EnrichedAt        *time.Time    `json:"enriched_at"`
+}
+
+// Nationality is a candidate country of a person, rank 1 is the most probable one.
+type Nationality struct {
+	CountryID   string  `json:"country_id"`
+	Probability float64 `json:"probability"`
+	Rank        int     `json:"rank"`
 }
 
 type FilterWithPagination struct {
-	Filter     []Filter    `json:"filter"`
-	Pagination *Pagination `json:"pagination"`
+	Filter         []Filter     `json:"filter"`
+	Where          *FilterGroup `json:"where"`
+	Sort           []Sort       `json:"sort"`
+	Pagination     *Pagination  `json:"pagination"`
+	IncludeDeleted bool         `json:"include_deleted"`
+}
+
+type FilterGroup struct {
+	Operator string        `json:"operator"`
+	Filter   []Filter      `json:"filter"`
+	Groups   []FilterGroup `json:"groups"`
 }
 
 type Filter struct {
-	Field string `json:"field"`
-	Value string `json:"value"`
+	Field    string `json:"field"`
+	Operator string `json:"operator,omitempty"`
+	Value    any    `json:"value"`
+}
+
+type Sort struct {
+	Field     string `json:"field"`
+	Direction string `json:"direction"`
+	Nulls     string `json:"nulls"`
 }
 
 type Pagination struct {
-	Limit int `json:"limit"`
-	Page  int `json:"page"`
+	Limit  int    `json:"limit"`
+	Page   int    `json:"page"`
+	Mode   string `json:"mode"`
+	Cursor string `json:"cursor"`
+	Count  string `json:"count"`
+}
+
+type PersonList struct {
+	Data []Person `json:"data"`
+	Meta Meta     `json:"meta"`
+}
+
+type Meta struct {
+	AllRowCount *int    `json:"all_row_count,omitempty"`
+	CountMode   string  `json:"count_mode"`
+	Mode        string  `json:"mode"`
+	Page        *int    `json:"page,omitempty"`
+	Limit       int     `json:"limit"`
+	TotalPages  *int    `json:"total_pages,omitempty"`
+	HasNext     bool    `json:"has_next"`
+	HasPrev     bool    `json:"has_prev"`
+	NextCursor  *string `json:"next_cursor,omitempty"`
+	PrevCursor  *string `json:"prev_cursor,omitempty"`
+}
+
+// Audit identifies who made a change and in which request, it is stored in the person history.
+type Audit struct {
+	Actor     string
+	RequestID string
+}
+
+type PersonHistory struct {
+	ID        int64           `json:"id"`
+	PersonID  int             `json:"person_id"`
+	Operation string          `json:"operation"`
+	OldValues json.RawMessage `json:"old_values"`
+	NewValues json.RawMessage `json:"new_values"`
+	Actor     *string         `json:"actor"`
+	RequestID *string         `json:"request_id"`
+	ChangedAt time.Time       `json:"changed_at"`
+}
+
+type PersonHistoryList struct {
+	Data []PersonHistory `json:"data"`
+	Meta Meta            `json:"meta"`
+}
+
+type EnrichmentJob struct {
+	ID        int64     `json:"id"`
+	PersonID  int       `json:"person_id"`
+	Status    string    `json:"status"`
+	Attempts  int       `json:"attempts"`
+	RunAt     time.Time `json:"run_at"`
+	LastError *string   `json:"last_error"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Person holds the name and the nation hint of a claimed job's person.
+	Person *Person `json:"-"`
+}
+
+type PurgeResult struct {
+	Purged        int64     `json:"purged"`
+	DeletedBefore time.Time `json:"deleted_before"`
+}
+
+// Reenrichment is the outcome of looking a person up again: Changes holds the fields whose
+// value the lookup changed, Applied tells whether they were written.
+type Reenrichment struct {
+	Person  *Person           `json:"person"`
+	Changes map[string]Change `json:"changes"`
+	Applied bool              `json:"applied"`
+}
+
+type Change struct {
+	Old any `json:"old"`
+	New any `json:"new"`
 }
 
 type Response struct {
 	Data       any     `json:"data,omitempty"`
 	Error      *string `json:"error,omitempty"`
+	Details    any     `json:"details,omitempty"`
 	StatusCode int     `json:"-"`
 }
+
+// PersonPatch is a partial update: only fields that are Set are written, a Set field
+// with a nil Value clears the column.
+type PersonPatch struct {
+	ID         int           `json:"-"`
+	Name       Field[string] `json:"name"`
+	Surname    Field[string] `json:"surname"`
+	Patronymic Field[string] `json:"patronymic"`
+	Age        Field[int]    `json:"age"`
+	Gender     Field[string] `json:"gender"`
+	Nation     Field[string] `json:"nation"`
+}
+
+func (p *PersonPatch) IsEmpty() bool {
+	return !p.Name.Set && !p.Surname.Set && !p.Patronymic.Set && !p.Age.Set && !p.Gender.Set && !p.Nation.Set
+}
+
+// PatchOperation is a single RFC 6902 JSON Patch operation.
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
@@ -1,11 +1,17 @@
 package external
 
+import "errors"
+
+// ExternalResponse is what the providers found out about a name. The age, gender and nation
+// sections are shaped after the agify, genderize and nationalize services, any provider may fill them.
+// Fallback tells that a section came from a provider other than the first one of its attribute.
 type ExternalResponse struct {
 	Agify       *AgifyResponse
 	Genderize   *GenderizeResponse
 	Nationalize *NationalizeResponse
 	Error       *string
 	StatusCode  int
+	Fallback    bool `json:"-"`
 }
 
 type AgifyResponse struct {
@@ -26,12 +32,17 @@ type GenderizeResponse struct {
 }
 
 type NationalizeResponse struct {
-	Count   *int    `json:"count"`
-	Name    *string `json:"name"`
-	Country []struct {
-		CountryId   string  `json:"country_id"`
-		Probability float64 `json:"probability"`
-	} `json:"country"`
-	Error      *string `json:"error"`
-	StatusCode int     `json:"-"`
+	Count      *int                 `json:"count"`
+	Name       *string              `json:"name"`
+	Country    []CountryProbability `json:"country"`
+	Error      *string              `json:"error"`
+	StatusCode int                  `json:"-"`
 }
+
+type CountryProbability struct {
+	CountryId   string  `json:"country_id"`
+	Probability float64 `json:"probability"`
+}
+
+// ErrProviderUnavailable is returned without asking a provider whose circuit breaker is open.
+var ErrProviderUnavailable = errors.New("name provider unavailable")
@@ -0,0 +1,40 @@
+package domain
+
+import "encoding/json"
+
+// Field tells an absent JSON member apart from an explicit null: Set is true
+// whenever the member is present, Value is nil when it is null.
+type Field[T any] struct {
+	Set   bool
+	Value *T
+}
+
+func NewField[T any](v T) Field[T] {
+	return Field[T]{Set: true, Value: &v}
+}
+
+func NullField[T any]() Field[T] {
+	return Field[T]{Set: true}
+}
+
+func (f *Field[T]) UnmarshalJSON(b []byte) error {
+	f.Set, f.Value = true, nil
+
+	if string(b) == "null" {
+		return nil
+	}
+
+	var v T
+
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	f.Value = &v
+
+	return nil
+}
+
+func (f Field[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f.Value)
+}
@@ -0,0 +1,401 @@
+package fakeapi
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The APIs the server mimics.
+const (
+	Agify       = "agify"
+	Genderize   = "genderize"
+	Nationalize = "nationalize"
+)
+
+// MaxBatchSize is the number of names the APIs accept in a single request.
+const MaxBatchSize = 10
+
+// The error messages of the APIs.
+const (
+	errMissingName      = "Missing 'name' parameter"
+	errInvalidName      = "Invalid 'name' parameter"
+	errInvalidAPIKey    = "Invalid API key"
+	errLimitReached     = "Request limit reached"
+	errLimitTooLow      = "Request limit too low to process request"
+	errMethodNotAllowed = "Method not allowed"
+)
+
+const defaultLimitWindow = time.Hour * 24
+
+// seed holds the statistics the server answers with unless told otherwise.
+//
+//go:embed seed.json
+var seed []byte
+
+// Entry holds the statistics of a name. An entry with a CountryID answers the age and gender
+// lookups narrowed down to that country, the nationalities are taken from the entry without one.
+type Entry struct {
+	Name        string    `json:"name"`
+	CountryID   string    `json:"country_id,omitempty"`
+	Age         *int      `json:"age,omitempty"`
+	Gender      *string   `json:"gender,omitempty"`
+	Probability float64   `json:"probability,omitempty"`
+	Count       int       `json:"count"`
+	Country     []Country `json:"country,omitempty"`
+}
+
+type Country struct {
+	CountryID   string  `json:"country_id"`
+	Probability float64 `json:"probability"`
+}
+
+// Faults make an API misbehave. Every request waits Latency first, then the next FailNext
+// requests get a 503, every request gets Status when it is set and a share of ErrorRate of
+// them a 500. RateLimit names are allowed per RateLimitWindow, a day by default.
+type Faults struct {
+	Latency         time.Duration
+	FailNext        int
+	Status          int
+	ErrorRate       float64
+	RateLimit       int
+	RateLimitWindow time.Duration
+}
+
+// Server answers like the agify, genderize and nationalize APIs do, every API has a handler
+// of its own so it can be served on a host of its own.
+type Server struct {
+	mu      sync.Mutex
+	entries map[string]Entry
+	apiKey  string
+	rand    *rand.Rand
+	apis    map[string]*api
+}
+
+type api struct {
+	faults      Faults
+	requests    int
+	used        int
+	windowStart time.Time
+}
+
+type Option func(s *Server)
+
+// WithSeed replaces the embedded statistics.
+func WithSeed(entries []Entry) Option {
+	return func(s *Server) {
+		s.entries = index(entries)
+	}
+}
+
+// WithAPIKey makes the APIs answer only requests that send the key.
+func WithAPIKey(apiKey string) Option {
+	return func(s *Server) {
+		s.apiKey = apiKey
+	}
+}
+
+// WithFaults makes the API misbehave from the start.
+func WithFaults(name string, faults Faults) Option {
+	return func(s *Server) {
+		if a, ok := s.apis[name]; ok {
+			a.faults = faults
+		}
+	}
+}
+
+// WithRandSeed seeds the choice of the requests failed by ErrorRate.
+func WithRandSeed(seed int64) Option {
+	return func(s *Server) {
+		s.rand = rand.New(rand.NewSource(seed))
+	}
+}
+
+func New(opts ...Option) (*Server, error) {
+	entries, err := LoadSeed(bytes.NewReader(seed))
+	if err != nil {
+		return nil, errors.Wrap(err, "New #1")
+	}
+
+	s := &Server{
+		entries: index(entries),
+		rand:    rand.New(rand.NewSource(1)),
+		apis: map[string]*api{
+			Agify:       {},
+			Genderize:   {},
+			Nationalize: {},
+		},
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s, nil
+}
+
+// LoadSeed reads a JSON array of entries.
+func LoadSeed(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return nil, errors.Wrap(err, "LoadSeed #1")
+	}
+
+	return entries, nil
+}
+
+// LoadSeedFile reads a JSON array of entries from the file at path.
+func LoadSeedFile(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "LoadSeedFile #1")
+	}
+
+	defer f.Close()
+
+	entries, err := LoadSeed(f)
+	if err != nil {
+		return nil, errors.Wrap(err, "LoadSeedFile #2")
+	}
+
+	return entries, nil
+}
+
+func index(entries []Entry) map[string]Entry {
+	res := make(map[string]Entry, len(entries))
+
+	for _, e := range entries {
+		res[key(e.Name, e.CountryID)] = e
+	}
+
+	return res
+}
+
+// key ignores the case of the name and the country, like the APIs do.
+func key(name, country string) string {
+	return strings.ToLower(strings.TrimSpace(name)) + "|" + strings.ToUpper(country)
+}
+
+// SetFaults changes how the API misbehaves, the rate limit starts over.
+func (s *Server) SetFaults(name string, faults Faults) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if a, ok := s.apis[name]; ok {
+		a.faults, a.used, a.windowStart = faults, 0, time.Time{}
+	}
+}
+
+// Requests returns the number of requests the API got.
+func (s *Server) Requests(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if a, ok := s.apis[name]; ok {
+		return a.requests
+	}
+
+	return 0
+}
+
+// Handler returns the handler of the API, an unknown API is not found.
+func (s *Server) Handler(name string) http.Handler {
+	if _, ok := s.apis[name]; !ok {
+		return http.NotFoundHandler()
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.serve(w, r, name)
+	})
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request, name string) {
+	query := r.URL.Query()
+
+	names, batch := query["name[]"], true
+	if !query.Has("name[]") {
+		names, batch = query["name"], false
+	}
+
+	faults, status := s.admit(name)
+
+	if faults.Latency > 0 {
+		timer := time.NewTimer(faults.Latency)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	switch {
+	case status != 0:
+		writeError(w, status, http.StatusText(status))
+	case r.Method != http.MethodGet:
+		writeError(w, http.StatusMethodNotAllowed, errMethodNotAllowed)
+	case s.apiKey != "" && query.Get("apikey") != s.apiKey:
+		writeError(w, http.StatusUnauthorized, errInvalidAPIKey)
+	case len(names) == 0:
+		writeError(w, http.StatusUnprocessableEntity, errMissingName)
+	case len(names) > MaxBatchSize || !batch && len(names) > 1:
+		writeError(w, http.StatusUnprocessableEntity, errInvalidName)
+	default:
+		s.answer(w, name, names, query.Get("country_id"), batch)
+	}
+}
+
+// answer looks the names up once the rate limit allows it, a batch is answered with an array.
+func (s *Server) answer(w http.ResponseWriter, name string, names []string, country string, batch bool) {
+	if !s.allow(w, name, len(names)) {
+		return
+	}
+
+	if name == Nationalize {
+		country = ""
+	}
+
+	objects := make([]any, len(names))
+
+	for i, n := range names {
+		objects[i] = s.object(name, n, country)
+	}
+
+	if batch {
+		writeJSON(w, http.StatusOK, objects)
+	} else {
+		writeJSON(w, http.StatusOK, objects[0])
+	}
+}
+
+// admit counts the request and returns the faults of the API with the status a fault
+// answers the request with.
+func (s *Server) admit(name string) (Faults, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a := s.apis[name]
+	a.requests++
+
+	switch {
+	case a.faults.FailNext > 0:
+		a.faults.FailNext--
+
+		return a.faults, http.StatusServiceUnavailable
+	case a.faults.Status != 0:
+		return a.faults, a.faults.Status
+	case a.faults.ErrorRate > 0 && s.rand.Float64() < a.faults.ErrorRate:
+		return a.faults, http.StatusInternalServerError
+	}
+
+	return a.faults, 0
+}
+
+// allow takes cost names off the quota of the API and sets the rate limit headers, every
+// name counts as a request. A request the quota is too low for is answered with a 429.
+func (s *Server) allow(w http.ResponseWriter, name string, cost int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a := s.apis[name]
+	if a.faults.RateLimit <= 0 {
+		return true
+	}
+
+	window := a.faults.RateLimitWindow
+	if window <= 0 {
+		window = defaultLimitWindow
+	}
+
+	now := time.Now()
+
+	if a.windowStart.IsZero() || now.Sub(a.windowStart) >= window {
+		a.used, a.windowStart = 0, now
+	}
+
+	remaining := a.faults.RateLimit - a.used
+	allowed := cost <= remaining
+
+	if allowed {
+		a.used += cost
+		remaining -= cost
+	}
+
+	reset := int(math.Ceil(a.windowStart.Add(window).Sub(now).Seconds()))
+
+	w.Header().Set("X-Rate-Limit-Limit", strconv.Itoa(a.faults.RateLimit))
+	w.Header().Set("X-Rate-Limit-Remaining", strconv.Itoa(remaining))
+	w.Header().Set("X-Rate-Limit-Reset", strconv.Itoa(reset))
+
+	switch {
+	case allowed:
+	case remaining == 0:
+		writeError(w, http.StatusTooManyRequests, errLimitReached)
+	default:
+		writeError(w, http.StatusTooManyRequests, errLimitTooLow)
+	}
+
+	return allowed
+}
+
+// object returns what the API tells about the name, an unknown name has a count of 0.
+func (s *Server) object(api, name, country string) any {
+	global := s.entries[key(name, "")]
+
+	local, ok := s.entries[key(name, country)]
+	if !ok || country == "" {
+		local = global
+	}
+
+	switch api {
+	case Agify:
+		return struct {
+			Count     int    `json:"count"`
+			Name      string `json:"name"`
+			Age       *int   `json:"age"`
+			CountryID string `json:"country_id,omitempty"`
+		}{local.Count, name, local.Age, country}
+	case Genderize:
+		return struct {
+			Count       int     `json:"count"`
+			Name        string  `json:"name"`
+			Gender      *string `json:"gender"`
+			Probability float64 `json:"probability"`
+			CountryID   string  `json:"country_id,omitempty"`
+		}{local.Count, name, local.Gender, local.Probability, country}
+	default:
+		countries := global.Country
+		if countries == nil {
+			countries = []Country{}
+		}
+
+		return struct {
+			Count   int       `json:"count"`
+			Name    string    `json:"name"`
+			Country []Country `json:"country"`
+		}{global.Count, name, countries}
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,181 @@
+package fakeapi
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func get(s *Server, api, query string) (*http.Response, string) {
+	rec := httptest.NewRecorder()
+
+	s.Handler(api).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?"+query, nil))
+
+	return rec.Result(), strings.TrimSpace(rec.Body.String())
+}
+
+func batch(n int) string {
+	names := make([]string, n)
+
+	for i := range names {
+		names[i] = "name[]=a"
+	}
+
+	return strings.Join(names, "&")
+}
+
+func TestServer(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		s, err := New()
+		require.NoError(t, err)
+
+		for api, body := range map[string]string{
+			Agify:       `{"count":287812,"name":"Helen","age":60}`,
+			Genderize:   `{"count":287812,"name":"Helen","gender":"female","probability":0.98}`,
+			Nationalize: `{"count":287812,"name":"Helen","country":[{"country_id":"GB","probability":0.12},{"country_id":"US","probability":0.1},{"country_id":"IE","probability":0.07}]}`,
+		} {
+			res, got := get(s, api, "name=Helen")
+
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+			assert.Equal(t, body, got, api)
+		}
+
+		assert.Equal(t, 1, s.Requests(Agify))
+	})
+
+	t.Run("success_country", func(t *testing.T) {
+		s, err := New()
+		require.NoError(t, err)
+
+		_, got := get(s, Agify, "name=helen&country_id=GB")
+		assert.Equal(t, `{"count":41270,"name":"helen","age":58,"country_id":"GB"}`, got)
+
+		// nationalize does not narrow down by country
+		_, got = get(s, Nationalize, "name=Yuki&country_id=GB")
+		assert.Contains(t, got, `"country_id":"JP"`)
+	})
+
+	t.Run("success_batch", func(t *testing.T) {
+		age := 30
+
+		s, err := New(WithSeed([]Entry{{Name: "Zed", Age: &age, Count: 5}}))
+		require.NoError(t, err)
+
+		_, got := get(s, Agify, "name[]=zed&name[]=Helen")
+		assert.Equal(t, `[{"count":5,"name":"zed","age":30},{"count":0,"name":"Helen","age":null}]`, got)
+
+		_, got = get(s, Genderize, "name[]=Helen")
+		assert.Equal(t, `[{"count":0,"name":"Helen","gender":null,"probability":0}]`, got)
+
+		_, got = get(s, Nationalize, "name[]=Helen")
+		assert.Equal(t, `[{"count":0,"name":"Helen","country":[]}]`, got)
+	})
+
+	t.Run("error_requests", func(t *testing.T) {
+		s, err := New(WithAPIKey("secret"))
+		require.NoError(t, err)
+
+		for query, want := range map[string]struct {
+			status int
+			body   string
+		}{
+			"name=Helen":                  {http.StatusUnauthorized, `{"error":"Invalid API key"}`},
+			"apikey=secret":               {http.StatusUnprocessableEntity, `{"error":"Missing 'name' parameter"}`},
+			"apikey=secret&name=a&name=b": {http.StatusUnprocessableEntity, `{"error":"Invalid 'name' parameter"}`},
+			"apikey=secret&" + batch(11):  {http.StatusUnprocessableEntity, `{"error":"Invalid 'name' parameter"}`},
+		} {
+			res, got := get(s, Agify, query)
+
+			assert.Equal(t, want.status, res.StatusCode, query)
+			assert.Equal(t, want.body, got, query)
+		}
+	})
+
+	t.Run("error_rate_limit", func(t *testing.T) {
+		s, err := New(WithFaults(Genderize, Faults{RateLimit: 3, RateLimitWindow: time.Minute}))
+		require.NoError(t, err)
+
+		res, _ := get(s, Genderize, batch(2))
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "3", res.Header.Get("X-Rate-Limit-Limit"))
+		assert.Equal(t, "1", res.Header.Get("X-Rate-Limit-Remaining"))
+		assert.Equal(t, "60", res.Header.Get("X-Rate-Limit-Reset"))
+
+		// every name counts as a request
+		res, got := get(s, Genderize, batch(2))
+		assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+		assert.Equal(t, `{"error":"Request limit too low to process request"}`, got)
+
+		_, _ = get(s, Genderize, "name=a")
+
+		res, got = get(s, Genderize, "name=a")
+		assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+		assert.Equal(t, "0", res.Header.Get("X-Rate-Limit-Remaining"))
+		assert.Equal(t, `{"error":"Request limit reached"}`, got)
+
+		// the other APIs have quotas of their own
+		res, _ = get(s, Agify, "name=a")
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Empty(t, res.Header.Get("X-Rate-Limit-Limit"))
+	})
+
+	t.Run("error_faults", func(t *testing.T) {
+		s, err := New()
+		require.NoError(t, err)
+
+		s.SetFaults(Agify, Faults{FailNext: 1, Status: http.StatusPaymentRequired})
+
+		res, got := get(s, Agify, "name=a")
+		assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+		assert.Equal(t, `{"error":"Service Unavailable"}`, got)
+
+		res, _ = get(s, Agify, "name=a")
+		assert.Equal(t, http.StatusPaymentRequired, res.StatusCode)
+
+		s.SetFaults(Agify, Faults{ErrorRate: 0.5})
+
+		var failed int
+
+		for i := 0; i < 100; i++ {
+			if res, _ = get(s, Agify, "name=a"); res.StatusCode == http.StatusInternalServerError {
+				failed++
+			}
+		}
+
+		assert.InDelta(t, 50, failed, 20)
+	})
+
+	t.Run("error_latency", func(t *testing.T) {
+		s, err := New(WithFaults(Nationalize, Faults{Latency: time.Second * 10}))
+		require.NoError(t, err)
+
+		server := httptest.NewServer(s.Handler(Nationalize))
+		defer server.Close()
+
+		client := http.Client{Timeout: time.Millisecond * 50}
+
+		_, err = client.Get(server.URL + "?name=a")
+		assert.Error(t, err)
+	})
+}
+
+func TestLoadSeed(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		entries, err := LoadSeed(strings.NewReader(`[{"name":"Helen","gender":"female","probability":0.9,"count":3}]`))
+		require.NoError(t, err)
+
+		if assert.Len(t, entries, 1) {
+			assert.Equal(t, "female", *entries[0].Gender)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		entries, err := LoadSeed(strings.NewReader(`{"name":"Helen"}`))
+		assert.Nil(t, entries)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,44 @@
+package fakeapitest
+
+import (
+	"namer/internal/fakeapi"
+	"net/http/httptest"
+	"testing"
+)
+
+// Server runs the fake APIs in process, each on a host of its own like the real ones.
+type Server struct {
+	*fakeapi.Server
+
+	AgifyURL       string
+	GenderizeURL   string
+	NationalizeURL string
+}
+
+// NewServer starts the fake APIs, they are closed when the test finishes.
+func NewServer(tb testing.TB, opts ...fakeapi.Option) *Server {
+	tb.Helper()
+
+	fake, err := fakeapi.New(opts...)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	s := &Server{Server: fake}
+
+	for _, api := range []struct {
+		name string
+		url  *string
+	}{
+		{fakeapi.Agify, &s.AgifyURL},
+		{fakeapi.Genderize, &s.GenderizeURL},
+		{fakeapi.Nationalize, &s.NationalizeURL},
+	} {
+		server := httptest.NewServer(fake.Handler(api.name))
+		tb.Cleanup(server.Close)
+
+		*api.url = server.URL
+	}
+
+	return s
+}
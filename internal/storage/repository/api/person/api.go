@@ -1,149 +1,357 @@
 package person
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 	"io"
 	"namer/internal/domain/external"
+	"namer/pkg/utils"
 	"net/http"
+	"net/url"
+	"sync"
 	"time"
 )
 
+const (
+	defaultAgeURL    = "https://api.agify.io/"
+	defaultGenderURL = "https://api.genderize.io/"
+	defaultNationURL = "https://api.nationalize.io/"
+)
+
+// The names the three services are registered under.
+const (
+	ProviderAgify       = "agify"
+	ProviderGenderize   = "genderize"
+	ProviderNationalize = "nationalize"
+)
+
+// maxBatchSize is the number of names the providers accept in a single request.
+const maxBatchSize = 10
+
 type APIRepository struct {
 	client    *http.Client
 	ageURL    string
 	genderURL string
 	nationURL string
+	userAgent string
+	apiKey    string
+
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	sleep       func(ctx context.Context, delay time.Duration) error
+
+	breakerThreshold int
+	breakerCooldown  time.Duration
+	breakersMu       sync.Mutex
+	breakers         map[string]*breaker
 }
 
-func NewRepository() *APIRepository {
-	return &APIRepository{
-		client: &http.Client{
-			Timeout: time.Second * 15,
-		},
-		ageURL:    "https://api.agify.io/?name=%s",
-		genderURL: "https://api.genderize.io/?name=%s",
-		nationURL: "https://api.nationalize.io/?name=%s",
+type Option func(a *APIRepository)
+
+// WithClient sets the client the providers are queried with, its Transport decides about proxies.
+func WithClient(client *http.Client) Option {
+	return func(a *APIRepository) {
+		a.client = client
 	}
 }
 
-func (a *APIRepository) GetNameInfo(name string) (*external.ExternalResponse, error) {
-	var (
-		res external.ExternalResponse
-		err error
-	)
+// WithBaseURLs points the repository at other agify, genderize and nationalize
+// compatible services, an empty URL keeps the default.
+func WithBaseURLs(ageURL, genderURL, nationURL string) Option {
+	return func(a *APIRepository) {
+		for _, u := range []struct {
+			dst   *string
+			value string
+		}{
+			{&a.ageURL, ageURL},
+			{&a.genderURL, genderURL},
+			{&a.nationURL, nationURL},
+		} {
+			if u.value != "" {
+				*u.dst = u.value
+			}
+		}
+	}
+}
 
-	if res.Agify, err = a.GetAge(name); err != nil {
-		return nil, errors.Wrap(err, "GetNameInfo #1")
+func WithUserAgent(userAgent string) Option {
+	return func(a *APIRepository) {
+		a.userAgent = userAgent
 	}
+}
 
-	if res.Agify.Error != nil {
-		res.Error, res.StatusCode = res.Agify.Error, res.Agify.StatusCode
+// WithAPIKey sets the key of a paid subscription, it is sent as the apikey query parameter.
+func WithAPIKey(apiKey string) Option {
+	return func(a *APIRepository) {
+		a.apiKey = apiKey
+	}
+}
 
-		return &res, nil
+func NewRepository(opts ...Option) *APIRepository {
+	a := &APIRepository{
+		client: &http.Client{
+			Timeout: time.Second * 15,
+		},
+		ageURL:      defaultAgeURL,
+		genderURL:   defaultGenderURL,
+		nationURL:   defaultNationURL,
+		maxAttempts: defaultMaxAttempts,
+		baseDelay:   defaultBaseDelay,
+		maxDelay:    defaultMaxDelay,
+		sleep:       sleep,
+
+		breakerThreshold: defaultBreakerThreshold,
+		breakerCooldown:  defaultBreakerCooldown,
+		breakers:         make(map[string]*breaker),
 	}
 
-	if res.Genderize, err = a.GetGender(name); err != nil {
-		return nil, errors.Wrap(err, "GetNameInfo #2")
+	for _, opt := range opts {
+		opt(a)
 	}
 
-	if res.Genderize.Error != nil {
-		res.Error, res.StatusCode = res.Genderize.Error, res.Genderize.StatusCode
+	return a
+}
 
-		return &res, nil
+// Providers returns the agify, genderize and nationalize compatible services as providers
+// to register, in this order.
+func (a *APIRepository) Providers() []EnrichmentProvider {
+	return []EnrichmentProvider{
+		NewProvider(ProviderAgify, []Attribute{AttributeAge}, a.lookup(ProviderAgify, a.ageURL, AttributeAge)),
+		NewProvider(ProviderGenderize, []Attribute{AttributeGender}, a.lookup(ProviderGenderize, a.genderURL, AttributeGender)),
+		NewProvider(ProviderNationalize, []Attribute{AttributeNation}, a.lookup(ProviderNationalize, a.nationURL, AttributeNation)),
 	}
+}
 
-	if res.Nationalize, err = a.GetNation(name); err != nil {
-		return nil, errors.Wrap(err, "GetNameInfo #3")
-	}
+// lookup queries the provider at baseURL with one request for every maxBatchSize names. The
+// nation lookup goes without the country hint.
+func (a *APIRepository) lookup(provider, baseURL string, attribute Attribute) LookupFunc {
+	return func(ctx context.Context, names []string, country string) ([]*external.ExternalResponse, error) {
+		if attribute == AttributeNation {
+			country = ""
+		}
 
-	if res.Nationalize.Error != nil {
-		res.Error, res.StatusCode = res.Nationalize.Error, res.Nationalize.StatusCode
+		res := make([]*external.ExternalResponse, 0, len(names))
 
-		return &res, nil
-	}
+		for start := 0; start < len(names); start += maxBatchSize {
+			batch, err := a.lookupBatch(ctx, provider, baseURL, attribute, names[start:min(start+maxBatchSize, len(names))], country)
+			if err != nil {
+				return nil, errors.Wrap(err, "lookup #1")
+			}
 
-	return &res, nil
+			res = append(res, batch...)
+		}
+
+		return res, nil
+	}
 }
 
-func (a *APIRepository) GetAge(name string) (*external.AgifyResponse, error) {
-	res, err := http.Get(
-		fmt.Sprintf(a.ageURL, name),
+// lookupBatch queries the service about at most maxBatchSize names, the batches of a lookup
+// share the deadline of the registry.
+func (a *APIRepository) lookupBatch(ctx context.Context, provider, baseURL string, attribute Attribute, names []string, country string) ([]*external.ExternalResponse, error) {
+	var (
+		agify       []external.AgifyResponse
+		genderize   []external.GenderizeResponse
+		nationalize []external.NationalizeResponse
+		dst         any
 	)
 
+	switch attribute {
+	case AttributeAge:
+		dst = &agify
+	case AttributeGender:
+		dst = &genderize
+	default:
+		dst = &nationalize
+	}
+
+	statusCode, providerErr, err := a.getMany(ctx, provider, baseURL, names, country, dst)
 	if err != nil {
-		return nil, errors.Wrap(err, "GetAge #1")
+		return nil, errors.Wrap(err, "lookupBatch #1")
 	}
 
-	defer res.Body.Close()
+	res := make([]*external.ExternalResponse, len(names))
 
-	body, err := io.ReadAll(res.Body)
+	if providerErr != nil {
+		for i := range res {
+			res[i] = &external.ExternalResponse{
+				Error:      providerErr,
+				StatusCode: statusCode,
+			}
+		}
+
+		return res, nil
+	}
+
+	if len(agify)+len(genderize)+len(nationalize) != len(names) {
+		return nil, errors.Wrap(errors.New("unexpected number of results"), "lookupBatch #2")
+	}
+
+	for i := range res {
+		res[i] = &external.ExternalResponse{}
+
+		switch attribute {
+		case AttributeAge:
+			agify[i].StatusCode = http.StatusOK
+			res[i].Agify = &agify[i]
+		case AttributeGender:
+			genderize[i].StatusCode = http.StatusOK
+			res[i].Genderize = &genderize[i]
+		default:
+			nationalize[i].StatusCode = http.StatusOK
+			res[i].Nationalize = &nationalize[i]
+		}
+	}
+
+	return res, nil
+}
+
+// getMany queries the provider at baseURL about several names and decodes the JSON array
+// into dst. A provider error is returned as a message, the body is then an error object.
+func (a *APIRepository) getMany(ctx context.Context, provider, baseURL string, names []string, country string, dst any) (int, *string, error) {
+	statusCode, body, err := a.do(ctx, provider, baseURL, url.Values{"name[]": names}, country)
 	if err != nil {
-		return nil, errors.Wrap(err, "GetAge #2")
+		return 0, nil, errors.Wrap(err, "getMany #1")
 	}
 
-	var agify external.AgifyResponse
+	if statusCode != http.StatusOK {
+		var failure struct {
+			Error *string `json:"error"`
+		}
 
-	if err = json.Unmarshal(body, &agify); err != nil {
-		return nil, errors.Wrap(err, "GetAge #3")
+		if err = json.Unmarshal(body, &failure); err != nil || failure.Error == nil {
+			failure.Error = utils.StringToPtr(http.StatusText(statusCode))
+		}
+
+		return statusCode, failure.Error, nil
 	}
 
-	agify.StatusCode = res.StatusCode
+	if err = json.Unmarshal(body, dst); err != nil {
+		return 0, nil, errors.Wrap(err, "getMany #2")
+	}
 
-	return &agify, nil
+	return statusCode, nil, nil
 }
 
-func (a *APIRepository) GetGender(name string) (*external.GenderizeResponse, error) {
-	res, err := http.Get(
-		fmt.Sprintf(a.genderURL, name),
-	)
-
+// do sends the request with the name parameters, the optional country hint and the API key
+// through the breaker of the provider and returns the status code with the whole body.
+func (a *APIRepository) do(ctx context.Context, provider, baseURL string, params url.Values, country string) (int, []byte, error) {
+	u, err := url.Parse(baseURL)
 	if err != nil {
-		return nil, errors.Wrap(err, "GetGender #1")
+		return 0, nil, errors.Wrap(err, "do #1")
 	}
 
-	defer res.Body.Close()
+	query := u.Query()
 
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		return nil, errors.Wrap(err, "GetGender #2")
+	for key, values := range params {
+		query[key] = values
 	}
 
-	var genderize external.GenderizeResponse
+	if country != "" {
+		query.Set("country_id", country)
+	}
 
-	if err = json.Unmarshal(body, &genderize); err != nil {
-		return nil, errors.Wrap(err, "GetGender #3")
+	if a.apiKey != "" {
+		query.Set("apikey", a.apiKey)
 	}
 
-	genderize.StatusCode = res.StatusCode
+	u.RawQuery = query.Encode()
 
-	return &genderize, nil
-}
+	b := a.breaker(provider)
 
-func (a *APIRepository) GetNation(name string) (*external.NationalizeResponse, error) {
-	res, err := http.Get(
-		fmt.Sprintf(a.nationURL, name),
-	)
+	ok, probe := b.allow()
+	if !ok {
+		return 0, nil, errors.Wrap(external.ErrProviderUnavailable, "do #2")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		b.done(probe, outcomeIgnored)
+
+		return 0, nil, errors.Wrap(err, "do #3")
+	}
+
+	if a.userAgent != "" {
+		req.Header.Set("User-Agent", a.userAgent)
+	}
+
+	res, err := a.send(ctx, req)
+
+	// a canceled lookup was given up by the caller, a missed deadline means a slow provider
+	switch {
+	case errors.Is(ctx.Err(), context.Canceled):
+		b.done(probe, outcomeIgnored)
+	case err != nil || retryReason(res, nil) != "":
+		b.done(probe, outcomeFailure)
+	default:
+		b.done(probe, outcomeSuccess)
+	}
 
 	if err != nil {
-		return nil, errors.Wrap(err, "GetNation #1")
+		return 0, nil, errors.Wrap(redact(err, u), "do #4")
 	}
 
 	defer res.Body.Close()
 
 	body, err := io.ReadAll(res.Body)
 	if err != nil {
-		return nil, errors.Wrap(err, "GetNation #2")
+		return 0, nil, errors.Wrap(err, "do #5")
 	}
 
-	var nationalize external.NationalizeResponse
+	return res.StatusCode, body, nil
+}
+
+// send sends the request until it succeeds, fails for good or runs out of attempts. The
+// lookups are idempotent GETs, so transient failures are simply sent again.
+func (a *APIRepository) send(ctx context.Context, req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		res, err := a.client.Do(req)
+
+		reason := retryReason(res, err)
+		if reason == "" || ctx.Err() != nil {
+			return res, err
+		}
+
+		delay := a.backoff(attempt, res)
 
-	if err = json.Unmarshal(body, &nationalize); err != nil {
-		return nil, errors.Wrap(err, "GetNation #3")
+		if attempt >= a.maxAttempts || !a.canWait(ctx, delay) {
+			retryStats.Add("gave_up", 1)
+
+			return res, err
+		}
+
+		retryStats.Add(reason, 1)
+
+		log.WithFields(log.Fields{
+			"host":    req.URL.Host,
+			"attempt": attempt,
+			"reason":  reason,
+			"delay":   delay,
+		}).Warn("retrying name provider request")
+
+		if res != nil {
+			_, _ = io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		if err = a.sleep(ctx, delay); err != nil {
+			return nil, errors.Wrap(err, "send #1")
+		}
 	}
+}
+
+// redact leaves the query, which holds the API key, out of the URL of a transport error.
+func redact(err error, u *url.URL) error {
+	var urlErr *url.Error
 
-	nationalize.StatusCode = res.StatusCode
+	if errors.As(err, &urlErr) {
+		redacted := *u
+		redacted.RawQuery = ""
+
+		urlErr.URL = redacted.String()
+	}
 
-	return &nationalize, nil
+	return err
 }
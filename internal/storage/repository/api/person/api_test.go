@@ -1,15 +1,252 @@
 package person
 
 import (
+	"context"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"namer/internal/domain/external"
+	"namer/internal/fakeapi"
+	"namer/internal/fakeapi/fakeapitest"
+	"namer/pkg/httpreplay"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
+// newTestRepository points the repository at local servers, one per provider.
+func newTestRepository(t *testing.T, age, gender, nation http.HandlerFunc, opts ...Option) *APIRepository {
+	urls := make([]string, 3)
+
+	for i, handler := range []http.HandlerFunc{age, gender, nation} {
+		server := httptest.NewServer(handler)
+		t.Cleanup(server.Close)
+
+		urls[i] = server.URL
+	}
+
+	return NewRepository(append([]Option{WithBaseURLs(urls[0], urls[1], urls[2])}, opts...)...)
+}
+
+// newFakeRepository points the repository at the fake APIs.
+func newFakeRepository(t *testing.T, opts ...fakeapi.Option) *APIRepository {
+	fake := fakeapitest.NewServer(t, opts...)
+
+	return NewRepository(WithBaseURLs(fake.AgifyURL, fake.GenderizeURL, fake.NationalizeURL))
+}
+
+// newReplayRepository answers the requests with the exchanges recorded in the fixture,
+// HTTPREPLAY_RECORD=1 records them again with the real APIs.
+func newReplayRepository(t *testing.T, fixture string) *APIRepository {
+	transport := httpreplay.NewTest(t, filepath.Join("testdata", fixture), "apikey")
+
+	return NewRepository(WithClient(&http.Client{Transport: transport}))
+}
+
+func respond(status int, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}
+}
+
+// blockUntilCanceled holds the request until the client gives up on it.
+func blockUntilCanceled(canceled chan<- struct{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(canceled)
+	}
+}
+
+// newTestRegistry looks names up with the providers of the repository, as the app does.
+func newTestRegistry(t *testing.T, repo *APIRepository) *Registry {
+	registry, err := NewRegistry(time.Second*5, repo.Providers()...)
+	require.NoError(t, err)
+
+	return registry
+}
+
+// lookupOne asks the provider about a single name.
+func lookupOne(ctx context.Context, provider EnrichmentProvider, name string) (*external.ExternalResponse, error) {
+	res, err := provider.Lookup(ctx, []string{name}, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return res[0], nil
+}
+
+func TestGetNameInfoLocal(t *testing.T) {
+	agify := respond(http.StatusOK, `[{"count":1,"name":"Helen","age":40}]`)
+	genderize := respond(http.StatusOK, `[{"count":1,"name":"Helen","gender":"female","probability":0.98}]`)
+	nationalize := respond(http.StatusOK, `[{"count":1,"name":"Helen","country":[{"country_id":"GB","probability":0.1}]}]`)
+	limited := respond(http.StatusTooManyRequests, `{"error":"Request limit reached"}`)
+
+	t.Run("success", func(t *testing.T) {
+		registry := newTestRegistry(t, newTestRepository(t, agify, genderize, nationalize))
+
+		resp, err := registry.GetNameInfo(context.Background(), "Helen", "")
+		require.NoError(t, err)
+
+		assert.Nil(t, resp.Error)
+		assert.Equal(t, 40, *resp.Agify.Age)
+		assert.Equal(t, "female", *resp.Genderize.Gender)
+		assert.Equal(t, "GB", resp.Nationalize.Country[0].CountryId)
+	})
+
+	t.Run("success_options", func(t *testing.T) {
+		check := func(next http.HandlerFunc) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "namer-test", r.UserAgent())
+				assert.Equal(t, "secret", r.URL.Query().Get("apikey"))
+				assert.Equal(t, []string{"Anna Maria"}, r.URL.Query()["name[]"])
+
+				next(w, r)
+			}
+		}
+
+		withCountry := func(next http.HandlerFunc) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "GB", r.URL.Query().Get("country_id"))
+
+				check(next)(w, r)
+			}
+		}
+
+		repo := newTestRepository(t, withCountry(agify), withCountry(genderize), check(nationalize), WithUserAgent("namer-test"), WithAPIKey("secret"))
+
+		_, err := newTestRegistry(t, repo).GetNameInfo(context.Background(), "Anna Maria", "GB")
+		require.NoError(t, err)
+	})
+
+	t.Run("success_concurrent", func(t *testing.T) {
+		var arrived sync.WaitGroup
+
+		arrived.Add(3)
+
+		// every provider answers only once all three requests are in flight
+		barrier := func(next http.HandlerFunc) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				arrived.Done()
+				arrived.Wait()
+				next(w, r)
+			}
+		}
+
+		repo := newTestRepository(t, barrier(agify), barrier(genderize), barrier(nationalize))
+
+		resp, err := newTestRegistry(t, repo).GetNameInfo(context.Background(), "Helen", "")
+		require.NoError(t, err)
+		assert.Nil(t, resp.Error)
+	})
+
+	t.Run("error_first_provider_wins", func(t *testing.T) {
+		slowLimited := func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(time.Millisecond * 50)
+			limited(w, r)
+		}
+
+		registry := newTestRegistry(t, newTestRepository(t, slowLimited, respond(http.StatusUnprocessableEntity, `{"error":"Invalid name"}`), nationalize))
+
+		resp, err := registry.GetNameInfo(context.Background(), "Helen", "")
+		require.NoError(t, err)
+
+		if assert.NotNil(t, resp.Error) {
+			assert.Equal(t, "Request limit reached", *resp.Error)
+			assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		}
+	})
+
+	t.Run("error_provider", func(t *testing.T) {
+		registry := newTestRegistry(t, newTestRepository(t, agify, genderize, limited))
+
+		resp, err := registry.GetNameInfo(context.Background(), "Helen", "")
+		require.NoError(t, err)
+
+		if assert.NotNil(t, resp.Error) {
+			assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		}
+
+		assert.NotNil(t, resp.Agify)
+		assert.NotNil(t, resp.Genderize)
+	})
+
+	t.Run("error_deadline", func(t *testing.T) {
+		canceled := make(chan struct{})
+
+		registry, err := NewRegistry(time.Millisecond*50, newTestRepository(t, agify, blockUntilCanceled(canceled), nationalize).Providers()...)
+		require.NoError(t, err)
+
+		resp, err := registry.GetNameInfo(context.Background(), "Helen", "")
+		assert.Nil(t, resp)
+
+		if assert.Error(t, err) {
+			assert.ErrorIs(t, err, context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("error_canceled", func(t *testing.T) {
+		canceled := make(chan struct{})
+
+		registry := newTestRegistry(t, newTestRepository(t, blockUntilCanceled(canceled), genderize, nationalize))
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		time.AfterFunc(time.Millisecond*50, cancel)
+
+		resp, err := registry.GetNameInfo(ctx, "Helen", "")
+		assert.Nil(t, resp)
+
+		if assert.Error(t, err) {
+			assert.ErrorIs(t, err, context.Canceled)
+		}
+
+		<-canceled
+	})
+
+	t.Run("error_transport", func(t *testing.T) {
+		repo := newTestRepository(t, agify, genderize, nationalize, WithAPIKey("SECRETKEY"))
+
+		server := httptest.NewServer(agify)
+		server.Close()
+
+		repo.ageURL = server.URL
+
+		resp, err := newTestRegistry(t, repo).GetNameInfo(context.Background(), "Helen", "")
+		assert.Nil(t, resp)
+
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), server.URL)
+			assert.NotContains(t, err.Error(), "SECRETKEY")
+		}
+	})
+}
+
+// respondBatch answers a multi-name query with one object per name, in the order asked.
+func respondBatch(requests *atomic.Int32, object func(name string) string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+
+		names := r.URL.Query()["name[]"]
+		objects := make([]string, len(names))
+
+		for i, name := range names {
+			objects[i] = object(name)
+		}
+
+		fmt.Fprint(w, "["+strings.Join(objects, ",")+"]")
+	}
+}
+
 func TestGetNameInfo(t *testing.T) {
-	repo := NewRepository()
+	registry := newTestRegistry(t, newFakeRepository(t))
 
-	resp, err := repo.GetNameInfo("Helen")
+	resp, err := registry.GetNameInfo(context.Background(), "Helen", "")
 
 	require.NoError(t, err)
 	require.NotNil(t, resp)
@@ -40,54 +277,124 @@ func TestGetNameInfo(t *testing.T) {
 	}
 }
 
-func TestGetAge(t *testing.T) {
-	repo := NewRepository()
+func TestGetNamesInfo(t *testing.T) {
+	registry := newTestRegistry(t, newFakeRepository(t))
 
-	resp, err := repo.GetAge("Helen")
+	res, err := registry.GetNamesInfo(context.Background(), []string{"Helen", "Anna"}, "")
 
 	require.NoError(t, err)
-	require.NotNil(t, resp)
+	require.Len(t, res, 2)
 
-	if assert.NotNil(t, resp) {
-		assert.NotNil(t, resp.Count)
-		assert.NotNil(t, resp.Name)
-		assert.NotNil(t, resp.Age)
+	for _, name := range []string{"Helen", "Anna"} {
+		if assert.NotNil(t, res[name]) {
+			assert.Equal(t, name, *res[name].Agify.Name)
+			assert.Equal(t, name, *res[name].Genderize.Name)
+			assert.Equal(t, name, *res[name].Nationalize.Name)
+		}
+	}
+}
 
-		assert.NotEqual(t, resp.StatusCode, 0)
+func TestGetNameInfoRateLimited(t *testing.T) {
+	registry := newTestRegistry(t, newFakeRepository(t, fakeapi.WithFaults(fakeapi.Genderize, fakeapi.Faults{RateLimit: 1})))
+
+	_, err := registry.GetNameInfo(context.Background(), "Helen", "")
+	require.NoError(t, err)
+
+	// the quota is reset later than the retries are willing to wait
+	resp, err := registry.GetNameInfo(context.Background(), "Helen", "")
+	require.NoError(t, err)
+
+	if assert.NotNil(t, resp.Error) {
+		assert.Equal(t, "Request limit reached", *resp.Error)
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
 	}
 }
 
-func TestGetGender(t *testing.T) {
-	repo := NewRepository()
+func TestGetNameInfoReplay(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		registry := newTestRegistry(t, newReplayRepository(t, "get_name_info.json"))
+
+		resp, err := registry.GetNameInfo(context.Background(), "Helen", "")
+		require.NoError(t, err)
+
+		assert.Nil(t, resp.Error)
+		assert.Equal(t, 60, *resp.Agify.Age)
+		assert.Equal(t, 287812, *resp.Agify.Count)
+		assert.Equal(t, "Helen", *resp.Agify.Name)
+		assert.Equal(t, "female", *resp.Genderize.Gender)
+		assert.Equal(t, 0.98, *resp.Genderize.Probability)
+		assert.Equal(t, http.StatusOK, resp.Nationalize.StatusCode)
+
+		if assert.Len(t, resp.Nationalize.Country, 3) {
+			assert.Equal(t, "GB", resp.Nationalize.Country[0].CountryId)
+			assert.Equal(t, 0.12, resp.Nationalize.Country[0].Probability)
+		}
+	})
+
+	t.Run("success_country", func(t *testing.T) {
+		registry := newTestRegistry(t, newReplayRepository(t, "get_name_info_country.json"))
+
+		resp, err := registry.GetNameInfo(context.Background(), "Helen", "GB")
+		require.NoError(t, err)
+
+		assert.Equal(t, 58, *resp.Agify.Age)
+		assert.Equal(t, 0.99, *resp.Genderize.Probability)
+		assert.Equal(t, "GB", resp.Nationalize.Country[0].CountryId)
+	})
+}
+
+func TestGetNamesInfoReplay(t *testing.T) {
+	registry := newTestRegistry(t, newReplayRepository(t, "get_names_info.json"))
+
+	res, err := registry.GetNamesInfo(context.Background(), []string{"Helen", "Anna", "Zyxw"}, "")
+	require.NoError(t, err)
+	require.Len(t, res, 3)
+
+	assert.Equal(t, 60, *res["Helen"].Agify.Age)
+	assert.Equal(t, 48, *res["Anna"].Agify.Age)
+	assert.Equal(t, "PL", res["Anna"].Nationalize.Country[0].CountryId)
+
+	// an unknown name has a count of 0 and no values
+	assert.Equal(t, 0, *res["Zyxw"].Agify.Count)
+	assert.Nil(t, res["Zyxw"].Agify.Age)
+	assert.Nil(t, res["Zyxw"].Genderize.Gender)
+	assert.Empty(t, res["Zyxw"].Nationalize.Country)
+}
 
-	resp, err := repo.GetGender("Helen")
+func TestProviders(t *testing.T) {
+	providers := newFakeRepository(t).Providers()
 
+	age, err := lookupOne(context.Background(), providers[0], "Helen")
 	require.NoError(t, err)
-	require.NotNil(t, resp)
 
-	if assert.NotNil(t, resp) {
-		assert.NotNil(t, resp.Name)
-		assert.NotNil(t, resp.Count)
-		assert.NotNil(t, resp.Probability)
-		assert.NotNil(t, resp.Gender)
+	if assert.NotNil(t, age.Agify) {
+		assert.NotNil(t, age.Agify.Count)
+		assert.NotNil(t, age.Agify.Name)
+		assert.NotNil(t, age.Agify.Age)
 
-		assert.NotEqual(t, resp.StatusCode, 0)
+		assert.Equal(t, http.StatusOK, age.Agify.StatusCode)
 	}
-}
 
-func TestGetNation(t *testing.T) {
-	repo := NewRepository()
+	gender, err := lookupOne(context.Background(), providers[1], "Helen")
+	require.NoError(t, err)
+
+	if assert.NotNil(t, gender.Genderize) {
+		assert.NotNil(t, gender.Genderize.Name)
+		assert.NotNil(t, gender.Genderize.Count)
+		assert.NotNil(t, gender.Genderize.Probability)
+		assert.NotNil(t, gender.Genderize.Gender)
 
-	resp, err := repo.GetNation("Helen")
+		assert.Equal(t, http.StatusOK, gender.Genderize.StatusCode)
+	}
 
+	nation, err := lookupOne(context.Background(), providers[2], "Helen")
 	require.NoError(t, err)
-	require.NotNil(t, resp)
 
-	if assert.NotNil(t, resp) {
-		assert.NotNil(t, resp.Name)
-		assert.NotNil(t, resp.Count)
-		assert.NotNil(t, resp.Country)
+	if assert.NotNil(t, nation.Nationalize) {
+		assert.NotNil(t, nation.Nationalize.Name)
+		assert.NotNil(t, nation.Nationalize.Count)
+		assert.NotNil(t, nation.Nationalize.Country)
 
-		assert.NotEqual(t, resp.StatusCode, 0)
+		assert.Equal(t, http.StatusOK, nation.Nationalize.StatusCode)
 	}
 }
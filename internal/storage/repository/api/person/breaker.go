@@ -0,0 +1,140 @@
+package person
+
+import (
+	"expvar"
+	log "github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = time.Second * 30
+)
+
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half_open"
+)
+
+// breakerStates is published on /debug/vars, it holds the state of every provider's breaker.
+var breakerStates = expvar.NewMap("enrichment_circuit")
+
+type outcome int
+
+const (
+	outcomeSuccess outcome = iota
+	outcomeFailure
+	// outcomeIgnored is a request the caller gave up on, it tells nothing about the provider.
+	outcomeIgnored
+)
+
+// WithCircuitBreaker stops querying a provider after threshold consecutive failed requests.
+// After cooldown a single probe request is let through, its success closes the breaker again.
+// A threshold below 1 disables the breaker.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return func(a *APIRepository) {
+		a.breakerThreshold, a.breakerCooldown = threshold, cooldown
+	}
+}
+
+type breaker struct {
+	mu        sync.Mutex
+	provider  string
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	now       func() time.Time
+}
+
+// breaker returns the breaker of the provider, creating it on first use. The providers may
+// share a host, so they are told apart by name.
+func (a *APIRepository) breaker(provider string) *breaker {
+	a.breakersMu.Lock()
+	defer a.breakersMu.Unlock()
+
+	if b, ok := a.breakers[provider]; ok {
+		return b
+	}
+
+	b := &breaker{
+		provider:  provider,
+		threshold: a.breakerThreshold,
+		cooldown:  a.breakerCooldown,
+		now:       time.Now,
+	}
+
+	a.breakers[provider] = b
+
+	breakerStates.Set(provider, expvar.Func(func() any {
+		return b.state()
+	}))
+
+	return b
+}
+
+// allow tells whether a request may be sent and whether it is the probe of a half open breaker.
+func (b *breaker) allow() (ok, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.threshold < 1 || b.failures < b.threshold {
+		return true, false
+	}
+
+	if b.probing || b.now().Sub(b.openedAt) < b.cooldown {
+		return false, false
+	}
+
+	b.probing = true
+
+	return true, true
+}
+
+// done records the outcome of a request, only the probe frees the probe slot again.
+func (b *breaker) done(probe bool, o outcome) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.threshold < 1 {
+		return
+	}
+
+	if probe {
+		b.probing = false
+	}
+
+	switch o {
+	case outcomeSuccess:
+		if b.failures >= b.threshold {
+			log.WithField("provider", b.provider).Info("name provider circuit breaker closed")
+		}
+
+		b.failures = 0
+	case outcomeFailure:
+		if b.failures++; b.failures >= b.threshold {
+			if b.failures == b.threshold {
+				log.WithField("provider", b.provider).Warn("name provider circuit breaker opened")
+			}
+
+			b.openedAt = b.now()
+		}
+	}
+}
+
+func (b *breaker) state() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case b.threshold < 1 || b.failures < b.threshold:
+		return breakerClosed
+	case b.probing || b.now().Sub(b.openedAt) >= b.cooldown:
+		return breakerHalfOpen
+	default:
+		return breakerOpen
+	}
+}
@@ -0,0 +1,203 @@
+package person
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"namer/internal/domain/external"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+
+	newBreaker := func() *breaker {
+		return &breaker{
+			threshold: 2,
+			cooldown:  time.Minute,
+			now: func() time.Time {
+				return now
+			},
+		}
+	}
+
+	allowed := func(b *breaker) bool {
+		ok, _ := b.allow()
+
+		return ok
+	}
+
+	t.Run("success_opens_after_threshold", func(t *testing.T) {
+		b := newBreaker()
+
+		for i := 0; i < 2; i++ {
+			ok, probe := b.allow()
+			assert.True(t, ok)
+			assert.False(t, probe)
+
+			b.done(probe, outcomeFailure)
+		}
+
+		assert.Equal(t, breakerOpen, b.state())
+		assert.False(t, allowed(b))
+	})
+
+	t.Run("success_resets_on_success", func(t *testing.T) {
+		b := newBreaker()
+
+		b.done(false, outcomeFailure)
+		b.done(false, outcomeSuccess)
+		b.done(false, outcomeFailure)
+
+		assert.Equal(t, breakerClosed, b.state())
+		assert.True(t, allowed(b))
+	})
+
+	t.Run("success_single_probe_after_cooldown", func(t *testing.T) {
+		b := newBreaker()
+
+		b.done(false, outcomeFailure)
+		b.done(false, outcomeFailure)
+
+		b.now = func() time.Time {
+			return now.Add(time.Minute)
+		}
+
+		assert.Equal(t, breakerHalfOpen, b.state())
+
+		ok, probe := b.allow()
+		assert.True(t, ok)
+		assert.True(t, probe)
+		assert.False(t, allowed(b))
+
+		b.done(probe, outcomeSuccess)
+
+		assert.Equal(t, breakerClosed, b.state())
+		assert.True(t, allowed(b))
+	})
+
+	t.Run("success_failed_probe_reopens", func(t *testing.T) {
+		b := newBreaker()
+
+		b.done(false, outcomeFailure)
+		b.done(false, outcomeFailure)
+
+		b.now = func() time.Time {
+			return now.Add(time.Minute)
+		}
+
+		_, probe := b.allow()
+
+		b.done(probe, outcomeFailure)
+
+		assert.Equal(t, breakerOpen, b.state())
+		assert.False(t, allowed(b))
+	})
+
+	t.Run("success_ignored_probe_frees_slot", func(t *testing.T) {
+		b := newBreaker()
+
+		b.done(false, outcomeFailure)
+		b.done(false, outcomeFailure)
+
+		b.now = func() time.Time {
+			return now.Add(time.Minute)
+		}
+
+		_, probe := b.allow()
+
+		b.done(probe, outcomeIgnored)
+
+		assert.True(t, allowed(b))
+	})
+
+	t.Run("success_late_request_keeps_probe", func(t *testing.T) {
+		b := newBreaker()
+
+		// let through before the breaker opened, it completes while the probe is in flight
+		_, late := b.allow()
+
+		b.done(false, outcomeFailure)
+		b.done(false, outcomeFailure)
+
+		b.now = func() time.Time {
+			return now.Add(time.Minute)
+		}
+
+		ok, probe := b.allow()
+		assert.True(t, ok)
+		assert.True(t, probe)
+
+		b.done(late, outcomeIgnored)
+
+		assert.Equal(t, breakerHalfOpen, b.state())
+		assert.False(t, allowed(b))
+	})
+
+	t.Run("success_disabled", func(t *testing.T) {
+		b := newBreaker()
+		b.threshold = 0
+
+		for i := 0; i < 5; i++ {
+			b.done(false, outcomeFailure)
+		}
+
+		assert.Equal(t, breakerClosed, b.state())
+		assert.True(t, allowed(b))
+	})
+}
+
+func TestCircuitBreakerLocal(t *testing.T) {
+	var requests atomic.Int32
+
+	unavailable := sequence(&requests, respond(http.StatusServiceUnavailable, `{"error":"Service unavailable"}`))
+	agify := respond(http.StatusOK, `[{"count":1,"name":"Helen","age":40}]`)
+
+	repo := newTestRepository(t, unavailable, agify, agify, WithRetry(1, 0, 0), WithCircuitBreaker(2, time.Minute))
+
+	for i := 0; i < 2; i++ {
+		resp, err := lookupOne(context.Background(), repo.Providers()[0], "Helen")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	}
+
+	resp, err := lookupOne(context.Background(), repo.Providers()[0], "Helen")
+	assert.Nil(t, resp)
+
+	if assert.Error(t, err) {
+		assert.ErrorIs(t, err, external.ErrProviderUnavailable)
+	}
+
+	assert.Equal(t, int32(2), requests.Load())
+
+	// the other providers have breakers of their own
+	gender, err := lookupOne(context.Background(), repo.Providers()[1], "Helen")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, gender.Genderize.StatusCode)
+}
+
+func TestCircuitBreakerSharedHost(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/agify/", respond(http.StatusServiceUnavailable, `{"error":"Service unavailable"}`))
+	mux.HandleFunc("/genderize/", respond(http.StatusOK, `[{"count":1,"name":"Helen","gender":"female","probability":0.98}]`))
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	repo := NewRepository(WithBaseURLs(server.URL+"/agify/", server.URL+"/genderize/", ""), WithRetry(1, 0, 0), WithCircuitBreaker(1, time.Minute))
+
+	_, err := lookupOne(context.Background(), repo.Providers()[0], "Helen")
+	require.NoError(t, err)
+
+	_, err = lookupOne(context.Background(), repo.Providers()[0], "Helen")
+	assert.ErrorIs(t, err, external.ErrProviderUnavailable)
+
+	// a provider on the same host keeps its own breaker
+	gender, err := lookupOne(context.Background(), repo.Providers()[1], "Helen")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, gender.Genderize.StatusCode)
+}
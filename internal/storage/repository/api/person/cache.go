@@ -0,0 +1,180 @@
+package person
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"namer/internal/domain/external"
+	"namer/pkg/lru"
+	"strings"
+	"time"
+)
+
+// cacheStats is published on /debug/vars.
+var cacheStats = expvar.NewMap("enrichment_cache")
+
+type NameInfoRepository interface {
+	GetNameInfo(ctx context.Context, name, country string) (*external.ExternalResponse, error)
+	GetNamesInfo(ctx context.Context, names []string, country string) (map[string]*external.ExternalResponse, error)
+}
+
+// CacheStore is the second, persistent cache level. Get returns nil on a miss, otherwise the
+// value with the time it has left to live.
+type CacheStore interface {
+	Get(ctx context.Context, key string) ([]byte, time.Duration, error)
+	Put(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// CachedRepository looks a name up in memory, then in the store and only then asks the
+// providers. Entries are kept as JSON so callers never share a response.
+type CachedRepository struct {
+	next   NameInfoRepository
+	store  CacheStore
+	memory *lru.Cache[string, []byte]
+	ttl    time.Duration
+}
+
+// NewCachedRepository caches successful responses of next for ttl, a nil store keeps
+// the cache in memory only. Responses a fallback provider took part in are not cached, the
+// first providers are asked again once they are back.
+func NewCachedRepository(next NameInfoRepository, store CacheStore, size int, ttl time.Duration) *CachedRepository {
+	return &CachedRepository{
+		next:   next,
+		store:  store,
+		memory: lru.New[string, []byte](size, ttl),
+		ttl:    ttl,
+	}
+}
+
+func (c *CachedRepository) GetNameInfo(ctx context.Context, name, country string) (*external.ExternalResponse, error) {
+	key := cacheKey(name, country)
+
+	if res := c.lookup(ctx, key); res != nil {
+		return res, nil
+	}
+
+	res, err := c.next.GetNameInfo(ctx, name, country)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetNameInfo #1")
+	}
+
+	c.save(ctx, key, res)
+
+	return res, nil
+}
+
+// GetNamesInfo answers what it can from the cache and looks the remaining names up in one go.
+func (c *CachedRepository) GetNamesInfo(ctx context.Context, names []string, country string) (map[string]*external.ExternalResponse, error) {
+	res := make(map[string]*external.ExternalResponse, len(names))
+	misses := make([]string, 0, len(names))
+
+	for _, name := range names {
+		if _, ok := res[name]; ok {
+			continue
+		}
+
+		if res[name] = c.lookup(ctx, cacheKey(name, country)); res[name] == nil {
+			misses = append(misses, name)
+		}
+	}
+
+	if len(misses) == 0 {
+		return res, nil
+	}
+
+	infos, err := c.next.GetNamesInfo(ctx, misses, country)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetNamesInfo #1")
+	}
+
+	for name, info := range infos {
+		res[name] = info
+
+		c.save(ctx, cacheKey(name, country), info)
+	}
+
+	return res, nil
+}
+
+// lookup returns nil on a miss.
+func (c *CachedRepository) lookup(ctx context.Context, key string) *external.ExternalResponse {
+	if value, ok := c.memory.Get(key); ok {
+		if res, err := decodeResponse(value); err == nil {
+			cacheStats.Add("memory_hits", 1)
+
+			return res
+		}
+	}
+
+	cacheStats.Add("memory_misses", 1)
+
+	if value, ttl := c.fromStore(ctx, key); value != nil {
+		if res, err := decodeResponse(value); err == nil {
+			cacheStats.Add("db_hits", 1)
+
+			// the entry keeps the expiry it got when it was stored
+			c.memory.AddWithTTL(key, value, ttl)
+
+			return res
+		}
+	}
+
+	return nil
+}
+
+// save caches successful responses of the first providers only, caching is best effort so
+// failures are just logged.
+func (c *CachedRepository) save(ctx context.Context, key string, res *external.ExternalResponse) {
+	if res == nil || res.Error != nil || res.Fallback {
+		return
+	}
+
+	value, err := json.Marshal(res)
+	if err != nil {
+		log.Warn("failed to encode enrichment result: ", errors.Wrap(err, "save #1"))
+
+		return
+	}
+
+	c.memory.Add(key, value)
+
+	if c.store != nil {
+		if err = c.store.Put(ctx, key, value, c.ttl); err != nil {
+			log.Warn("failed to store enrichment result: ", errors.Wrap(err, "save #2"))
+		}
+	}
+}
+
+// fromStore treats a failing store as a miss, the providers are still there to answer.
+func (c *CachedRepository) fromStore(ctx context.Context, key string) ([]byte, time.Duration) {
+	if c.store == nil {
+		return nil, 0
+	}
+
+	value, ttl, err := c.store.Get(ctx, key)
+	if err != nil {
+		log.Warn("failed to read enrichment cache: ", errors.Wrap(err, "fromStore #1"))
+	}
+
+	if value == nil {
+		cacheStats.Add("db_misses", 1)
+	}
+
+	return value, ttl
+}
+
+func cacheKey(name, country string) string {
+	return strings.ToLower(strings.TrimSpace(name)) + "|" + strings.ToUpper(strings.TrimSpace(country))
+}
+
+func decodeResponse(value []byte) (*external.ExternalResponse, error) {
+	var res external.ExternalResponse
+
+	if err := json.Unmarshal(value, &res); err != nil {
+		return nil, errors.Wrap(err, "decodeResponse #1")
+	}
+
+	return &res, nil
+}
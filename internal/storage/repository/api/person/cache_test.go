@@ -0,0 +1,256 @@
+package person
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"namer/internal/domain/external"
+	"namer/pkg/utils"
+	"sync"
+	"testing"
+	"time"
+)
+
+type countingRepository struct {
+	calls int
+	names []string
+	res   *external.ExternalResponse
+	err   error
+}
+
+func (r *countingRepository) GetNameInfo(ctx context.Context, name, country string) (*external.ExternalResponse, error) {
+	r.calls++
+
+	return r.res, r.err
+}
+
+func (r *countingRepository) GetNamesInfo(ctx context.Context, names []string, country string) (map[string]*external.ExternalResponse, error) {
+	r.calls++
+	r.names = append(r.names, names...)
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	res := make(map[string]*external.ExternalResponse, len(names))
+
+	for _, name := range names {
+		res[name] = r.res
+	}
+
+	return res, nil
+}
+
+type mapStore struct {
+	mu      sync.Mutex
+	values  map[string][]byte
+	expires map[string]time.Time
+	err     error
+}
+
+func (s *mapStore) Get(ctx context.Context, key string) ([]byte, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ttl := time.Until(s.expires[key])
+	if ttl <= 0 {
+		return nil, 0, s.err
+	}
+
+	return s.values[key], ttl, s.err
+}
+
+func (s *mapStore) Put(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+
+	if s.expires == nil {
+		s.expires = make(map[string]time.Time)
+	}
+
+	s.values[key], s.expires[key] = value, time.Now().Add(ttl)
+
+	return nil
+}
+
+func cacheStat(name string) int64 {
+	if v, ok := cacheStats.Get(name).(*expvar.Int); ok {
+		return v.Value()
+	}
+
+	return 0
+}
+
+func TestCachedRepository(t *testing.T) {
+	helen := &external.ExternalResponse{
+		Agify: &external.AgifyResponse{
+			Name: utils.StringToPtr("Helen"),
+			Age:  utils.IntToPtr(40),
+		},
+	}
+
+	t.Run("success_memory_hit", func(t *testing.T) {
+		next := &countingRepository{res: helen}
+		repo := NewCachedRepository(next, nil, 10, time.Minute)
+
+		hits := cacheStat("memory_hits")
+
+		_, err := repo.GetNameInfo(context.Background(), "Helen", "gb")
+		require.NoError(t, err)
+
+		res, err := repo.GetNameInfo(context.Background(), " helen ", "GB")
+		require.NoError(t, err)
+
+		assert.Equal(t, 1, next.calls)
+		assert.Equal(t, 40, *res.Agify.Age)
+		assert.Equal(t, hits+1, cacheStat("memory_hits"))
+	})
+
+	t.Run("success_country_is_part_of_key", func(t *testing.T) {
+		next := &countingRepository{res: helen}
+		repo := NewCachedRepository(next, nil, 10, time.Minute)
+
+		_, err := repo.GetNameInfo(context.Background(), "Helen", "GB")
+		require.NoError(t, err)
+
+		_, err = repo.GetNameInfo(context.Background(), "Helen", "US")
+		require.NoError(t, err)
+
+		assert.Equal(t, 2, next.calls)
+	})
+
+	t.Run("success_store_hit", func(t *testing.T) {
+		store := &mapStore{values: make(map[string][]byte)}
+
+		next := &countingRepository{res: helen}
+
+		_, err := NewCachedRepository(next, store, 10, time.Minute).GetNameInfo(context.Background(), "Helen", "")
+		require.NoError(t, err)
+
+		hits := cacheStat("db_hits")
+
+		// a fresh repository has an empty memory, as after a restart
+		res, err := NewCachedRepository(next, store, 10, time.Minute).GetNameInfo(context.Background(), "Helen", "")
+		require.NoError(t, err)
+
+		assert.Equal(t, 1, next.calls)
+		assert.Equal(t, 40, *res.Agify.Age)
+		assert.Equal(t, hits+1, cacheStat("db_hits"))
+	})
+
+	t.Run("success_store_hit_keeps_expiry", func(t *testing.T) {
+		store := &mapStore{values: make(map[string][]byte)}
+
+		next := &countingRepository{res: helen}
+
+		_, err := NewCachedRepository(next, store, 10, time.Millisecond*100).GetNameInfo(context.Background(), "Helen", "")
+		require.NoError(t, err)
+
+		// the memory of the second repository would keep the entry for an hour from now
+		repo := NewCachedRepository(next, store, 10, time.Hour)
+
+		_, err = repo.GetNameInfo(context.Background(), "Helen", "")
+		require.NoError(t, err)
+
+		time.Sleep(time.Millisecond * 150)
+
+		_, err = repo.GetNameInfo(context.Background(), "Helen", "")
+		require.NoError(t, err)
+
+		assert.Equal(t, 2, next.calls)
+	})
+
+	t.Run("success_responses_are_not_shared", func(t *testing.T) {
+		repo := NewCachedRepository(&countingRepository{res: helen}, nil, 10, time.Minute)
+
+		_, err := repo.GetNameInfo(context.Background(), "Helen", "")
+		require.NoError(t, err)
+
+		first, err := repo.GetNameInfo(context.Background(), "Helen", "")
+		require.NoError(t, err)
+
+		*first.Agify.Age = 1
+
+		second, err := repo.GetNameInfo(context.Background(), "Helen", "")
+		require.NoError(t, err)
+
+		assert.Equal(t, 40, *second.Agify.Age)
+	})
+
+	t.Run("success_batch_looks_up_misses_only", func(t *testing.T) {
+		next := &countingRepository{res: helen}
+		repo := NewCachedRepository(next, nil, 10, time.Minute)
+
+		_, err := repo.GetNameInfo(context.Background(), "Helen", "")
+		require.NoError(t, err)
+
+		res, err := repo.GetNamesInfo(context.Background(), []string{"Helen", "Anna", "Anna"}, "")
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"Anna"}, next.names)
+		assert.Len(t, res, 2)
+		assert.Equal(t, 40, *res["Helen"].Agify.Age)
+
+		_, err = repo.GetNamesInfo(context.Background(), []string{"Helen", "Anna"}, "")
+		require.NoError(t, err)
+
+		assert.Equal(t, 2, next.calls)
+	})
+
+	t.Run("error_provider_not_cached", func(t *testing.T) {
+		next := &countingRepository{res: &external.ExternalResponse{Error: utils.StringToPtr("Request limit reached")}}
+		repo := NewCachedRepository(next, nil, 10, time.Minute)
+
+		for i := 0; i < 2; i++ {
+			res, err := repo.GetNameInfo(context.Background(), "Helen", "")
+			require.NoError(t, err)
+			assert.Equal(t, "Request limit reached", *res.Error)
+		}
+
+		assert.Equal(t, 2, next.calls)
+	})
+
+	t.Run("success_fallback_not_cached", func(t *testing.T) {
+		store := &mapStore{values: make(map[string][]byte)}
+		next := &countingRepository{res: &external.ExternalResponse{Agify: helen.Agify, Fallback: true}}
+		repo := NewCachedRepository(next, store, 10, time.Minute)
+
+		for i := 0; i < 2; i++ {
+			res, err := repo.GetNamesInfo(context.Background(), []string{"Helen"}, "")
+			require.NoError(t, err)
+			assert.Equal(t, 40, *res["Helen"].Agify.Age)
+		}
+
+		assert.Equal(t, 2, next.calls)
+		assert.Empty(t, store.values)
+	})
+
+	t.Run("error_transport_not_cached", func(t *testing.T) {
+		next := &countingRepository{err: errors.New("connection refused")}
+		repo := NewCachedRepository(next, nil, 10, time.Minute)
+
+		for i := 0; i < 2; i++ {
+			_, err := repo.GetNameInfo(context.Background(), "Helen", "")
+			assert.Error(t, err)
+		}
+
+		assert.Equal(t, 2, next.calls)
+	})
+
+	t.Run("error_store_is_a_miss", func(t *testing.T) {
+		store := &mapStore{values: make(map[string][]byte), err: errors.New("pg_error")}
+		next := &countingRepository{res: helen}
+
+		res, err := NewCachedRepository(next, store, 10, time.Minute).GetNameInfo(context.Background(), "Helen", "")
+		require.NoError(t, err)
+
+		assert.Equal(t, 40, *res.Agify.Age)
+		assert.Equal(t, 1, next.calls)
+	})
+}
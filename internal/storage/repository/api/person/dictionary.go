@@ -0,0 +1,261 @@
+package person
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"namer/internal/domain/external"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ProviderDictionary is the name the dictionary is registered under.
+const ProviderDictionary = "dictionary"
+
+// sample is a small sample of name statistics, enough for environments without internet and for tests.
+//
+//go:embed names.csv
+var sample []byte
+
+// Dictionary answers from name statistics held in memory. A row with a country_id gives the age
+// and the gender of the name in that country, the nationalities are taken from the row without one.
+type Dictionary struct {
+	entries map[string]dictionaryEntry
+}
+
+type dictionaryEntry struct {
+	age           *int
+	gender        *string
+	probability   *float64
+	count         *int
+	nationalities []external.CountryProbability
+}
+
+// NewDictionary reads the statistics from a CSV file with a header row. The name column is
+// required, the optional ones are country_id, age, gender, gender_probability, count and
+// nationalities, which lists country:probability pairs separated by semicolons.
+func NewDictionary(r io.Reader) (*Dictionary, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "NewDictionary #1")
+	}
+
+	columns := make(map[string]int, len(header))
+
+	for i, column := range header {
+		columns[strings.TrimSpace(column)] = i
+	}
+
+	if _, ok := columns["name"]; !ok {
+		return nil, errors.Wrap(errors.New("name column is missing"), "NewDictionary #2")
+	}
+
+	d := &Dictionary{entries: make(map[string]dictionaryEntry)}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, errors.Wrap(err, "NewDictionary #3")
+		}
+
+		value := func(column string) string {
+			if i, ok := columns[column]; ok {
+				return strings.TrimSpace(record[i])
+			}
+
+			return ""
+		}
+
+		line, _ := reader.FieldPos(0)
+
+		if value("name") == "" {
+			return nil, errors.Wrap(fmt.Errorf("line %d: name is empty", line), "NewDictionary #4")
+		}
+
+		entry, err := parseEntry(value)
+		if err != nil {
+			return nil, errors.Wrap(fmt.Errorf("line %d: %w", line, err), "NewDictionary #5")
+		}
+
+		d.entries[dictionaryKey(value("name"), value("country_id"))] = entry
+	}
+
+	return d, nil
+}
+
+// LoadDictionary reads the statistics from the CSV file at path, the embedded sample when path is empty.
+func LoadDictionary(path string) (*Dictionary, error) {
+	if path == "" {
+		d, err := NewDictionary(bytes.NewReader(sample))
+		if err != nil {
+			return nil, errors.Wrap(err, "LoadDictionary #1")
+		}
+
+		return d, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "LoadDictionary #2")
+	}
+
+	defer f.Close()
+
+	d, err := NewDictionary(f)
+	if err != nil {
+		return nil, errors.Wrap(err, "LoadDictionary #3")
+	}
+
+	return d, nil
+}
+
+func parseEntry(value func(column string) string) (dictionaryEntry, error) {
+	var entry dictionaryEntry
+
+	if s := value("age"); s != "" {
+		age, err := strconv.Atoi(s)
+		if err != nil || age < 0 {
+			return entry, fmt.Errorf("invalid age %q", s)
+		}
+
+		entry.age = &age
+	}
+
+	if s := value("gender"); s != "" {
+		if s != "male" && s != "female" {
+			return entry, fmt.Errorf("invalid gender %q", s)
+		}
+
+		entry.gender = &s
+	}
+
+	if s := value("gender_probability"); s != "" {
+		probability, err := parseProbability(s)
+		if err != nil {
+			return entry, err
+		}
+
+		entry.probability = &probability
+	}
+
+	if s := value("count"); s != "" {
+		count, err := strconv.Atoi(s)
+		if err != nil || count < 0 {
+			return entry, fmt.Errorf("invalid count %q", s)
+		}
+
+		entry.count = &count
+	}
+
+	if s := value("nationalities"); s != "" {
+		for _, pair := range strings.Split(s, ";") {
+			country, p, ok := strings.Cut(pair, ":")
+			if !ok || strings.TrimSpace(country) == "" {
+				return entry, fmt.Errorf("invalid nationality %q", pair)
+			}
+
+			probability, err := parseProbability(p)
+			if err != nil {
+				return entry, err
+			}
+
+			entry.nationalities = append(entry.nationalities, external.CountryProbability{
+				CountryId:   strings.ToUpper(strings.TrimSpace(country)),
+				Probability: probability,
+			})
+		}
+
+		sort.SliceStable(entry.nationalities, func(i, j int) bool {
+			return entry.nationalities[i].Probability > entry.nationalities[j].Probability
+		})
+	}
+
+	return entry, nil
+}
+
+func parseProbability(s string) (float64, error) {
+	probability, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || probability < 0 || probability > 1 {
+		return 0, fmt.Errorf("invalid probability %q", s)
+	}
+
+	return probability, nil
+}
+
+// dictionaryKey ignores the case of the name and the country.
+func dictionaryKey(name, country string) string {
+	return strings.ToLower(strings.TrimSpace(name)) + "|" + strings.ToUpper(country)
+}
+
+func (d *Dictionary) Name() string {
+	return ProviderDictionary
+}
+
+func (d *Dictionary) Attributes() []Attribute {
+	return []Attribute{AttributeAge, AttributeGender, AttributeNation}
+}
+
+// Lookup never fails, a name the dictionary does not know gets empty sections. The responses
+// get copies of the statistics, so callers are free to keep them.
+func (d *Dictionary) Lookup(ctx context.Context, names []string, country string) ([]*external.ExternalResponse, error) {
+	res := make([]*external.ExternalResponse, len(names))
+
+	for i, name := range names {
+		name := name
+
+		global := d.entries[dictionaryKey(name, "")]
+
+		local, ok := d.entries[dictionaryKey(name, country)]
+		if !ok || country == "" {
+			local = global
+		}
+
+		res[i] = &external.ExternalResponse{
+			Agify: &external.AgifyResponse{
+				Name:       &name,
+				Age:        clone(local.age),
+				Count:      clone(local.count),
+				StatusCode: http.StatusOK,
+			},
+			Genderize: &external.GenderizeResponse{
+				Name:        &name,
+				Gender:      clone(local.gender),
+				Probability: clone(local.probability),
+				Count:       clone(local.count),
+				StatusCode:  http.StatusOK,
+			},
+			Nationalize: &external.NationalizeResponse{
+				Name:       &name,
+				Country:    append([]external.CountryProbability(nil), global.nationalities...),
+				Count:      clone(global.count),
+				StatusCode: http.StatusOK,
+			},
+		}
+	}
+
+	return res, nil
+}
+
+func clone[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+
+	v := *p
+
+	return &v
+}
@@ -0,0 +1,117 @@
+package person
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"namer/internal/domain/external"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewDictionary(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		d, err := NewDictionary(strings.NewReader(strings.Join([]string{
+			"name,country_id,age,gender,gender_probability,count,nationalities",
+			"Helen,,60,female,0.98,100,US:0.1;GB:0.12",
+			"helen,gb,55,female,0.99,40,",
+			"Li,,,,,,",
+		}, "\n")))
+		require.NoError(t, err)
+
+		res, err := d.Lookup(context.Background(), []string{"HELEN", "Helen", "Li", "Anna"}, "GB")
+		require.NoError(t, err)
+		require.Len(t, res, 4)
+
+		// the row of the country gives the age and the gender
+		assert.Equal(t, 55, *res[0].Agify.Age)
+		assert.Equal(t, 0.99, *res[0].Genderize.Probability)
+		assert.Equal(t, 40, *res[0].Genderize.Count)
+		assert.Equal(t, "HELEN", *res[0].Agify.Name)
+
+		// the nationalities come from the row without a country, the most probable first
+		assert.Equal(t, []external.CountryProbability{
+			{CountryId: "GB", Probability: 0.12},
+			{CountryId: "US", Probability: 0.1},
+		}, res[1].Nationalize.Country)
+		assert.Equal(t, 100, *res[1].Nationalize.Count)
+
+		for _, info := range res[2:] {
+			assert.Nil(t, info.Error)
+			assert.Nil(t, info.Agify.Age)
+			assert.Nil(t, info.Genderize.Gender)
+			assert.Empty(t, info.Nationalize.Country)
+		}
+
+		// the responses do not share the statistics
+		*res[0].Agify.Age = 1
+
+		res, err = d.Lookup(context.Background(), []string{"Helen"}, "")
+		require.NoError(t, err)
+		assert.Equal(t, 60, *res[0].Agify.Age)
+	})
+
+	for name, csv := range map[string]string{
+		"error_empty":         "",
+		"error_name_column":   "age\n40",
+		"error_name":          "name,age\n,40",
+		"error_age":           "name,age\nHelen,forty",
+		"error_gender":        "name,gender\nHelen,f",
+		"error_probability":   "name,gender_probability\nHelen,1.5",
+		"error_count":         "name,count\nHelen,-1",
+		"error_nationalities": "name,nationalities\nHelen,GB",
+	} {
+		t.Run(name, func(t *testing.T) {
+			d, err := NewDictionary(strings.NewReader(csv))
+			assert.Nil(t, d)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoadDictionary(t *testing.T) {
+	t.Run("success_sample", func(t *testing.T) {
+		d, err := LoadDictionary("")
+		require.NoError(t, err)
+
+		res, err := d.Lookup(context.Background(), []string{"Anna"}, "")
+		require.NoError(t, err)
+		assert.NotNil(t, res[0].Agify.Age)
+	})
+
+	t.Run("success_file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "names.csv")
+		require.NoError(t, os.WriteFile(path, []byte("name,age\nHelen,40\n"), 0o600))
+
+		d, err := LoadDictionary(path)
+		require.NoError(t, err)
+
+		res, err := d.Lookup(context.Background(), []string{"Helen"}, "")
+		require.NoError(t, err)
+		assert.Equal(t, 40, *res[0].Agify.Age)
+	})
+
+	t.Run("error_file", func(t *testing.T) {
+		d, err := LoadDictionary(filepath.Join(t.TempDir(), "missing.csv"))
+		assert.Nil(t, d)
+		assert.Error(t, err)
+	})
+}
+
+// TestDictionaryFallback answers from the dictionary while the online provider is down.
+func TestDictionaryFallback(t *testing.T) {
+	d, err := LoadDictionary("")
+	require.NoError(t, err)
+
+	registry, err := NewRegistry(time.Second, failingProvider(ProviderAgify, AttributeAge), d)
+	require.NoError(t, err)
+
+	info, err := registry.GetNameInfo(context.Background(), "Helen", "")
+	require.NoError(t, err)
+
+	assert.Equal(t, 60, *info.Agify.Age)
+	assert.Equal(t, "female", *info.Genderize.Gender)
+}
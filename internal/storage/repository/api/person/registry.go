@@ -0,0 +1,434 @@
+package person
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"namer/internal/domain/external"
+	"sync"
+	"time"
+)
+
+// Attribute is a person attribute a provider can fill in.
+type Attribute string
+
+const (
+	AttributeAge    Attribute = "age"
+	AttributeGender Attribute = "gender"
+	AttributeNation Attribute = "nation"
+)
+
+// EnrichmentProvider finds out attributes of persons by their names. Lookup returns one
+// response per name in the order of names, with only the sections of Attributes set. A name
+// the provider rejects gets a response with Error and StatusCode, an error fails the whole lookup.
+type EnrichmentProvider interface {
+	Name() string
+	Attributes() []Attribute
+	Lookup(ctx context.Context, names []string, country string) ([]*external.ExternalResponse, error)
+}
+
+type LookupFunc func(ctx context.Context, names []string, country string) ([]*external.ExternalResponse, error)
+
+type funcProvider struct {
+	name       string
+	attributes []Attribute
+	lookup     LookupFunc
+}
+
+// NewProvider makes a provider of a lookup function.
+func NewProvider(name string, attributes []Attribute, lookup LookupFunc) EnrichmentProvider {
+	return &funcProvider{
+		name:       name,
+		attributes: attributes,
+		lookup:     lookup,
+	}
+}
+
+func (p *funcProvider) Name() string {
+	return p.name
+}
+
+func (p *funcProvider) Attributes() []Attribute {
+	return p.attributes
+}
+
+func (p *funcProvider) Lookup(ctx context.Context, names []string, country string) ([]*external.ExternalResponse, error) {
+	return p.lookup(ctx, names, country)
+}
+
+// Registry asks the providers in the order of precedence. Every attribute is taken from the
+// first provider that knows it, a name the provider does not know, rejects or fails on falls
+// through to the next provider of the attribute. The first provider of every attribute still
+// missing is asked at the same time.
+type Registry struct {
+	providers []EnrichmentProvider
+	timeout   time.Duration
+}
+
+// NewRegistry registers the providers, the first one takes precedence. All the lookups of a
+// GetNamesInfo call share the deadline of timeout.
+func NewRegistry(timeout time.Duration, providers ...EnrichmentProvider) (*Registry, error) {
+	seen := make(map[string]bool, len(providers))
+
+	for _, p := range providers {
+		if seen[p.Name()] {
+			return nil, errors.Wrap(fmt.Errorf("provider %q registered twice", p.Name()), "NewRegistry #1")
+		}
+
+		if len(p.Attributes()) == 0 {
+			return nil, errors.Wrap(fmt.Errorf("provider %q fills no attributes", p.Name()), "NewRegistry #2")
+		}
+
+		for _, attribute := range p.Attributes() {
+			if !attribute.valid() {
+				return nil, errors.Wrap(fmt.Errorf("provider %q fills unknown attribute %q", p.Name(), attribute), "NewRegistry #3")
+			}
+		}
+
+		seen[p.Name()] = true
+	}
+
+	return &Registry{
+		providers: providers,
+		timeout:   timeout,
+	}, nil
+}
+
+func (r *Registry) GetNameInfo(ctx context.Context, name, country string) (*external.ExternalResponse, error) {
+	res, err := r.GetNamesInfo(ctx, []string{name}, country)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetNameInfo #1")
+	}
+
+	return res[name], nil
+}
+
+// GetNamesInfo looks the names up in rounds. A round asks, for every attribute some name still
+// misses, the first provider of it not asked yet. Once no provider is left, the attributes a name
+// still misses are checked in the age, gender, nation order: the first one a provider rejected the
+// name for gives the name its error, the first one a provider failed on fails the lookup. Once a
+// failure decides the lookup, the providers of the attributes after it are cancelled.
+func (r *Registry) GetNamesInfo(ctx context.Context, names []string, country string) (map[string]*external.ExternalResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	unique := make([]string, 0, len(names))
+	res := make(map[string]*external.ExternalResponse, len(names))
+
+	for _, name := range names {
+		if _, ok := res[name]; !ok {
+			res[name] = &external.ExternalResponse{}
+			unique = append(unique, name)
+		}
+	}
+
+	var (
+		asked    = make([]bool, len(r.providers))
+		failures = make(map[string]map[Attribute]*external.ExternalResponse, len(unique))
+		errs     = make(map[Attribute]error)
+	)
+
+	for {
+		due := r.due(asked, unique, res)
+		if len(due) == 0 {
+			break
+		}
+
+		var (
+			wg      sync.WaitGroup
+			results = make([][]*external.ExternalResponse, len(due))
+			lookups = make([][]string, len(due))
+			dueErrs = make([]error, len(due))
+			ctxs    = make([]context.Context, len(due))
+			cancels = make([]context.CancelFunc, len(due))
+			decided = make([]bool, len(due))
+		)
+
+		for i, index := range due {
+			asked[index] = true
+			lookups[i] = missing(unique, res, r.providers[index].Attributes())
+			ctxs[i], cancels[i] = context.WithCancel(ctx)
+		}
+
+		for i, index := range due {
+			wg.Add(1)
+
+			go func(i int, p EnrichmentProvider) {
+				defer wg.Done()
+
+				results[i], dueErrs[i] = p.Lookup(ctxs[i], lookups[i], country)
+				if dueErrs[i] == nil && len(results[i]) != len(lookups[i]) {
+					dueErrs[i] = errors.New("unexpected number of results")
+				}
+
+				if dueErrs[i] == nil {
+					return
+				}
+
+				// the lookup fails whatever the providers of the attributes after this one answer
+				if rank, ok := r.decides(asked, p, lookups[i], res, failures); ok {
+					decided[i] = true
+
+					for j, index := range due {
+						if after(r.providers[index], rank) {
+							cancels[j]()
+						}
+					}
+				}
+			}(i, r.providers[index])
+		}
+
+		wg.Wait()
+
+		var stop bool
+
+		// the providers are merged in the order of precedence, so the first value found stays
+		for i, index := range due {
+			p := r.providers[index]
+
+			// a lookup cancelled by a decided failure has nothing to report
+			cancelled := dueErrs[i] != nil && ctxs[i].Err() != nil && ctx.Err() == nil
+
+			cancels[i]()
+
+			stop = stop || decided[i]
+
+			if cancelled {
+				continue
+			}
+
+			if dueErrs[i] != nil {
+				for _, attribute := range p.Attributes() {
+					if errs[attribute] == nil {
+						errs[attribute] = errors.Wrapf(dueErrs[i], "provider %s", p.Name())
+					}
+				}
+
+				continue
+			}
+
+			for j, name := range lookups[i] {
+				result := results[i][j]
+
+				for _, attribute := range p.Attributes() {
+					switch {
+					case result.Error != nil:
+						if failures[name] == nil {
+							failures[name] = make(map[Attribute]*external.ExternalResponse)
+						}
+
+						if failures[name][attribute] == nil {
+							failures[name][attribute] = result
+						}
+					case !has(res[name], attribute):
+						merge(res[name], result, attribute)
+
+						if has(res[name], attribute) && !r.first(index, attribute) {
+							res[name].Fallback = true
+						}
+					}
+				}
+			}
+		}
+
+		if stop {
+			break
+		}
+	}
+
+	for _, name := range unique {
+		info := res[name]
+
+	report:
+		for _, attribute := range attributes {
+			switch {
+			case has(info, attribute):
+			case failures[name][attribute] != nil:
+				info.Error, info.StatusCode = failures[name][attribute].Error, failures[name][attribute].StatusCode
+
+				break report
+			case errs[attribute] != nil:
+				return nil, errors.Wrap(errs[attribute], "GetNamesInfo #1")
+			}
+		}
+
+		// a section nobody filled in reads as an unknown name
+		if info.Agify == nil {
+			info.Agify = &external.AgifyResponse{}
+		}
+
+		if info.Genderize == nil {
+			info.Genderize = &external.GenderizeResponse{}
+		}
+
+		if info.Nationalize == nil {
+			info.Nationalize = &external.NationalizeResponse{}
+		}
+	}
+
+	return res, nil
+}
+
+// due returns the providers to ask in the next round, in the order of precedence.
+func (r *Registry) due(asked []bool, names []string, res map[string]*external.ExternalResponse) []int {
+	var due []int
+
+	picked := make(map[int]bool)
+
+	for _, attribute := range attributes {
+		if len(missing(names, res, []Attribute{attribute})) == 0 {
+			continue
+		}
+
+		for i, p := range r.providers {
+			if !asked[i] && fills(p, attribute) {
+				picked[i] = true
+
+				break
+			}
+		}
+	}
+
+	for i := range r.providers {
+		if picked[i] {
+			due = append(due, i)
+		}
+	}
+
+	return due
+}
+
+// decides tells whether the failure of the provider fails the whole lookup: some name misses an
+// attribute of it no provider is left for, while it knows all the attributes reported before.
+// It returns the rank of that attribute.
+func (r *Registry) decides(asked []bool, p EnrichmentProvider, names []string, res map[string]*external.ExternalResponse, failures map[string]map[Attribute]*external.ExternalResponse) (int, bool) {
+	for rank, attribute := range attributes {
+		if !fills(p, attribute) || r.left(asked, attribute) {
+			continue
+		}
+
+	next:
+		for _, name := range names {
+			if has(res[name], attribute) || failures[name][attribute] != nil {
+				continue
+			}
+
+			for _, before := range attributes[:rank] {
+				if !has(res[name], before) {
+					continue next
+				}
+			}
+
+			return rank, true
+		}
+	}
+
+	return 0, false
+}
+
+// first tells whether the provider of the index is the first one registered for the attribute.
+func (r *Registry) first(index int, attribute Attribute) bool {
+	for i, p := range r.providers {
+		if fills(p, attribute) {
+			return i == index
+		}
+	}
+
+	return false
+}
+
+// left tells whether a provider of the attribute is still to be asked.
+func (r *Registry) left(asked []bool, attribute Attribute) bool {
+	for i, p := range r.providers {
+		if !asked[i] && fills(p, attribute) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// after tells whether the provider fills only attributes reported after the one of the rank.
+func after(p EnrichmentProvider, rank int) bool {
+	for _, attribute := range p.Attributes() {
+		for i, a := range attributes {
+			if a == attribute && i <= rank {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// attributes lists the attributes in the order their failures are reported in.
+var attributes = []Attribute{AttributeAge, AttributeGender, AttributeNation}
+
+func (a Attribute) valid() bool {
+	for _, attribute := range attributes {
+		if a == attribute {
+			return true
+		}
+	}
+
+	return false
+}
+
+func fills(p EnrichmentProvider, attribute Attribute) bool {
+	for _, a := range p.Attributes() {
+		if a == attribute {
+			return true
+		}
+	}
+
+	return false
+}
+
+// missing returns the names that miss any of the attributes.
+func missing(names []string, res map[string]*external.ExternalResponse, attrs []Attribute) []string {
+	var missing []string
+
+	for _, name := range names {
+		for _, attribute := range attrs {
+			if !has(res[name], attribute) {
+				missing = append(missing, name)
+
+				break
+			}
+		}
+	}
+
+	return missing
+}
+
+func has(info *external.ExternalResponse, attribute Attribute) bool {
+	switch attribute {
+	case AttributeAge:
+		return info.Agify != nil && info.Agify.Age != nil
+	case AttributeGender:
+		return info.Genderize != nil && info.Genderize.Gender != nil
+	case AttributeNation:
+		return info.Nationalize != nil && len(info.Nationalize.Country) != 0
+	}
+
+	return false
+}
+
+// merge copies the section of the attribute, a section that knows nothing is kept only
+// until another provider knows more.
+func merge(dst, src *external.ExternalResponse, attribute Attribute) {
+	switch attribute {
+	case AttributeAge:
+		if src.Agify != nil {
+			dst.Agify = src.Agify
+		}
+	case AttributeGender:
+		if src.Genderize != nil {
+			dst.Genderize = src.Genderize
+		}
+	case AttributeNation:
+		if src.Nationalize != nil {
+			dst.Nationalize = src.Nationalize
+		}
+	}
+}
@@ -0,0 +1,419 @@
+package person
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"namer/internal/domain/external"
+	"namer/pkg/utils"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// ageProvider knows the ages of the names and records what it was asked about.
+func ageProvider(name string, ages map[string]int, asked *[]string) EnrichmentProvider {
+	var mu sync.Mutex
+
+	return NewProvider(name, []Attribute{AttributeAge}, func(ctx context.Context, names []string, country string) ([]*external.ExternalResponse, error) {
+		mu.Lock()
+		*asked = append(*asked, names...)
+		mu.Unlock()
+
+		res := make([]*external.ExternalResponse, len(names))
+
+		for i, n := range names {
+			res[i] = &external.ExternalResponse{Agify: &external.AgifyResponse{}}
+
+			if age, ok := ages[n]; ok {
+				res[i].Agify.Age = utils.IntToPtr(age)
+			}
+		}
+
+		return res, nil
+	})
+}
+
+func rejectingProvider(name string, attributes ...Attribute) EnrichmentProvider {
+	return NewProvider(name, attributes, func(ctx context.Context, names []string, country string) ([]*external.ExternalResponse, error) {
+		res := make([]*external.ExternalResponse, len(names))
+
+		for i := range res {
+			res[i] = &external.ExternalResponse{Error: utils.StringToPtr("Request limit reached"), StatusCode: http.StatusTooManyRequests}
+		}
+
+		return res, nil
+	})
+}
+
+func failingProvider(name string, attributes ...Attribute) EnrichmentProvider {
+	return NewProvider(name, attributes, func(ctx context.Context, names []string, country string) ([]*external.ExternalResponse, error) {
+		return nil, external.ErrProviderUnavailable
+	})
+}
+
+func TestRegistry(t *testing.T) {
+	t.Run("success_precedence", func(t *testing.T) {
+		var first, second []string
+
+		registry, err := NewRegistry(
+			time.Second,
+			ageProvider("hr", map[string]int{"Helen": 41}, &first),
+			ageProvider("agify", map[string]int{"Helen": 40, "Anna": 30}, &second),
+		)
+		require.NoError(t, err)
+
+		res, err := registry.GetNamesInfo(context.Background(), []string{"Helen", "Anna", "Helen"}, "")
+		require.NoError(t, err)
+
+		assert.Equal(t, 41, *res["Helen"].Agify.Age)
+		assert.Equal(t, 30, *res["Anna"].Agify.Age)
+		assert.Equal(t, []string{"Helen", "Anna"}, first)
+		assert.Equal(t, []string{"Anna"}, second)
+		assert.False(t, res["Helen"].Fallback)
+		assert.True(t, res["Anna"].Fallback)
+
+		// the sections nobody filled in are there, empty
+		assert.Nil(t, res["Anna"].Genderize.Gender)
+		assert.Empty(t, res["Anna"].Nationalize.Country)
+	})
+
+	t.Run("success_unknown", func(t *testing.T) {
+		var asked []string
+
+		registry, err := NewRegistry(time.Second, ageProvider("agify", nil, &asked))
+		require.NoError(t, err)
+
+		info, err := registry.GetNameInfo(context.Background(), "Helen", "")
+		require.NoError(t, err)
+
+		assert.Nil(t, info.Error)
+		assert.Nil(t, info.Agify.Age)
+	})
+
+	t.Run("success_concurrent", func(t *testing.T) {
+		var arrived sync.WaitGroup
+
+		arrived.Add(3)
+
+		// every provider answers only once all three are asked
+		barrier := func(name string, attribute Attribute, info *external.ExternalResponse) EnrichmentProvider {
+			return NewProvider(name, []Attribute{attribute}, func(ctx context.Context, names []string, country string) ([]*external.ExternalResponse, error) {
+				arrived.Done()
+				arrived.Wait()
+
+				return []*external.ExternalResponse{info}, nil
+			})
+		}
+
+		registry, err := NewRegistry(
+			time.Second,
+			barrier("agify", AttributeAge, &external.ExternalResponse{Agify: &external.AgifyResponse{Age: utils.IntToPtr(40)}}),
+			barrier("genderize", AttributeGender, &external.ExternalResponse{Genderize: &external.GenderizeResponse{Gender: utils.StringToPtr("female")}}),
+			barrier("nationalize", AttributeNation, &external.ExternalResponse{Nationalize: &external.NationalizeResponse{Count: utils.IntToPtr(1)}}),
+		)
+		require.NoError(t, err)
+
+		info, err := registry.GetNameInfo(context.Background(), "Helen", "")
+		require.NoError(t, err)
+
+		assert.Equal(t, 40, *info.Agify.Age)
+		assert.Equal(t, "female", *info.Genderize.Gender)
+		assert.Equal(t, 1, *info.Nationalize.Count)
+	})
+
+	t.Run("success_falls_through", func(t *testing.T) {
+		var asked []string
+
+		for _, first := range []EnrichmentProvider{rejectingProvider("hr", AttributeAge), failingProvider("hr", AttributeAge)} {
+			registry, err := NewRegistry(time.Second, first, ageProvider("agify", map[string]int{"Helen": 40}, &asked))
+			require.NoError(t, err)
+
+			info, err := registry.GetNameInfo(context.Background(), "Helen", "")
+			require.NoError(t, err)
+
+			assert.Nil(t, info.Error)
+			assert.Equal(t, 40, *info.Agify.Age)
+		}
+	})
+
+	t.Run("error_rejected", func(t *testing.T) {
+		var asked []string
+
+		registry, err := NewRegistry(
+			time.Second,
+			ageProvider("agify", map[string]int{"Helen": 40}, &asked),
+			rejectingProvider("genderize", AttributeGender),
+			failingProvider("nationalize", AttributeNation),
+		)
+		require.NoError(t, err)
+
+		res, err := registry.GetNamesInfo(context.Background(), []string{"Helen", "Anna"}, "")
+		require.NoError(t, err)
+
+		for _, name := range []string{"Helen", "Anna"} {
+			if assert.NotNil(t, res[name].Error) {
+				assert.Equal(t, "Request limit reached", *res[name].Error)
+				assert.Equal(t, http.StatusTooManyRequests, res[name].StatusCode)
+			}
+		}
+	})
+
+	t.Run("error_provider", func(t *testing.T) {
+		var asked []string
+
+		registry, err := NewRegistry(
+			time.Second,
+			ageProvider("agify", map[string]int{"Helen": 40}, &asked),
+			failingProvider("genderize", AttributeGender),
+			rejectingProvider("nationalize", AttributeNation),
+		)
+		require.NoError(t, err)
+
+		res, err := registry.GetNamesInfo(context.Background(), []string{"Helen"}, "")
+		assert.Nil(t, res)
+		assert.Equal(t, external.ErrProviderUnavailable, errors.Cause(err))
+	})
+
+	t.Run("error_shared_deadline", func(t *testing.T) {
+		var fallbackErr error
+
+		// the first provider uses the whole deadline up, the fallback gets none left
+		slow := NewProvider("hr", []Attribute{AttributeAge}, func(ctx context.Context, names []string, country string) ([]*external.ExternalResponse, error) {
+			<-ctx.Done()
+
+			return nil, ctx.Err()
+		})
+
+		fallback := NewProvider("agify", []Attribute{AttributeAge}, func(ctx context.Context, names []string, country string) ([]*external.ExternalResponse, error) {
+			fallbackErr = ctx.Err()
+
+			return nil, ctx.Err()
+		})
+
+		registry, err := NewRegistry(time.Millisecond*50, slow, fallback)
+		require.NoError(t, err)
+
+		_, err = registry.GetNameInfo(context.Background(), "Helen", "")
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.ErrorIs(t, fallbackErr, context.DeadlineExceeded)
+	})
+
+	t.Run("error_cancels_later", func(t *testing.T) {
+		var genderErr, nationErr error
+
+		// the later providers wait to be cancelled, the failure of the age decides the lookup
+		waiting := func(name string, attribute Attribute, dst *error) EnrichmentProvider {
+			return NewProvider(name, []Attribute{attribute}, func(ctx context.Context, names []string, country string) ([]*external.ExternalResponse, error) {
+				<-ctx.Done()
+				*dst = ctx.Err()
+
+				return nil, ctx.Err()
+			})
+		}
+
+		registry, err := NewRegistry(
+			time.Minute,
+			failingProvider("agify", AttributeAge),
+			waiting("genderize", AttributeGender, &genderErr),
+			waiting("nationalize", AttributeNation, &nationErr),
+		)
+		require.NoError(t, err)
+
+		_, err = registry.GetNameInfo(context.Background(), "Helen", "")
+		assert.Equal(t, external.ErrProviderUnavailable, errors.Cause(err))
+		assert.Equal(t, context.Canceled, genderErr)
+		assert.Equal(t, context.Canceled, nationErr)
+	})
+
+	t.Run("success_failure_not_decided", func(t *testing.T) {
+		var asked []string
+
+		// the gender failure is not final while another provider of the gender is left
+		registry, err := NewRegistry(
+			time.Second,
+			failingProvider("hr", AttributeGender),
+			ageProvider("agify", map[string]int{"Helen": 40}, &asked),
+			NewProvider("genderize", []Attribute{AttributeGender}, func(ctx context.Context, names []string, country string) ([]*external.ExternalResponse, error) {
+				return []*external.ExternalResponse{{Genderize: &external.GenderizeResponse{Gender: utils.StringToPtr("female")}}}, nil
+			}),
+		)
+		require.NoError(t, err)
+
+		info, err := registry.GetNameInfo(context.Background(), "Helen", "")
+		require.NoError(t, err)
+
+		assert.Equal(t, 40, *info.Agify.Age)
+		assert.Equal(t, "female", *info.Genderize.Gender)
+	})
+
+	t.Run("error_result_count", func(t *testing.T) {
+		registry, err := NewRegistry(time.Second, NewProvider("agify", []Attribute{AttributeAge}, func(ctx context.Context, names []string, country string) ([]*external.ExternalResponse, error) {
+			return nil, nil
+		}))
+		require.NoError(t, err)
+
+		_, err = registry.GetNameInfo(context.Background(), "Helen", "")
+		assert.Error(t, err)
+	})
+}
+
+func TestNewRegistry(t *testing.T) {
+	var asked []string
+
+	for name, providers := range map[string][]EnrichmentProvider{
+		"error_duplicate":  {ageProvider("agify", nil, &asked), ageProvider("agify", nil, &asked)},
+		"error_attributes": {NewProvider("hr", nil, nil)},
+		"error_attribute":  {NewProvider("hr", []Attribute{"height"}, nil)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			registry, err := NewRegistry(time.Second, providers...)
+			assert.Nil(t, registry)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestProvidersLocal(t *testing.T) {
+	var requests atomic.Int32
+
+	agify := respondBatch(&requests, func(name string) string {
+		return fmt.Sprintf(`{"count":1,"name":%q,"age":%d}`, name, len(name))
+	})
+	genderize := respondBatch(&requests, func(name string) string {
+		return fmt.Sprintf(`{"count":1,"name":%q,"gender":"female","probability":0.98}`, name)
+	})
+	nationalize := func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.URL.Query().Get("country_id"))
+
+		respondBatch(&requests, func(name string) string {
+			return fmt.Sprintf(`{"count":1,"name":%q,"country":[{"country_id":"GB","probability":0.1}]}`, name)
+		})(w, r)
+	}
+
+	t.Run("success", func(t *testing.T) {
+		names := make([]string, 12)
+
+		for i := range names {
+			names[i] = fmt.Sprintf("name%d", i)
+		}
+
+		providers := newTestRepository(t, agify, genderize, nationalize).Providers()
+
+		require.Len(t, providers, 3)
+		assert.Equal(t, ProviderAgify, providers[0].Name())
+
+		registry, err := NewRegistry(time.Second, providers...)
+		require.NoError(t, err)
+
+		res, err := registry.GetNamesInfo(context.Background(), names, "GB")
+		require.NoError(t, err)
+
+		// 12 names make two batches for each of the three providers
+		assert.Equal(t, int32(6), requests.Load())
+
+		for _, name := range names {
+			assert.Equal(t, len(name), *res[name].Agify.Age)
+			assert.Equal(t, "female", *res[name].Genderize.Gender)
+			assert.Equal(t, "GB", res[name].Nationalize.Country[0].CountryId)
+		}
+	})
+
+	t.Run("error_provider", func(t *testing.T) {
+		providers := newTestRepository(t, agify, respond(http.StatusTooManyRequests, `{"error":"Request limit reached"}`), nationalize).Providers()
+
+		res, err := providers[1].Lookup(context.Background(), []string{"Helen", "Anna"}, "")
+		require.NoError(t, err)
+
+		for _, info := range res {
+			if assert.NotNil(t, info.Error) {
+				assert.Equal(t, "Request limit reached", *info.Error)
+				assert.Equal(t, http.StatusTooManyRequests, info.StatusCode)
+			}
+		}
+	})
+
+	t.Run("error_shared_deadline", func(t *testing.T) {
+		var fallbackErr error
+
+		// the first provider uses the whole deadline up, the fallback gets none left
+		slow := NewProvider("hr", []Attribute{AttributeAge}, func(ctx context.Context, names []string, country string) ([]*external.ExternalResponse, error) {
+			<-ctx.Done()
+
+			return nil, ctx.Err()
+		})
+
+		fallback := NewProvider("agify", []Attribute{AttributeAge}, func(ctx context.Context, names []string, country string) ([]*external.ExternalResponse, error) {
+			fallbackErr = ctx.Err()
+
+			return nil, ctx.Err()
+		})
+
+		registry, err := NewRegistry(time.Millisecond*50, slow, fallback)
+		require.NoError(t, err)
+
+		_, err = registry.GetNameInfo(context.Background(), "Helen", "")
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.ErrorIs(t, fallbackErr, context.DeadlineExceeded)
+	})
+
+	t.Run("error_cancels_later", func(t *testing.T) {
+		var genderErr, nationErr error
+
+		// the later providers wait to be cancelled, the failure of the age decides the lookup
+		waiting := func(name string, attribute Attribute, dst *error) EnrichmentProvider {
+			return NewProvider(name, []Attribute{attribute}, func(ctx context.Context, names []string, country string) ([]*external.ExternalResponse, error) {
+				<-ctx.Done()
+				*dst = ctx.Err()
+
+				return nil, ctx.Err()
+			})
+		}
+
+		registry, err := NewRegistry(
+			time.Minute,
+			failingProvider("agify", AttributeAge),
+			waiting("genderize", AttributeGender, &genderErr),
+			waiting("nationalize", AttributeNation, &nationErr),
+		)
+		require.NoError(t, err)
+
+		_, err = registry.GetNameInfo(context.Background(), "Helen", "")
+		assert.Equal(t, external.ErrProviderUnavailable, errors.Cause(err))
+		assert.Equal(t, context.Canceled, genderErr)
+		assert.Equal(t, context.Canceled, nationErr)
+	})
+
+	t.Run("success_failure_not_decided", func(t *testing.T) {
+		var asked []string
+
+		// the gender failure is not final while another provider of the gender is left
+		registry, err := NewRegistry(
+			time.Second,
+			failingProvider("hr", AttributeGender),
+			ageProvider("agify", map[string]int{"Helen": 40}, &asked),
+			NewProvider("genderize", []Attribute{AttributeGender}, func(ctx context.Context, names []string, country string) ([]*external.ExternalResponse, error) {
+				return []*external.ExternalResponse{{Genderize: &external.GenderizeResponse{Gender: utils.StringToPtr("female")}}}, nil
+			}),
+		)
+		require.NoError(t, err)
+
+		info, err := registry.GetNameInfo(context.Background(), "Helen", "")
+		require.NoError(t, err)
+
+		assert.Equal(t, 40, *info.Agify.Age)
+		assert.Equal(t, "female", *info.Genderize.Gender)
+	})
+
+	t.Run("error_result_count", func(t *testing.T) {
+		providers := newTestRepository(t, agify, genderize, respond(http.StatusOK, `[]`)).Providers()
+
+		res, err := providers[2].Lookup(context.Background(), []string{"Helen"}, "")
+		assert.Nil(t, res)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,106 @@
+package person
+
+import (
+	"context"
+	"expvar"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultMaxAttempts = 3
+	defaultBaseDelay   = time.Millisecond * 200
+	defaultMaxDelay    = time.Second * 5
+
+	headerRetryAfter     = "Retry-After"
+	headerRateLimitReset = "X-Rate-Limit-Reset"
+)
+
+// retryStats is published on /debug/vars, retries are counted by reason.
+var retryStats = expvar.NewMap("enrichment_retries")
+
+// WithRetry sets how many times a request is sent at most and the bounds of the jittered
+// exponential backoff between the attempts. A single attempt disables retries.
+func WithRetry(maxAttempts int, baseDelay, maxDelay time.Duration) Option {
+	return func(a *APIRepository) {
+		a.maxAttempts, a.baseDelay, a.maxDelay = maxAttempts, baseDelay, maxDelay
+	}
+}
+
+// retryReason tells why a request is worth sending again, it is empty when it is not.
+func retryReason(res *http.Response, err error) string {
+	switch {
+	case err != nil:
+		return "transport_error"
+	case res.StatusCode == http.StatusTooManyRequests:
+		return "rate_limited"
+	case res.StatusCode >= http.StatusInternalServerError:
+		return "server_error"
+	default:
+		return ""
+	}
+}
+
+// backoff returns the delay before the attempt following the given one. The providers tell
+// when a rate limit is lifted, otherwise the delay grows exponentially with full jitter.
+func (a *APIRepository) backoff(attempt int, res *http.Response) time.Duration {
+	if res != nil && res.StatusCode == http.StatusTooManyRequests {
+		if delay, ok := rateLimitDelay(res.Header); ok {
+			return delay
+		}
+	}
+
+	delay := a.maxDelay
+
+	if shift := attempt - 1; shift < 32 && a.baseDelay<<shift < a.maxDelay {
+		delay = a.baseDelay << shift
+	}
+
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+func rateLimitDelay(header http.Header) (time.Duration, bool) {
+	if value := header.Get(headerRetryAfter); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second, true
+		}
+
+		if at, err := http.ParseTime(value); err == nil {
+			return max(time.Until(at), 0), true
+		}
+	}
+
+	if value := header.Get(headerRateLimitReset); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+
+	return 0, false
+}
+
+// canWait reports whether the delay fits both maxDelay and the deadline of ctx, there is no
+// point in waiting for a quota that is reset after the lookup has timed out.
+func (a *APIRepository) canWait(ctx context.Context, delay time.Duration) bool {
+	if delay > a.maxDelay {
+		return false
+	}
+
+	deadline, ok := ctx.Deadline()
+
+	return !ok || time.Until(deadline) > delay
+}
+
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,200 @@
+package person
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// sequence answers the requests with the given handlers in turn, repeating the last one.
+func sequence(requests *atomic.Int32, handlers ...http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		n := int(requests.Add(1))
+
+		handlers[min(n, len(handlers))-1](w, r)
+	}
+}
+
+func withHeader(key, value string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(key, value)
+		next(w, r)
+	}
+}
+
+// recordSleeps replaces waiting with recording the delays.
+func recordSleeps(repo *APIRepository) *[]time.Duration {
+	var delays []time.Duration
+
+	repo.sleep = func(ctx context.Context, delay time.Duration) error {
+		delays = append(delays, delay)
+
+		return nil
+	}
+
+	return &delays
+}
+
+func TestRetryLocal(t *testing.T) {
+	agify := respond(http.StatusOK, `[{"count":1,"name":"Helen","age":40}]`)
+	unavailable := respond(http.StatusServiceUnavailable, `{"error":"Service unavailable"}`)
+	limited := respond(http.StatusTooManyRequests, `{"error":"Request limit reached"}`)
+
+	t.Run("success_after_server_error", func(t *testing.T) {
+		var requests atomic.Int32
+
+		repo := newTestRepository(t, sequence(&requests, unavailable, unavailable, agify), agify, agify)
+		delays := recordSleeps(repo)
+
+		resp, err := lookupOne(context.Background(), repo.Providers()[0], "Helen")
+		require.NoError(t, err)
+
+		assert.Equal(t, 40, *resp.Agify.Age)
+		assert.Equal(t, http.StatusOK, resp.Agify.StatusCode)
+		assert.Equal(t, int32(3), requests.Load())
+
+		if assert.Len(t, *delays, 2) {
+			assert.LessOrEqual(t, (*delays)[0], defaultBaseDelay)
+			assert.LessOrEqual(t, (*delays)[1], defaultBaseDelay*2)
+		}
+	})
+
+	t.Run("success_retry_after", func(t *testing.T) {
+		var requests atomic.Int32
+
+		repo := newTestRepository(t, sequence(&requests, withHeader(headerRetryAfter, "2", limited), agify), agify, agify)
+		delays := recordSleeps(repo)
+
+		resp, err := lookupOne(context.Background(), repo.Providers()[0], "Helen")
+		require.NoError(t, err)
+
+		assert.Equal(t, 40, *resp.Agify.Age)
+		assert.Equal(t, []time.Duration{time.Second * 2}, *delays)
+	})
+
+	t.Run("success_rate_limit_reset", func(t *testing.T) {
+		var requests atomic.Int32
+
+		repo := newTestRepository(t, sequence(&requests, withHeader(headerRateLimitReset, "3", limited), agify), agify, agify)
+		delays := recordSleeps(repo)
+
+		resp, err := lookupOne(context.Background(), repo.Providers()[0], "Helen")
+		require.NoError(t, err)
+
+		assert.Equal(t, 40, *resp.Agify.Age)
+		assert.Equal(t, []time.Duration{time.Second * 3}, *delays)
+	})
+
+	t.Run("error_rate_limit_reset_too_late", func(t *testing.T) {
+		var requests atomic.Int32
+
+		repo := newTestRepository(t, sequence(&requests, withHeader(headerRateLimitReset, "3600", limited)), agify, agify)
+		delays := recordSleeps(repo)
+
+		resp, err := lookupOne(context.Background(), repo.Providers()[0], "Helen")
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		assert.Equal(t, int32(1), requests.Load())
+		assert.Empty(t, *delays)
+	})
+
+	t.Run("error_attempts_exhausted", func(t *testing.T) {
+		var requests atomic.Int32
+
+		repo := newTestRepository(t, sequence(&requests, unavailable), agify, agify)
+		recordSleeps(repo)
+
+		resp, err := lookupOne(context.Background(), repo.Providers()[0], "Helen")
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		assert.Equal(t, "Service unavailable", *resp.Error)
+		assert.Equal(t, int32(defaultMaxAttempts), requests.Load())
+	})
+
+	t.Run("error_client_error_not_retried", func(t *testing.T) {
+		var requests atomic.Int32
+
+		repo := newTestRepository(t, sequence(&requests, respond(http.StatusUnprocessableEntity, `{"error":"Invalid name"}`)), agify, agify)
+		recordSleeps(repo)
+
+		resp, err := lookupOne(context.Background(), repo.Providers()[0], "Helen")
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+		assert.Equal(t, int32(1), requests.Load())
+	})
+
+	t.Run("error_retry_disabled", func(t *testing.T) {
+		var requests atomic.Int32
+
+		repo := newTestRepository(t, sequence(&requests, unavailable, agify), agify, agify, WithRetry(1, time.Millisecond, time.Millisecond))
+
+		resp, err := lookupOne(context.Background(), repo.Providers()[0], "Helen")
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		assert.Equal(t, int32(1), requests.Load())
+	})
+
+	t.Run("error_canceled_while_waiting", func(t *testing.T) {
+		var requests atomic.Int32
+
+		repo := newTestRepository(t, sequence(&requests, withHeader(headerRetryAfter, "1", limited), agify), agify, agify)
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		time.AfterFunc(time.Millisecond*50, cancel)
+
+		resp, err := lookupOne(ctx, repo.Providers()[0], "Helen")
+		assert.Nil(t, resp)
+
+		if assert.Error(t, err) {
+			assert.ErrorIs(t, err, context.Canceled)
+		}
+
+		assert.Equal(t, int32(1), requests.Load())
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	repo := NewRepository(WithRetry(10, time.Millisecond*100, time.Second))
+
+	for attempt := 1; attempt <= 10; attempt++ {
+		limit := min(time.Millisecond*100<<(attempt-1), time.Second)
+
+		t.Run(fmt.Sprintf("attempt_%d", attempt), func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				delay := repo.backoff(attempt, nil)
+
+				assert.GreaterOrEqual(t, delay, time.Duration(0))
+				assert.LessOrEqual(t, delay, limit)
+			}
+		})
+	}
+}
+
+func TestRateLimitDelay(t *testing.T) {
+	t.Run("success_http_date", func(t *testing.T) {
+		header := http.Header{}
+		header.Set(headerRetryAfter, time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+
+		delay, ok := rateLimitDelay(header)
+		assert.True(t, ok)
+		assert.InDelta(t, time.Minute, delay, float64(time.Second*2))
+	})
+
+	t.Run("error_invalid", func(t *testing.T) {
+		header := http.Header{}
+		header.Set(headerRetryAfter, "soon")
+
+		_, ok := rateLimitDelay(header)
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"github.com/pkg/errors"
+	"time"
+)
+
+const (
+	timeout      = time.Second * 2
+	sweepTimeout = time.Second * 30
+)
+
+// CacheRepository keeps enrichment responses as raw JSON, so cached entries survive restarts.
+type CacheRepository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *CacheRepository {
+	return &CacheRepository{
+		db: db,
+	}
+}
+
+// Get returns nil without an error when the key is missing or the entry has expired, otherwise
+// the value with the time it has left to live. An expired entry is deleted on the way.
+func (r *CacheRepository) Get(ctx context.Context, key string) ([]byte, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	query := `
+		with expired as (
+		    delete
+		    from persons.enrichment_cache
+		    where key = $1
+		      and expires_at <= now()
+		)
+		select response, extract(epoch from expires_at - now())
+		from persons.enrichment_cache
+		where key = $1
+		  and expires_at > now()
+	`
+
+	var (
+		value   []byte
+		seconds float64
+	)
+
+	if err := r.db.QueryRowContext(ctx, query, key).Scan(&value, &seconds); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, 0, nil
+		}
+
+		return nil, 0, errors.Wrap(err, "Get #1")
+	}
+
+	return value, time.Duration(seconds * float64(time.Second)), nil
+}
+
+// DeleteExpired sweeps the expired entries Get is never asked about again and returns their number.
+func (r *CacheRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, sweepTimeout)
+	defer cancel()
+
+	query := `
+		delete
+		from persons.enrichment_cache
+		where expires_at <= now()
+	`
+
+	res, err := r.db.ExecContext(ctx, query)
+	if err != nil {
+		return 0, errors.Wrap(err, "DeleteExpired #1")
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "DeleteExpired #2")
+	}
+
+	return deleted, nil
+}
+
+func (r *CacheRepository) Put(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	query := `
+		insert into persons.enrichment_cache (key, response, expires_at)
+		values ($1, $2, now() + make_interval(secs => $3))
+		on conflict (key) do update
+			set response   = excluded.response,
+				expires_at = excluded.expires_at
+	`
+
+	// the response is sent as text, a []byte argument would be encoded as bytea
+	if _, err := r.db.ExecContext(ctx, query, key, string(value), ttl.Seconds()); err != nil {
+		return errors.Wrap(err, "Put #1")
+	}
+
+	return nil
+}
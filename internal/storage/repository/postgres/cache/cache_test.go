@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func connectToDB() (*sql.DB, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err = godotenv.Load(filepath.Join(filepath.Dir(wd), "../../../..", ".env")); err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := sql.Open(
+		"postgres",
+		fmt.Sprintf(
+			"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+			os.Getenv("DB_HOST_TEST"),
+			os.Getenv("DB_PORT_TEST"),
+			os.Getenv("DB_USER_TEST"),
+			os.Getenv("DB_PASSWORD_TEST"),
+			os.Getenv("DB_NAME_TEST"),
+		),
+	)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	timeout, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	if err = db.PingContext(timeout); err != nil {
+		log.Fatal(err)
+	}
+
+	return db, nil
+}
+
+func TestCache(t *testing.T) {
+	db, err := connectToDB()
+
+	require.NoError(t, err)
+	require.NotNil(t, db)
+
+	repo := NewRepository(db)
+
+	key := fmt.Sprintf("test-%d|", time.Now().UnixNano())
+
+	t.Cleanup(func() {
+		_, err := db.Exec("delete from persons.enrichment_cache where key = $1", key)
+		assert.NoError(t, err)
+	})
+
+	t.Run("success_miss", func(t *testing.T) {
+		value, _, err := repo.Get(context.Background(), key)
+		assert.NoError(t, err)
+		assert.Nil(t, value)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		require.NoError(t, repo.Put(context.Background(), key, []byte(`{"age": 1}`), time.Minute))
+		require.NoError(t, repo.Put(context.Background(), key, []byte(`{"age": 2}`), time.Minute))
+
+		value, ttl, err := repo.Get(context.Background(), key)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"age": 2}`, string(value))
+		assert.InDelta(t, time.Minute, ttl, float64(time.Second*5))
+	})
+
+	t.Run("success_expired", func(t *testing.T) {
+		require.NoError(t, repo.Put(context.Background(), key, []byte(`{"age": 3}`), -time.Minute))
+
+		value, _, err := repo.Get(context.Background(), key)
+		assert.NoError(t, err)
+		assert.Nil(t, value)
+
+		var count int
+
+		require.NoError(t, db.QueryRow("select count(*) from persons.enrichment_cache where key = $1", key).Scan(&count))
+		assert.Equal(t, 0, count)
+	})
+
+	t.Run("success_delete_expired", func(t *testing.T) {
+		live := key + "live"
+
+		t.Cleanup(func() {
+			_, err := db.Exec("delete from persons.enrichment_cache where key = $1", live)
+			assert.NoError(t, err)
+		})
+
+		require.NoError(t, repo.Put(context.Background(), key, []byte(`{"age": 4}`), -time.Minute))
+		require.NoError(t, repo.Put(context.Background(), live, []byte(`{"age": 5}`), time.Minute))
+
+		deleted, err := repo.DeleteExpired(context.Background())
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, deleted, int64(1))
+
+		var keys []string
+
+		rows, err := db.Query("select key from persons.enrichment_cache where key in ($1, $2)", key, live)
+		require.NoError(t, err)
+
+		defer rows.Close()
+
+		for rows.Next() {
+			var k string
+
+			require.NoError(t, rows.Scan(&k))
+
+			keys = append(keys, k)
+		}
+
+		require.NoError(t, rows.Err())
+		assert.Equal(t, []string{live}, keys)
+	})
+}
@@ -0,0 +1,101 @@
+package person
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"namer/internal/domain"
+	"namer/pkg/query"
+)
+
+const historyQueryAlias = "ph"
+
+var historyColumns = map[string]query.Column{
+	"id":         {Name: "id", Type: query.TypeInt, NotNull: true, Bits: 64},
+	"person_id":  {Name: "person_id", Type: query.TypeInt, NotNull: true, Bits: 64},
+	"operation":  {Name: "operation", Type: query.TypeEnum, NotNull: true, Values: []string{"create", "update", "delete", "restore", "purge"}},
+	"actor":      {Name: "actor", Type: query.TypeText},
+	"request_id": {Name: "request_id", Type: query.TypeText},
+	"changed_at": {Name: "changed_at", Type: query.TypeTimestamp, NotNull: true},
+}
+
+func NewHistoryQueryBuilder() *query.Builder {
+	return query.NewBuilder(historyQueryAlias, queryKey, historyColumns)
+}
+
+func (r *PersonRepository) GetHistory(ctx context.Context, q *query.Query) ([]domain.PersonHistory, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	query := fmt.Sprintf(`
+		select ph.id,
+			   ph.person_id,
+			   ph.operation,
+			   ph.old_values,
+			   ph.new_values,
+			   ph.actor,
+			   ph.request_id,
+			   ph.changed_at
+		from persons.person_history as ph %s %s
+		%s %s
+	`, q.Where, q.Seek, q.OrderBy, q.Pagination)
+
+	rows, err := r.db.QueryContext(ctx, query, q.Args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetHistory #1")
+	}
+
+	defer rows.Close()
+
+	history := make([]domain.PersonHistory, 0)
+
+	for rows.Next() {
+		var (
+			entry                domain.PersonHistory
+			oldValues, newValues []byte
+		)
+
+		if err = rows.Scan(
+			&entry.ID,
+			&entry.PersonID,
+			&entry.Operation,
+			&oldValues,
+			&newValues,
+			&entry.Actor,
+			&entry.RequestID,
+			&entry.ChangedAt,
+		); err != nil {
+			return nil, errors.Wrap(err, "GetHistory #2")
+		}
+
+		entry.OldValues, entry.NewValues = oldValues, newValues
+
+		history = append(history, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "GetHistory #3")
+	}
+
+	return history, nil
+}
+
+// CountHistory returns the number of history entries matching the query filter. The
+// history of a single person is small, so the count is always exact.
+func (r *PersonRepository) CountHistory(ctx context.Context, q *query.Query) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	query := fmt.Sprintf(`
+		select count(*)
+		from persons.person_history as ph %s
+	`, q.Where)
+
+	var count int
+
+	if err := r.db.QueryRowContext(ctx, query, q.CountArgs()...).Scan(&count); err != nil {
+		return 0, errors.Wrap(err, "CountHistory #1")
+	}
+
+	return count, nil
+}
@@ -0,0 +1,56 @@
+package person
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"namer/internal/domain"
+	"testing"
+)
+
+func TestGetHistory(t *testing.T) {
+	db, err := connectToDB()
+
+	require.NoError(t, err)
+	require.NotNil(t, db)
+
+	repo := NewRepository(db)
+
+	t.Run("success", func(t *testing.T) {
+		req := domain.Person{
+			Name:    "Test",
+			Surname: "Test",
+		}
+
+		createPerson(t, repo, &req)
+
+		req.Name = "Test1"
+
+		require.NoError(t, repo.Update(context.Background(), &req, nil, testAudit))
+
+		deletePerson(t, repo, &req)
+
+		q, err := NewHistoryQueryBuilder().Build(&domain.FilterWithPagination{
+			Filter: []domain.Filter{
+				{Field: "person_id", Value: req.ID},
+			},
+		})
+		require.NoError(t, err)
+
+		history, err := repo.GetHistory(context.Background(), q)
+		require.NoError(t, err)
+
+		if assert.Len(t, history, 3) {
+			assert.Equal(t, "delete", history[0].Operation)
+			assert.Equal(t, "update", history[1].Operation)
+			assert.Equal(t, "create", history[2].Operation)
+			assert.Nil(t, history[2].OldValues)
+			assert.Equal(t, testAudit.Actor, *history[0].Actor)
+			assert.Equal(t, testAudit.RequestID, *history[0].RequestID)
+		}
+
+		count, err := repo.CountHistory(context.Background(), q)
+		require.NoError(t, err)
+		assert.Equal(t, 3, count)
+	})
+}
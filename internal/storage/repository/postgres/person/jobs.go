@@ -0,0 +1,445 @@
+package person
+
+import (
+	"context"
+	"database/sql"
+	"github.com/pkg/errors"
+	"namer/internal/domain"
+	"time"
+)
+
+func enqueue(ctx context.Context, tx *sql.Tx, personID int) error {
+	query := `
+		insert into persons.enrichment_jobs (person_id)
+		values ($1)
+	`
+
+	if _, err := tx.ExecContext(ctx, query, personID); err != nil {
+		return errors.Wrap(err, "enqueue #1")
+	}
+
+	return nil
+}
+
+// ClaimJobs marks up to limit due jobs as running and returns them with the name, the nation
+// and the version of their persons. Concurrent workers skip the jobs claimed by each other, a
+// running job whose worker has not reported back within lease is claimed again. Jobs of
+// deleted persons wait until the person is restored or purged.
+func (r *PersonRepository) ClaimJobs(ctx context.Context, limit int, lease time.Duration) ([]domain.EnrichmentJob, error) {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	query := `
+		with next as (
+		    select j.id
+		    from persons.enrichment_jobs as j
+		        join persons.persons_table as p on p.id = j.person_id
+		    where j.run_at <= now()
+		      and p.deleted_at is null
+		      and (j.status = 'queued' or j.status = 'running' and j.locked_at < now() - make_interval(secs => $2))
+		    order by j.run_at, j.id
+		    limit $1
+		    for update of j skip locked
+		)
+		update persons.enrichment_jobs as j
+		set status = 'running',
+		    attempts = j.attempts + 1,
+		    locked_at = now(),
+		    updated_at = now()
+		from next, persons.persons_table as p
+		where j.id = next.id
+		  and p.id = j.person_id
+		returning j.id, j.person_id, j.status, j.attempts, j.run_at, j.last_error, j.created_at, j.updated_at, p.name, p.nation, p.version
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, errors.Wrap(err, "ClaimJobs #1")
+	}
+
+	defer rows.Close()
+
+	jobs := make([]domain.EnrichmentJob, 0)
+
+	for rows.Next() {
+		var (
+			job    domain.EnrichmentJob
+			person domain.Person
+		)
+
+		if err = rows.Scan(
+			&job.ID,
+			&job.PersonID,
+			&job.Status,
+			&job.Attempts,
+			&job.RunAt,
+			&job.LastError,
+			&job.CreatedAt,
+			&job.UpdatedAt,
+			&person.Name,
+			&person.Nation,
+			&person.Version,
+		); err != nil {
+			return nil, errors.Wrap(err, "ClaimJobs #2")
+		}
+
+		person.ID = job.PersonID
+		job.Person = &person
+
+		jobs = append(jobs, job)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "ClaimJobs #3")
+	}
+
+	return jobs, nil
+}
+
+// closeJob moves the job claimed for the attempt to status, it returns domain.ErrLeaseLost when
+// the job is no longer running under that claim.
+func closeJob(ctx context.Context, tx *sql.Tx, id int64, attempts int, status string, reason *string) error {
+	query := `
+		update persons.enrichment_jobs
+		set status = $3,
+		    locked_at = null,
+		    last_error = $4,
+		    updated_at = now()
+		where id = $1
+		  and status = 'running'
+		  and attempts = $2
+	`
+
+	res, err := tx.ExecContext(ctx, query, id, attempts, status, reason)
+	if err != nil {
+		return errors.Wrap(err, "closeJob #1")
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "closeJob #2")
+	}
+
+	if affected != 1 {
+		return errors.Wrap(domain.ErrLeaseLost, "closeJob #3")
+	}
+
+	return nil
+}
+
+// CompleteJob stores what the providers found out about the person and closes the job claimed
+// for the attempt. The nation and its confidence are written as given while the person is
+// still at req.Version, the other columns only when they are empty: a value set by a client in
+// the meantime wins and keeps its confidence. The nationalities found are stored as they are,
+// unless the person was enriched another way in the meantime.
+func (r *PersonRepository) CompleteJob(ctx context.Context, id int64, attempts int, req *domain.Person, audit domain.Audit) error {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	personQuery := `
+		update persons.persons_table
+		set age = coalesce(age, $1),
+		    age_count = case when age is null then $4 else age_count end,
+		    gender = coalesce(gender, $2),
+		    gender_probability = case when gender is null then $5 else gender_probability end,
+		    gender_count = case when gender is null then $6 else gender_count end,
+		    nation = case when version = $10 then $3 else coalesce(nation, $3) end,
+		    nation_probability = case when version = $10 or nation is null then $7 else nation_probability end,
+		    nation_count = case when version = $10 or nation is null then $8 else nation_count end,
+		    enrichment_status = 'done',
+		    enriched_at = now()
+		where id = $9
+		  and enrichment_status = 'pending'
+	`
+
+	if err := r.inTx(ctx, audit, func(tx *sql.Tx) error {
+		if err := closeJob(ctx, tx, id, attempts, domain.JobDone, nil); err != nil {
+			return err
+		}
+
+		res, err := tx.ExecContext(
+			ctx,
+			personQuery,
+			req.Age,
+			req.Gender,
+			req.Nation,
+			req.AgeCount,
+			req.GenderProbability,
+			req.GenderCount,
+			req.NationProbability,
+			req.NationCount,
+			req.ID,
+			req.Version,
+		)
+		if err != nil {
+			return err
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		// a person enriched another way in the meantime keeps its nationalities
+		if affected != 1 || len(req.Nationalities) == 0 {
+			return nil
+		}
+
+		return saveNationalities(ctx, tx, req.ID, req.Nationalities)
+	}); err != nil {
+		return errors.Wrap(err, "CompleteJob #1")
+	}
+
+	return nil
+}
+
+// Reenrich overwrites age, gender, nation and their confidence with a fresh lookup and marks the person enriched,
+// the write is conditional on version. Nationalities are replaced unless the lookup found none.
+// Queued jobs of the person are closed, dead ones stay for a manual retry.
+func (r *PersonRepository) Reenrich(ctx context.Context, req *domain.Person, version int, audit domain.Audit) error {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	personQuery := `
+		update persons.persons_table
+		set age = $1,
+		    gender = $2,
+		    nation = $3,
+		    age_count = $4,
+		    gender_probability = $5,
+		    gender_count = $6,
+		    nation_probability = $7,
+		    nation_count = $8,
+		    enrichment_status = 'done',
+		    enriched_at = now()
+		where id = $9
+		  and deleted_at is null
+		  and version = $10
+		returning name, surname, patronymic, age, gender, nation, age_count, gender_probability, gender_count, nation_probability, nation_count, created_at, updated_at, version, enrichment_status, enriched_at;
+	`
+
+	jobQuery := `
+		update persons.enrichment_jobs
+		set status = 'done',
+		    locked_at = null,
+		    last_error = null,
+		    updated_at = now()
+		where person_id = $1
+		  and status = 'queued'
+	`
+
+	if err := r.inTx(ctx, audit, func(tx *sql.Tx) error {
+		if err := tx.QueryRowContext(
+			ctx,
+			personQuery,
+			req.Age,
+			req.Gender,
+			req.Nation,
+			req.AgeCount,
+			req.GenderProbability,
+			req.GenderCount,
+			req.NationProbability,
+			req.NationCount,
+			req.ID,
+			version,
+		).Scan(
+			&req.Name,
+			&req.Surname,
+			&req.Patronymic,
+			&req.Age,
+			&req.Gender,
+			&req.Nation,
+			&req.AgeCount,
+			&req.GenderProbability,
+			&req.GenderCount,
+			&req.NationProbability,
+			&req.NationCount,
+			&req.CreatedAt,
+			&req.UpdatedAt,
+			&req.Version,
+			&req.EnrichmentStatus,
+			&req.EnrichedAt,
+		); err != nil {
+			return err
+		}
+
+		if len(req.Nationalities) != 0 {
+			if err := saveNationalities(ctx, tx, req.ID, req.Nationalities); err != nil {
+				return err
+			}
+		}
+
+		_, err := tx.ExecContext(ctx, jobQuery, req.ID)
+
+		return err
+	}); err != nil {
+		if err == sql.ErrNoRows {
+			return errors.Wrap(r.checkExists(ctx, req.ID, false), "Reenrich #1")
+		}
+
+		return errors.Wrap(err, "Reenrich #2")
+	}
+
+	return errors.Wrap(loadNationalities(ctx, r.db, req), "Reenrich #3")
+}
+
+// RetryJob puts the job claimed for the attempt back in the queue, it is claimed again once
+// delay has passed. It returns domain.ErrLeaseLost when the claim is gone.
+func (r *PersonRepository) RetryJob(ctx context.Context, id int64, attempts int, delay time.Duration, reason string) error {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	query := `
+		update persons.enrichment_jobs
+		set status = 'queued',
+		    run_at = now() + make_interval(secs => $3),
+		    locked_at = null,
+		    last_error = $4,
+		    updated_at = now()
+		where id = $1
+		  and status = 'running'
+		  and attempts = $2
+	`
+
+	res, err := r.db.ExecContext(ctx, query, id, attempts, delay.Seconds(), reason)
+	if err != nil {
+		return errors.Wrap(err, "RetryJob #1")
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "RetryJob #2")
+	}
+
+	if affected != 1 {
+		return errors.Wrap(domain.ErrLeaseLost, "RetryJob #3")
+	}
+
+	return nil
+}
+
+// KillJob moves the job claimed for the attempt to the dead letters and marks the enrichment
+// of its person as failed.
+func (r *PersonRepository) KillJob(ctx context.Context, id int64, attempts int, personID int, reason string, audit domain.Audit) error {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	personQuery := `
+		update persons.persons_table
+		set enrichment_status = 'failed'
+		where id = $1
+		  and enrichment_status = 'pending'
+	`
+
+	if err := r.inTx(ctx, audit, func(tx *sql.Tx) error {
+		if err := closeJob(ctx, tx, id, attempts, domain.JobDead, &reason); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, personQuery, personID)
+
+		return err
+	}); err != nil {
+		return errors.Wrap(err, "KillJob #1")
+	}
+
+	return nil
+}
+
+// GetJobs returns up to limit jobs with the status, the most recently changed first.
+func (r *PersonRepository) GetJobs(ctx context.Context, status string, limit int) ([]domain.EnrichmentJob, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	query := `
+		select id, person_id, status, attempts, run_at, last_error, created_at, updated_at
+		from persons.enrichment_jobs
+		where status = $1
+		order by updated_at desc, id desc
+		limit $2
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, status, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetJobs #1")
+	}
+
+	defer rows.Close()
+
+	jobs := make([]domain.EnrichmentJob, 0)
+
+	for rows.Next() {
+		var job domain.EnrichmentJob
+
+		if err = rows.Scan(
+			&job.ID,
+			&job.PersonID,
+			&job.Status,
+			&job.Attempts,
+			&job.RunAt,
+			&job.LastError,
+			&job.CreatedAt,
+			&job.UpdatedAt,
+		); err != nil {
+			return nil, errors.Wrap(err, "GetJobs #2")
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "GetJobs #3")
+	}
+
+	return jobs, nil
+}
+
+// RequeueJob gives a dead job a fresh set of attempts and marks its person pending again.
+// It returns sql.ErrNoRows when there is no dead job with the id.
+func (r *PersonRepository) RequeueJob(ctx context.Context, id int64, audit domain.Audit) (*domain.EnrichmentJob, error) {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	jobQuery := `
+		update persons.enrichment_jobs
+		set status = 'queued',
+		    attempts = 0,
+		    run_at = now(),
+		    updated_at = now()
+		where id = $1
+		  and status = 'dead'
+		returning id, person_id, status, attempts, run_at, last_error, created_at, updated_at
+	`
+
+	personQuery := `
+		update persons.persons_table
+		set enrichment_status = 'pending'
+		where id = $1
+		  and enrichment_status = 'failed'
+	`
+
+	var job domain.EnrichmentJob
+
+	if err := r.inTx(ctx, audit, func(tx *sql.Tx) error {
+		if err := tx.QueryRowContext(ctx, jobQuery, id).Scan(
+			&job.ID,
+			&job.PersonID,
+			&job.Status,
+			&job.Attempts,
+			&job.RunAt,
+			&job.LastError,
+			&job.CreatedAt,
+			&job.UpdatedAt,
+		); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, personQuery, job.PersonID)
+
+		return err
+	}); err != nil {
+		return nil, errors.Wrap(err, "RequeueJob #1")
+	}
+
+	return &job, nil
+}
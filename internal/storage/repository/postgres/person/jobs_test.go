@@ -0,0 +1,272 @@
+package person
+
+import (
+	"context"
+	"database/sql"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"namer/internal/domain"
+	"namer/pkg/utils"
+	"testing"
+	"time"
+)
+
+// claimJob claims due jobs until it finds the one of the person.
+func claimJob(t *testing.T, repo *PersonRepository, personID int) *domain.EnrichmentJob {
+	jobs, err := repo.ClaimJobs(context.Background(), 1000, time.Minute)
+	require.NoError(t, err)
+
+	for i := range jobs {
+		if jobs[i].PersonID == personID {
+			return &jobs[i]
+		}
+	}
+
+	require.FailNow(t, "job not claimed")
+
+	return nil
+}
+
+func TestJobs(t *testing.T) {
+	db, err := connectToDB()
+
+	require.NoError(t, err)
+	require.NotNil(t, db)
+
+	repo := NewRepository(db)
+
+	t.Run("success_complete", func(t *testing.T) {
+		req := domain.Person{
+			Name:             "Test",
+			Surname:          "Test",
+			Nation:           utils.StringToPtr("SE"),
+			EnrichmentStatus: domain.EnrichmentPending,
+		}
+
+		createPerson(t, repo, &req)
+
+		job := claimJob(t, repo, req.ID)
+
+		assert.Equal(t, domain.JobRunning, job.Status)
+		assert.Equal(t, 1, job.Attempts)
+		assert.Equal(t, "Test", job.Person.Name)
+
+		assert.Equal(t, req.Version, job.Person.Version)
+
+		job.Person.Age, job.Person.Nation = utils.IntToPtr(40), utils.StringToPtr("GB")
+		job.Person.NationProbability = utils.Float64ToPtr(0.1)
+
+		require.NoError(t, repo.CompleteJob(context.Background(), job.ID, job.Attempts, job.Person, testAudit))
+
+		person, err := repo.GetByID(context.Background(), req.ID)
+		require.NoError(t, err)
+
+		// the nation is resolved by the caller, as for a person enriched right away
+		assert.Equal(t, domain.EnrichmentDone, person.EnrichmentStatus)
+		assert.Equal(t, 40, *person.Age)
+		assert.Equal(t, "GB", *person.Nation)
+		assert.Equal(t, 0.1, *person.NationProbability)
+
+		deletePerson(t, repo, &req)
+	})
+
+	t.Run("success_complete_after_client_change", func(t *testing.T) {
+		req := domain.Person{
+			Name:             "Test",
+			Surname:          "Test",
+			Nation:           utils.StringToPtr("SE"),
+			EnrichmentStatus: domain.EnrichmentPending,
+		}
+
+		createPerson(t, repo, &req)
+
+		job := claimJob(t, repo, req.ID)
+
+		_, err := repo.Patch(context.Background(), &domain.PersonPatch{ID: req.ID, Nation: domain.NewField("NO")}, nil, testAudit)
+		require.NoError(t, err)
+
+		job.Person.Nation, job.Person.NationProbability = utils.StringToPtr("GB"), utils.Float64ToPtr(0.1)
+
+		require.NoError(t, repo.CompleteJob(context.Background(), job.ID, job.Attempts, job.Person, testAudit))
+
+		person, err := repo.GetByID(context.Background(), req.ID)
+		require.NoError(t, err)
+
+		assert.Equal(t, "NO", *person.Nation)
+		assert.Nil(t, person.NationProbability)
+
+		deletePerson(t, repo, &req)
+	})
+
+	t.Run("success_complete_after_reenrich", func(t *testing.T) {
+		req := domain.Person{
+			Name:             "Test",
+			Surname:          "Test",
+			EnrichmentStatus: domain.EnrichmentPending,
+		}
+
+		createPerson(t, repo, &req)
+
+		job := claimJob(t, repo, req.ID)
+
+		req.Nationalities = []domain.Nationality{{CountryID: "NO", Probability: 0.3, Rank: 1}}
+		require.NoError(t, repo.Reenrich(context.Background(), &req, req.Version, testAudit))
+
+		job.Person.Nationalities = []domain.Nationality{{CountryID: "GB", Probability: 0.1, Rank: 1}}
+		require.NoError(t, repo.CompleteJob(context.Background(), job.ID, job.Attempts, job.Person, testAudit))
+
+		person, err := repo.GetByID(context.Background(), req.ID)
+		require.NoError(t, err)
+
+		if assert.Len(t, person.Nationalities, 1) {
+			assert.Equal(t, "NO", person.Nationalities[0].CountryID)
+		}
+
+		deletePerson(t, repo, &req)
+	})
+
+	t.Run("error_lease_lost", func(t *testing.T) {
+		req := domain.Person{
+			Name:             "Test",
+			Surname:          "Test",
+			EnrichmentStatus: domain.EnrichmentPending,
+		}
+
+		createPerson(t, repo, &req)
+
+		job := claimJob(t, repo, req.ID)
+		stale := *job
+
+		stale.Attempts--
+
+		err := repo.CompleteJob(context.Background(), stale.ID, stale.Attempts, job.Person, testAudit)
+		assert.Equal(t, domain.ErrLeaseLost, errors.Cause(err))
+
+		err = repo.KillJob(context.Background(), stale.ID, stale.Attempts, stale.PersonID, "Invalid name", testAudit)
+		assert.Equal(t, domain.ErrLeaseLost, errors.Cause(err))
+
+		person, err := repo.GetByID(context.Background(), req.ID)
+		require.NoError(t, err)
+		assert.Equal(t, domain.EnrichmentPending, person.EnrichmentStatus)
+
+		require.NoError(t, repo.CompleteJob(context.Background(), job.ID, job.Attempts, job.Person, testAudit))
+
+		deletePerson(t, repo, &req)
+	})
+
+	t.Run("success_retry_and_dead_letter", func(t *testing.T) {
+		req := domain.Person{
+			Name:             "Test",
+			Surname:          "Test",
+			EnrichmentStatus: domain.EnrichmentPending,
+		}
+
+		createPerson(t, repo, &req)
+
+		job := claimJob(t, repo, req.ID)
+
+		require.NoError(t, repo.RetryJob(context.Background(), job.ID, job.Attempts, 0, "provider down"))
+
+		// the job is no longer running under the first claim
+		err := repo.RetryJob(context.Background(), job.ID, job.Attempts, 0, "provider down")
+		assert.Equal(t, domain.ErrLeaseLost, errors.Cause(err))
+
+		job = claimJob(t, repo, req.ID)
+		assert.Equal(t, 2, job.Attempts)
+		assert.Equal(t, "provider down", *job.LastError)
+
+		require.NoError(t, repo.KillJob(context.Background(), job.ID, job.Attempts, job.PersonID, "Invalid name", testAudit))
+
+		person, err := repo.GetByID(context.Background(), req.ID)
+		require.NoError(t, err)
+		assert.Equal(t, domain.EnrichmentFailed, person.EnrichmentStatus)
+
+		dead, err := repo.GetJobs(context.Background(), domain.JobDead, 100)
+		require.NoError(t, err)
+
+		if assert.NotEmpty(t, dead) {
+			assert.Equal(t, job.ID, dead[0].ID)
+		}
+
+		requeued, err := repo.RequeueJob(context.Background(), job.ID, testAudit)
+		require.NoError(t, err)
+
+		assert.Equal(t, domain.JobQueued, requeued.Status)
+		assert.Equal(t, 0, requeued.Attempts)
+
+		person, err = repo.GetByID(context.Background(), req.ID)
+		require.NoError(t, err)
+		assert.Equal(t, domain.EnrichmentPending, person.EnrichmentStatus)
+
+		_, err = repo.RequeueJob(context.Background(), job.ID, testAudit)
+		assert.Equal(t, sql.ErrNoRows, errors.Cause(err))
+
+		deletePerson(t, repo, &req)
+	})
+	t.Run("success_reenrich", func(t *testing.T) {
+		req := domain.Person{
+			Name:             "Test",
+			Surname:          "Test",
+			EnrichmentStatus: domain.EnrichmentPending,
+		}
+
+		createPerson(t, repo, &req)
+		assert.Nil(t, req.EnrichedAt)
+
+		version := req.Version
+
+		req.Age, req.Gender, req.Nation = utils.IntToPtr(41), utils.StringToPtr("male"), utils.StringToPtr("NO")
+
+		require.NoError(t, repo.Reenrich(context.Background(), &req, version, testAudit))
+
+		assert.Equal(t, domain.EnrichmentDone, req.EnrichmentStatus)
+		assert.Equal(t, version+1, req.Version)
+		assert.NotNil(t, req.EnrichedAt)
+
+		queued, err := repo.GetJobs(context.Background(), domain.JobQueued, 100)
+		require.NoError(t, err)
+
+		for _, job := range queued {
+			assert.NotEqual(t, req.ID, job.PersonID)
+		}
+
+		err = repo.Reenrich(context.Background(), &req, version, testAudit)
+		assert.Equal(t, domain.ErrVersionMismatch, errors.Cause(err))
+
+		deletePerson(t, repo, &req)
+	})
+
+	t.Run("success_reenrich_keeps_dead_job", func(t *testing.T) {
+		req := domain.Person{
+			Name:             "Test",
+			Surname:          "Test",
+			EnrichmentStatus: domain.EnrichmentPending,
+		}
+
+		createPerson(t, repo, &req)
+
+		job := claimJob(t, repo, req.ID)
+
+		require.NoError(t, repo.KillJob(context.Background(), job.ID, job.Attempts, job.PersonID, "Invalid name", testAudit))
+
+		person, err := repo.GetByID(context.Background(), req.ID)
+		require.NoError(t, err)
+
+		person.Age = utils.IntToPtr(41)
+		require.NoError(t, repo.Reenrich(context.Background(), person, person.Version, testAudit))
+
+		dead, err := repo.GetJobs(context.Background(), domain.JobDead, 100)
+		require.NoError(t, err)
+
+		ids := make([]int64, len(dead))
+
+		for i := range dead {
+			ids[i] = dead[i].ID
+		}
+
+		assert.Contains(t, ids, job.ID)
+
+		deletePerson(t, repo, &req)
+	})
+}
@@ -0,0 +1,126 @@
+package person
+
+import (
+	"context"
+	"database/sql"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"namer/internal/domain"
+	"namer/pkg/query"
+)
+
+var nationalitiesRelation = &query.Relation{
+	Table:      "persons.person_nationalities",
+	Alias:      "pn",
+	ForeignKey: "person_id",
+	Columns: map[string]query.Column{
+		"country_id":  {Name: "country_id", Type: query.TypeText, NotNull: true},
+		"probability": {Name: "probability", Type: query.TypeFloat, NotNull: true},
+		"rank":        {Name: "rank", Type: query.TypeInt, NotNull: true, Bits: 16},
+	},
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// saveNationalities replaces the nationalities of the person.
+func saveNationalities(ctx context.Context, tx *sql.Tx, personID int, nationalities []domain.Nationality) error {
+	deleteQuery := `
+		delete from persons.person_nationalities
+		where person_id = $1
+	`
+
+	insertQuery := `
+		insert into persons.person_nationalities (person_id, rank, country_id, probability)
+		select $1, *
+		from unnest($2::smallint[], $3::varchar[], $4::double precision[])
+	`
+
+	if _, err := tx.ExecContext(ctx, deleteQuery, personID); err != nil {
+		return errors.Wrap(err, "saveNationalities #1")
+	}
+
+	if len(nationalities) == 0 {
+		return nil
+	}
+
+	var (
+		ranks         = make([]int64, len(nationalities))
+		countries     = make([]string, len(nationalities))
+		probabilities = make([]float64, len(nationalities))
+	)
+
+	for i, n := range nationalities {
+		ranks[i], countries[i], probabilities[i] = int64(n.Rank), n.CountryID, n.Probability
+	}
+
+	if _, err := tx.ExecContext(
+		ctx,
+		insertQuery,
+		personID,
+		pq.Array(ranks),
+		pq.Array(countries),
+		pq.Array(probabilities),
+	); err != nil {
+		return errors.Wrap(err, "saveNationalities #2")
+	}
+
+	return nil
+}
+
+// loadNationalities fills in the nationalities of the persons, most probable first.
+func loadNationalities(ctx context.Context, q queryer, persons ...*domain.Person) error {
+	if len(persons) == 0 {
+		return nil
+	}
+
+	query := `
+		select person_id, rank, country_id, probability
+		from persons.person_nationalities
+		where person_id = any($1)
+		order by person_id, rank
+	`
+
+	byID := make(map[int]*domain.Person, len(persons))
+	ids := make([]int64, 0, len(persons))
+
+	for _, person := range persons {
+		person.Nationalities = make([]domain.Nationality, 0)
+		byID[person.ID] = person
+		ids = append(ids, int64(person.ID))
+	}
+
+	rows, err := q.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return errors.Wrap(err, "loadNationalities #1")
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			personID    int
+			nationality domain.Nationality
+		)
+
+		if err = rows.Scan(
+			&personID,
+			&nationality.Rank,
+			&nationality.CountryID,
+			&nationality.Probability,
+		); err != nil {
+			return errors.Wrap(err, "loadNationalities #2")
+		}
+
+		if person, ok := byID[personID]; ok {
+			person.Nationalities = append(person.Nationalities, nationality)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return errors.Wrap(err, "loadNationalities #3")
+	}
+
+	return nil
+}
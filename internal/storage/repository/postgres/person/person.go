@@ -1,12 +1,50 @@
 package person
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"github.com/pkg/errors"
 	"namer/internal/domain"
+	"namer/pkg/query"
+	"strings"
+	"time"
 )
 
+const (
+	queryAlias = "pt"
+	queryKey   = "id"
+)
+
+// Timeouts bound every statement on top of the caller context.
+const (
+	readTimeout  = time.Second * 5
+	writeTimeout = time.Second * 5
+	purgeTimeout = time.Minute
+)
+
+var filterColumns = map[string]query.Column{
+	"id":                 {Name: "id", Type: query.TypeInt, NotNull: true, Bits: 64},
+	"name":               {Name: "name", Type: query.TypeText, NotNull: true},
+	"surname":            {Name: "surname", Type: query.TypeText, NotNull: true},
+	"patronymic":         {Name: "patronymic", Type: query.TypeText},
+	"age":                {Name: "age", Type: query.TypeInt, Bits: 16},
+	"gender":             {Name: "gender", Type: query.TypeEnum, Values: []string{"male", "female"}},
+	"nation":             {Name: "nation", Type: query.TypeText},
+	"age_count":          {Name: "age_count", Type: query.TypeInt},
+	"gender_probability": {Name: "gender_probability", Type: query.TypeFloat},
+	"gender_count":       {Name: "gender_count", Type: query.TypeInt},
+	"nation_probability": {Name: "nation_probability", Type: query.TypeFloat},
+	"nation_count":       {Name: "nation_count", Type: query.TypeInt},
+	"nationalities":      {Name: "nationalities", Type: query.TypeRelation, Relation: nationalitiesRelation},
+	"created_at":         {Name: "created_at", Type: query.TypeTimestamp, NotNull: true},
+	"updated_at":         {Name: "updated_at", Type: query.TypeTimestamp},
+	"deleted_at":         {Name: "deleted_at", Type: query.TypeTimestamp},
+	"enrichment_status":  {Name: "enrichment_status", Type: query.TypeEnum, NotNull: true, Values: []string{domain.EnrichmentPending, domain.EnrichmentDone, domain.EnrichmentFailed}},
+	"enriched_at":        {Name: "enriched_at", Type: query.TypeTimestamp},
+}
+
 type PersonRepository struct {
 	db *sql.DB
 }
@@ -17,7 +55,45 @@ func NewRepository(db *sql.DB) *PersonRepository {
 	}
 }
 
-func (r *PersonRepository) Create(req *domain.Person) error {
+func NewQueryBuilder() *query.Builder {
+	return query.NewBuilder(queryAlias, queryKey, filterColumns)
+}
+
+func (r *PersonRepository) Create(ctx context.Context, req *domain.Person, audit domain.Audit) error {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	if err := r.inTx(ctx, audit, func(tx *sql.Tx) error {
+		return insert(ctx, tx, req)
+	}); err != nil {
+		return errors.Wrap(err, "Create #1")
+	}
+
+	return nil
+}
+
+// CreateMany inserts all persons in one transaction, either all of them are created or none.
+func (r *PersonRepository) CreateMany(ctx context.Context, reqs []domain.Person, audit domain.Audit) error {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	if err := r.inTx(ctx, audit, func(tx *sql.Tx) error {
+		for i := range reqs {
+			if err := insert(ctx, tx, &reqs[i]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return errors.Wrap(err, "CreateMany #1")
+	}
+
+	return nil
+}
+
+// insert adds the person, a pending one gets an enrichment job in the same transaction.
+func insert(ctx context.Context, tx *sql.Tx, req *domain.Person) error {
 	query := `
 		insert into persons.persons_table
 		(
@@ -26,13 +102,21 @@ func (r *PersonRepository) Create(req *domain.Person) error {
 		 patronymic,
 		 age,
 		 gender,
-		 nation
+		 nation,
+		 age_count,
+		 gender_probability,
+		 gender_count,
+		 nation_probability,
+		 nation_count,
+		 enrichment_status,
+		 enriched_at
 		)
-		values ($1, $2, $3, $4, $5, $6)
-		returning id, created_at
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, coalesce(nullif($12, ''), 'done'), case when $12 != 'pending' then now() end)
+		returning id, created_at, version, enrichment_status, enriched_at
 	`
 
-	if err := r.db.QueryRow(
+	if err := tx.QueryRowContext(
+		ctx,
 		query,
 		req.Name,
 		req.Surname,
@@ -40,17 +124,43 @@ func (r *PersonRepository) Create(req *domain.Person) error {
 		req.Age,
 		req.Gender,
 		req.Nation,
+		req.AgeCount,
+		req.GenderProbability,
+		req.GenderCount,
+		req.NationProbability,
+		req.NationCount,
+		req.EnrichmentStatus,
 	).Scan(
 		&req.ID,
 		&req.CreatedAt,
+		&req.Version,
+		&req.EnrichmentStatus,
+		&req.EnrichedAt,
 	); err != nil {
-		return errors.Wrap(err, "Create #1")
+		return errors.Wrap(err, "insert #1")
+	}
+
+	if len(req.Nationalities) != 0 {
+		if err := saveNationalities(ctx, tx, req.ID, req.Nationalities); err != nil {
+			return errors.Wrap(err, "insert #2")
+		}
+	} else {
+		req.Nationalities = make([]domain.Nationality, 0)
+	}
+
+	if req.EnrichmentStatus == domain.EnrichmentPending {
+		if err := enqueue(ctx, tx, req.ID); err != nil {
+			return errors.Wrap(err, "insert #3")
+		}
 	}
 
 	return nil
 }
 
-func (r *PersonRepository) GetByID(id int) (*domain.Person, error) {
+func (r *PersonRepository) GetByID(ctx context.Context, id int) (*domain.Person, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
 	query := `
 		select
 		    p.id, 
@@ -60,15 +170,24 @@ func (r *PersonRepository) GetByID(id int) (*domain.Person, error) {
 		    p.age, 
 		    p.gender, 
 		    p.nation, 
+		    p.age_count,
+		    p.gender_probability,
+		    p.gender_count,
+		    p.nation_probability,
+		    p.nation_count,
 		    p.created_at, 
-		    p.updated_at
+		    p.updated_at,
+		    p.deleted_at,
+		    p.version,
+		    p.enrichment_status,
+		    p.enriched_at
 		from persons.persons_table p 
 		where id = $1
 	`
 
 	var person domain.Person
 
-	if err := r.db.QueryRow(query, id).Scan(
+	if err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&person.ID,
 		&person.Name,
 		&person.Surname,
@@ -76,60 +195,195 @@ func (r *PersonRepository) GetByID(id int) (*domain.Person, error) {
 		&person.Age,
 		&person.Gender,
 		&person.Nation,
+		&person.AgeCount,
+		&person.GenderProbability,
+		&person.GenderCount,
+		&person.NationProbability,
+		&person.NationCount,
 		&person.CreatedAt,
 		&person.UpdatedAt,
+		&person.DeletedAt,
+		&person.Version,
+		&person.EnrichmentStatus,
+		&person.EnrichedAt,
 	); err != nil {
 		return nil, errors.Wrap(err, "GetByID #1")
 	}
 
+	if err := loadNationalities(ctx, r.db, &person); err != nil {
+		return nil, errors.Wrap(err, "GetByID #2")
+	}
+
 	return &person, nil
 }
 
-func (r *PersonRepository) GetWithFilterAndPagination(filter, pagination string) ([]byte, error) {
+func (r *PersonRepository) GetWithFilterAndPagination(ctx context.Context, q *query.Query) ([]domain.Person, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
 	query := fmt.Sprintf(`
-		select jsonb_build_object(
-					   'data',
-					   jsonb_agg(
-							   jsonb_build_object(
-									   'id', p.id,
-									   'name', p.name,
-									   'surname', p.surname,
-									   'patronymic', p.patronymic,
-									   'age', p.age,
-									   'gender', p.gender,
-									   'nation', p.nation,
-									   'created_at', to_char(p.created_at, 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"'),
-									   'updated_at', to_char(p.updated_at, 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"')
-								   )
-						   ),
-					   'meta', jsonb_build_object(
-							   'all_row_count', (select count(*) from persons.persons_table)
-						   )
-				   )
-		from (select pt.id,
-					 pt.name,
-					 pt.surname,
-					 pt.patronymic,
-					 pt.age,
-					 pt.gender,
-					 pt.nation,
-					 pt.created_at,
-					 pt.updated_at
-			  from persons.persons_table as pt %s
-			  order by pt.id desc %s
-			  ) as p;
-	`, filter, pagination)
-
-	var b []byte
-
-	if err := r.db.QueryRow(query).Scan(&b); err != nil {
+		select pt.id,
+			   pt.name,
+			   pt.surname,
+			   pt.patronymic,
+			   pt.age,
+			   pt.gender,
+			   pt.nation,
+			   pt.age_count,
+			   pt.gender_probability,
+			   pt.gender_count,
+			   pt.nation_probability,
+			   pt.nation_count,
+			   pt.created_at,
+			   pt.updated_at,
+			   pt.deleted_at,
+			   pt.version,
+			   pt.enrichment_status,
+			   pt.enriched_at
+		from persons.persons_table as pt %s %s
+		%s %s
+	`, q.Where, q.Seek, q.OrderBy, q.Pagination)
+
+	rows, err := r.db.QueryContext(ctx, query, q.Args...)
+	if err != nil {
 		return nil, errors.Wrap(err, "GetWithFilterAndPagination #1")
 	}
 
-	return b, nil
+	defer rows.Close()
+
+	persons := make([]domain.Person, 0)
+
+	for rows.Next() {
+		var person domain.Person
+
+		if err = rows.Scan(
+			&person.ID,
+			&person.Name,
+			&person.Surname,
+			&person.Patronymic,
+			&person.Age,
+			&person.Gender,
+			&person.Nation,
+			&person.AgeCount,
+			&person.GenderProbability,
+			&person.GenderCount,
+			&person.NationProbability,
+			&person.NationCount,
+			&person.CreatedAt,
+			&person.UpdatedAt,
+			&person.DeletedAt,
+			&person.Version,
+			&person.EnrichmentStatus,
+			&person.EnrichedAt,
+		); err != nil {
+			return nil, errors.Wrap(err, "GetWithFilterAndPagination #2")
+		}
+
+		persons = append(persons, person)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "GetWithFilterAndPagination #3")
+	}
+
+	ptrs := make([]*domain.Person, len(persons))
+
+	for i := range persons {
+		ptrs[i] = &persons[i]
+	}
+
+	if err = loadNationalities(ctx, r.db, ptrs...); err != nil {
+		return nil, errors.Wrap(err, "GetWithFilterAndPagination #4")
+	}
+
+	return persons, nil
+}
+
+// Count returns the number of rows matching the query filter. With query.CountEstimate it
+// reads the planner statistics instead of scanning the table.
+func (r *PersonRepository) Count(ctx context.Context, q *query.Query) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	if q.Count == query.CountEstimate {
+		count, err := r.estimateCount(ctx, q)
+		if err != nil {
+			return 0, errors.Wrap(err, "Count #1")
+		}
+
+		// reltuples is negative until the table is vacuumed or analyzed for the first time
+		if count >= 0 {
+			return count, nil
+		}
+	}
+
+	query := fmt.Sprintf(`
+		select count(*)
+		from persons.persons_table as pt %s
+	`, q.Where)
+
+	var count int
+
+	if err := r.db.QueryRowContext(ctx, query, q.CountArgs()...).Scan(&count); err != nil {
+		return 0, errors.Wrap(err, "Count #2")
+	}
+
+	return count, nil
 }
 
-func (r *PersonRepository) Update(req *domain.Person) error {
+func (r *PersonRepository) estimateCount(ctx context.Context, q *query.Query) (int, error) {
+	var count float64
+
+	if q.Where == "" {
+		query := `
+			select reltuples
+			from pg_class
+			where oid = 'persons.persons_table'::regclass
+		`
+
+		if err := r.db.QueryRowContext(ctx, query).Scan(&count); err != nil {
+			return 0, errors.Wrap(err, "estimateCount #1")
+		}
+
+		return int(count), nil
+	}
+
+	query := fmt.Sprintf(`
+		explain (format json)
+		select 1
+		from persons.persons_table as pt %s
+	`, q.Where)
+
+	var plan []byte
+
+	if err := r.db.QueryRowContext(ctx, query, q.CountArgs()...).Scan(&plan); err != nil {
+		return 0, errors.Wrap(err, "estimateCount #2")
+	}
+
+	var explain []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+
+	if err := json.Unmarshal(plan, &explain); err != nil {
+		return 0, errors.Wrap(err, "estimateCount #3")
+	}
+
+	if len(explain) == 0 {
+		return 0, errors.Wrap(errors.New("empty plan"), "estimateCount #4")
+	}
+
+	return int(explain[0].Plan.Rows), nil
+}
+
+// Update overwrites the person, the confidence of a value that changes is dropped. A non-nil
+// version makes the write conditional on the current row version, domain.ErrVersionMismatch
+// is returned when it has moved on.
+func (r *PersonRepository) Update(ctx context.Context, req *domain.Person, version *int, audit domain.Audit) error {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
 	query := `
 		update persons.persons_table
 		set 
@@ -146,52 +400,349 @@ func (r *PersonRepository) Update(req *domain.Person) error {
 		    patronymic = $3,
 		    age = $4,
 		    gender = $5,
-		    nation = $6
+		    nation = $6,
+		    age_count = case when age is not distinct from $4 then age_count end,
+		    gender_probability = case when gender is not distinct from $5 then gender_probability end,
+		    gender_count = case when gender is not distinct from $5 then gender_count end,
+		    nation_probability = case when nation is not distinct from $6 then nation_probability end,
+		    nation_count = case when nation is not distinct from $6 then nation_count end
 		where id = $7
-		returning name, surname, patronymic, age, gender, nation, created_at, updated_at;
+		  and deleted_at is null
+		  and ($8::integer is null or version = $8)
+		returning name, surname, patronymic, age, gender, nation, age_count, gender_probability, gender_count, nation_probability, nation_count, created_at, updated_at, version, enrichment_status, enriched_at;
 	`
 
-	if err := r.db.QueryRow(
-		query,
-		req.Name,
-		req.Surname,
-		req.Patronymic,
-		req.Age,
-		req.Gender,
-		req.Nation,
-		req.ID,
-	).Scan(
-		&req.Name,
-		&req.Surname,
-		&req.Patronymic,
-		&req.Age,
-		&req.Gender,
-		&req.Nation,
-		&req.CreatedAt,
-		&req.UpdatedAt,
-	); err != nil {
-		return errors.Wrap(err, "Update #1")
+	if err := r.inTx(ctx, audit, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(
+			ctx,
+			query,
+			req.Name,
+			req.Surname,
+			req.Patronymic,
+			req.Age,
+			req.Gender,
+			req.Nation,
+			req.ID,
+			version,
+		).Scan(
+			&req.Name,
+			&req.Surname,
+			&req.Patronymic,
+			&req.Age,
+			&req.Gender,
+			&req.Nation,
+			&req.AgeCount,
+			&req.GenderProbability,
+			&req.GenderCount,
+			&req.NationProbability,
+			&req.NationCount,
+			&req.CreatedAt,
+			&req.UpdatedAt,
+			&req.Version,
+			&req.EnrichmentStatus,
+			&req.EnrichedAt,
+		)
+	}); err != nil {
+		if err == sql.ErrNoRows && version != nil {
+			return errors.Wrap(r.checkExists(ctx, req.ID, false), "Update #1")
+		}
+
+		return errors.Wrap(err, "Update #2")
+	}
+
+	if err := loadNationalities(ctx, r.db, req); err != nil {
+		return errors.Wrap(err, "Update #3")
 	}
 
 	return nil
 }
 
-func (r *PersonRepository) Delete(id int) (*int64, error) {
+// Patch writes only the fields that are set in req and returns the updated person.
+// The version precondition works as in Update.
+func (r *PersonRepository) Patch(ctx context.Context, req *domain.PersonPatch, version *int, audit domain.Audit) (*domain.Person, error) {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	var (
+		sets []string
+		args []any
+	)
+
+	set := func(column string, value any) {
+		args = append(args, value)
+		sets = append(sets, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	if req.Name.Set {
+		set("name", req.Name.Value)
+	}
+
+	if req.Surname.Set {
+		set("surname", req.Surname.Value)
+	}
+
+	if req.Patronymic.Set {
+		set("patronymic", req.Patronymic.Value)
+	}
+
+	// the confidence of the providers is dropped along with the value they guessed
+	keep := func(value string, columns ...string) {
+		for _, column := range columns {
+			sets = append(sets, fmt.Sprintf("%s = case when %s is not distinct from $%d then %s end", column, value, len(args), column))
+		}
+	}
+
+	if req.Age.Set {
+		set("age", req.Age.Value)
+		keep("age", "age_count")
+	}
+
+	if req.Gender.Set {
+		set("gender", req.Gender.Value)
+		keep("gender", "gender_probability", "gender_count")
+	}
+
+	if req.Nation.Set {
+		set("nation", req.Nation.Value)
+		keep("nation", "nation_probability", "nation_count")
+	}
+
+	if len(sets) == 0 {
+		return nil, errors.Wrap(errors.New("empty patch"), "Patch #1")
+	}
+
+	query := fmt.Sprintf(`
+		update persons.persons_table
+		set %s
+		where id = $%d
+		  and deleted_at is null
+		  and ($%d::integer is null or version = $%d)
+		returning id, name, surname, patronymic, age, gender, nation, age_count, gender_probability, gender_count, nation_probability, nation_count, created_at, updated_at, version, enrichment_status, enriched_at;
+	`, strings.Join(sets, ", "), len(args)+1, len(args)+2, len(args)+2)
+
+	var person domain.Person
+
+	if err := r.inTx(ctx, audit, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, query, append(args, req.ID, version)...).Scan(
+			&person.ID,
+			&person.Name,
+			&person.Surname,
+			&person.Patronymic,
+			&person.Age,
+			&person.Gender,
+			&person.Nation,
+			&person.AgeCount,
+			&person.GenderProbability,
+			&person.GenderCount,
+			&person.NationProbability,
+			&person.NationCount,
+			&person.CreatedAt,
+			&person.UpdatedAt,
+			&person.Version,
+			&person.EnrichmentStatus,
+			&person.EnrichedAt,
+		)
+	}); err != nil {
+		if err == sql.ErrNoRows && version != nil {
+			return nil, errors.Wrap(r.checkExists(ctx, req.ID, false), "Patch #2")
+		}
+
+		return nil, errors.Wrap(err, "Patch #3")
+	}
+
+	if err := loadNationalities(ctx, r.db, &person); err != nil {
+		return nil, errors.Wrap(err, "Patch #4")
+	}
+
+	return &person, nil
+}
+
+// Delete marks the person as deleted, it stays in the table until purged.
+// The version precondition works as in Update.
+func (r *PersonRepository) Delete(ctx context.Context, id int, version *int, audit domain.Audit) (*int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
 	query := `
-		delete
-		from persons.persons_table
+		update persons.persons_table
+		set deleted_at = now()
 		where id = $1
+		  and deleted_at is null
+		  and ($2::integer is null or version = $2)
 	`
 
-	res, err := r.db.Exec(query, id)
-	if err != nil {
+	var aff int64
+
+	if err := r.inTx(ctx, audit, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, query, id, version)
+		if err != nil {
+			return err
+		}
+
+		aff, err = res.RowsAffected()
+
+		return err
+	}); err != nil {
 		return nil, errors.Wrap(err, "Delete #1")
 	}
 
-	aff, err := res.RowsAffected()
-	if err != nil {
-		return nil, errors.Wrap(err, "Delete #2")
+	if aff == 0 && version != nil {
+		if err := r.checkExists(ctx, id, false); err != sql.ErrNoRows {
+			return nil, errors.Wrap(err, "Delete #2")
+		}
 	}
 
 	return &aff, nil
 }
+
+// Restore brings back a deleted person, the version precondition works as in Update.
+func (r *PersonRepository) Restore(ctx context.Context, id int, version *int, audit domain.Audit) (*domain.Person, error) {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	query := `
+		update persons.persons_table
+		set deleted_at = null
+		where id = $1
+		  and deleted_at is not null
+		  and ($2::integer is null or version = $2)
+		returning id, name, surname, patronymic, age, gender, nation, age_count, gender_probability, gender_count, nation_probability, nation_count, created_at, updated_at, version, enrichment_status, enriched_at;
+	`
+
+	var person domain.Person
+
+	if err := r.inTx(ctx, audit, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, query, id, version).Scan(
+			&person.ID,
+			&person.Name,
+			&person.Surname,
+			&person.Patronymic,
+			&person.Age,
+			&person.Gender,
+			&person.Nation,
+			&person.AgeCount,
+			&person.GenderProbability,
+			&person.GenderCount,
+			&person.NationProbability,
+			&person.NationCount,
+			&person.CreatedAt,
+			&person.UpdatedAt,
+			&person.Version,
+			&person.EnrichmentStatus,
+			&person.EnrichedAt,
+		)
+	}); err != nil {
+		if err == sql.ErrNoRows && version != nil {
+			return nil, errors.Wrap(r.checkExists(ctx, id, true), "Restore #1")
+		}
+
+		return nil, errors.Wrap(err, "Restore #2")
+	}
+
+	if err := loadNationalities(ctx, r.db, &person); err != nil {
+		return nil, errors.Wrap(err, "Restore #3")
+	}
+
+	return &person, nil
+}
+
+// Purge removes the persons deleted more than retention ago for good, together with their
+// history, only the purge entry is kept. The cutoff is computed by the database, the same
+// clock that stamped deleted_at.
+func (r *PersonRepository) Purge(ctx context.Context, retention time.Duration, audit domain.Audit) (*domain.PurgeResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, purgeTimeout)
+	defer cancel()
+
+	query := `
+		with cutoff as (
+		    select now()::timestamp - make_interval(secs => $1) as deleted_before
+		), purged as (
+		    delete
+		    from persons.persons_table
+		    where deleted_at < (select deleted_before from cutoff)
+		    returning id
+		), history as (
+		    delete
+		    from persons.person_history
+		    where person_id in (select id from purged)
+		)
+		select (select count(*) from purged), deleted_before
+		from cutoff
+	`
+
+	var res domain.PurgeResult
+
+	if err := r.inTx(ctx, audit, func(tx *sql.Tx) error {
+		// person_history is append-only unless the transaction is marked as a purge.
+		if _, err := tx.ExecContext(ctx, `select set_config('namer.purge', 'on', true)`); err != nil {
+			return errors.Wrap(err, "Purge #1")
+		}
+
+		return tx.QueryRowContext(ctx, query, retention.Seconds()).Scan(
+			&res.Purged,
+			&res.DeletedBefore,
+		)
+	}); err != nil {
+		return nil, errors.Wrap(err, "Purge #2")
+	}
+
+	return &res, nil
+}
+
+// inTx runs fn in a transaction tagged with the audit data, the history trigger
+// reads it from the transaction settings.
+func (r *PersonRepository) inTx(ctx context.Context, audit domain.Audit, fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "inTx #1")
+	}
+
+	query := `
+		select set_config('namer.actor', $1, true),
+		       set_config('namer.request_id', $2, true)
+	`
+
+	if _, err = tx.ExecContext(ctx, query, audit.Actor, audit.RequestID); err != nil {
+		_ = tx.Rollback()
+
+		return errors.Wrap(err, "inTx #2")
+	}
+
+	if err = fn(tx); err != nil {
+		_ = tx.Rollback()
+
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return errors.Wrap(err, "inTx #3")
+	}
+
+	return nil
+}
+
+// checkExists tells why a conditional write matched no rows: it returns
+// domain.ErrVersionMismatch when the person exists and sql.ErrNoRows otherwise.
+// deleted selects whether a deleted or a live person is looked for.
+func (r *PersonRepository) checkExists(ctx context.Context, id int, deleted bool) error {
+	query := `
+		select exists(
+		    select 1
+		    from persons.persons_table
+		    where id = $1
+		      and (deleted_at is not null) = $2
+		)
+	`
+
+	var exists bool
+
+	if err := r.db.QueryRowContext(ctx, query, id, deleted).Scan(&exists); err != nil {
+		return errors.Wrap(err, "checkExists #1")
+	}
+
+	if exists {
+		return domain.ErrVersionMismatch
+	}
+
+	return sql.ErrNoRows
+}
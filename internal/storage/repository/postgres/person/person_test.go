@@ -3,7 +3,6 @@ package person
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
@@ -12,6 +11,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"log"
 	"namer/internal/domain"
+	"namer/pkg/query"
 	"namer/pkg/utils"
 	"os"
 	"path/filepath"
@@ -19,6 +19,8 @@ import (
 	"time"
 )
 
+var testAudit = domain.Audit{Actor: "test", RequestID: "test"}
+
 func connectToDB() (*sql.DB, error) {
 	wd, err := os.Getwd()
 	if err != nil {
@@ -79,7 +81,43 @@ func TestCreate(t *testing.T) {
 			Gender: utils.StringToPtr("Test"),
 		}
 
-		assert.Error(t, repo.Create(&bad))
+		assert.Error(t, repo.Create(context.Background(), &bad, testAudit))
+	})
+}
+
+func TestCreateMany(t *testing.T) {
+	db, err := connectToDB()
+
+	require.NoError(t, err)
+	require.NotNil(t, db)
+
+	repo := NewRepository(db)
+
+	t.Run("success", func(t *testing.T) {
+		reqs := []domain.Person{
+			{Name: "Test", Surname: "Test"},
+			{Name: "Test1", Surname: "Test1"},
+		}
+
+		require.NoError(t, repo.CreateMany(context.Background(), reqs, testAudit))
+
+		for i := range reqs {
+			assert.NotEqual(t, 0, reqs[i].ID)
+
+			deletePerson(t, repo, &reqs[i])
+		}
+	})
+
+	t.Run("error_rolls_back", func(t *testing.T) {
+		reqs := []domain.Person{
+			{Name: "Test", Surname: "Test"},
+			{Gender: utils.StringToPtr("Test")},
+		}
+
+		assert.Error(t, repo.CreateMany(context.Background(), reqs, testAudit))
+
+		_, err := repo.GetByID(context.Background(), reqs[0].ID)
+		assert.Equal(t, sql.ErrNoRows, errors.Cause(err))
 	})
 }
 
@@ -99,7 +137,7 @@ func TestGetByID(t *testing.T) {
 
 		createPerson(t, repo, &req)
 
-		p, err := repo.GetByID(req.ID)
+		p, err := repo.GetByID(context.Background(), req.ID)
 
 		require.NoError(t, err)
 
@@ -109,7 +147,7 @@ func TestGetByID(t *testing.T) {
 	})
 
 	t.Run("error", func(t *testing.T) {
-		badP, err := repo.GetByID(0)
+		badP, err := repo.GetByID(context.Background(), 0)
 
 		assert.Nil(t, badP)
 		if assert.Error(t, err) {
@@ -131,8 +169,13 @@ func TestGetWithFilterAndPagination(t *testing.T) {
 
 		for i := 0; i < 5; i++ {
 			person := domain.Person{
-				Name:    fmt.Sprintf("Test%d", i),
-				Surname: fmt.Sprintf("Test%d", i),
+				Name:              fmt.Sprintf("Test%d", i),
+				Surname:           fmt.Sprintf("Test%d", i),
+				Age:               utils.IntToPtr(30 + i),
+				AgeCount:          utils.IntToPtr(100 + i),
+				Gender:            utils.StringToPtr("female"),
+				GenderProbability: utils.Float64ToPtr(0.9),
+				GenderCount:       utils.IntToPtr(200 + i),
 			}
 
 			createPerson(t, repo, &person)
@@ -142,8 +185,8 @@ func TestGetWithFilterAndPagination(t *testing.T) {
 
 		req := domain.FilterWithPagination{
 			Filter: []domain.Filter{
-				{"name", "te"},
-				{"surname", "t"},
+				{Field: "name", Value: "te"},
+				{Field: "surname", Value: "t"},
 			},
 			Pagination: &domain.Pagination{
 				Page:  1,
@@ -151,43 +194,138 @@ func TestGetWithFilterAndPagination(t *testing.T) {
 			},
 		}
 
-		result, err := utils.GetFilterAndPagination(&req, "pt")
+		q, err := NewQueryBuilder().Build(&req)
+		require.NoError(t, err)
+
+		data, err := repo.GetWithFilterAndPagination(context.Background(), q)
+		require.NoError(t, err)
+
+		count, err := repo.Count(context.Background(), q)
 		assert.NoError(t, err)
-		require.Equal(t, len(result), 2)
+		assert.Equal(t, count, len(persons))
+
+		q.Count = query.CountEstimate
 
-		b, err := repo.GetWithFilterAndPagination(result[0], result[1])
+		_, err = repo.Count(context.Background(), q)
 		assert.NoError(t, err)
-		assert.NotNil(t, b)
 
-		resp := struct {
-			Data []domain.Person `json:"data"`
-			Meta *struct {
-				AllRowCount int `json:"all_row_count"`
+		if assert.Len(t, data, len(persons)) {
+			for i := range data {
+				assert.Equal(t, data[i].Name, persons[len(persons)-i-1].Name)
+				assert.Equal(t, data[i].Surname, persons[len(persons)-i-1].Surname)
+				assert.Equal(t, data[i].AgeCount, persons[len(persons)-i-1].AgeCount)
+				assert.Equal(t, data[i].GenderProbability, persons[len(persons)-i-1].GenderProbability)
+				assert.Equal(t, data[i].GenderCount, persons[len(persons)-i-1].GenderCount)
+
+				deletePerson(t, repo, &data[i])
 			}
-		}{}
+		}
+	})
 
-		assert.Nil(t, json.Unmarshal(b, &resp))
+	t.Run("success_nationalities", func(t *testing.T) {
+		person := domain.Person{
+			Name:    "Test",
+			Surname: "Test",
+			Nationalities: []domain.Nationality{
+				{CountryID: "IE", Probability: 0.6, Rank: 1},
+				{CountryID: "GB", Probability: 0.3, Rank: 2},
+			},
+		}
+
+		createPerson(t, repo, &person)
+
+		match := func(country string, probability float64) []domain.Person {
+			req := domain.FilterWithPagination{
+				Filter: []domain.Filter{
+					{Field: "id", Operator: query.OpEq, Value: person.ID},
+					{
+						Field: "nationalities",
+						Value: domain.FilterGroup{
+							Filter: []domain.Filter{
+								{Field: "country_id", Operator: query.OpEq, Value: country},
+								{Field: "probability", Operator: query.OpGte, Value: probability},
+							},
+						},
+					},
+				},
+			}
 
-		if assert.NotNil(t, resp.Data) {
-			for i := range resp.Data {
-				if i == 0 {
-					assert.Equal(t, resp.Data[i].Name, persons[len(persons)-1].Name)
-					assert.Equal(t, resp.Data[i].Surname, persons[len(persons)-1].Surname)
-				} else {
-					assert.Equal(t, resp.Data[i].Name, persons[len(persons)-i-1].Name)
-					assert.Equal(t, resp.Data[i].Surname, persons[len(persons)-i-1].Surname)
-				}
+			q, err := NewQueryBuilder().Build(&req)
+			require.NoError(t, err)
 
-				assert.Equal(t, resp.Meta.AllRowCount, len(persons))
+			data, err := repo.GetWithFilterAndPagination(context.Background(), q)
+			require.NoError(t, err)
+
+			return data
+		}
 
-				deletePerson(t, repo, &resp.Data[i])
+		if data := match("GB", 0.2); assert.Len(t, data, 1) {
+			assert.Equal(t, person.Nationalities, data[0].Nationalities)
+		}
+
+		assert.Empty(t, match("GB", 0.5))
+
+		deletePerson(t, repo, &person)
+	})
+
+	t.Run("success_cursor", func(t *testing.T) {
+		var persons []domain.Person
+
+		for i := 0; i < 5; i++ {
+			person := domain.Person{
+				Name:    fmt.Sprintf("Test%d", i),
+				Surname: fmt.Sprintf("Test%d", i),
+				Age:     utils.IntToPtr(20 + i%2),
 			}
+
+			createPerson(t, repo, &person)
+
+			persons = append(persons, person)
+		}
+
+		req := domain.FilterWithPagination{
+			Sort: []domain.Sort{
+				{Field: "age", Direction: query.SortAsc},
+			},
+			Pagination: &domain.Pagination{
+				Limit: 2,
+				Mode:  query.ModeCursor,
+			},
+		}
+
+		var seen []int
+
+		for {
+			q, err := NewQueryBuilder().Build(&req)
+			require.NoError(t, err)
+
+			data, err := repo.GetWithFilterAndPagination(context.Background(), q)
+			require.NoError(t, err)
+
+			data, page, err := query.Paginate(q, data)
+			require.NoError(t, err)
+
+			for i := range data {
+				seen = append(seen, data[i].ID)
+			}
+
+			if page.Next == nil {
+				break
+			}
+
+			req.Pagination.Cursor = *page.Next
+		}
+
+		assert.Equal(t, []int{persons[3].ID, persons[1].ID, persons[4].ID, persons[2].ID, persons[0].ID}, seen)
+
+		for i := range persons {
+			deletePerson(t, repo, &persons[i])
 		}
 	})
 
 	t.Run("error", func(t *testing.T) {
-		b, err := repo.GetWithFilterAndPagination("test", "test")
-		assert.Nil(t, b)
+		data, err := repo.GetWithFilterAndPagination(context.Background(), &query.Query{Where: "test"})
+		assert.Nil(t, data)
 		assert.Error(t, err)
 	})
 }
@@ -210,7 +348,7 @@ func TestUpdate(t *testing.T) {
 
 		req.Name, req.Surname, req.Gender = "Test1", "Test1", utils.StringToPtr("male")
 
-		assert.Nil(t, repo.Update(&req))
+		assert.Nil(t, repo.Update(context.Background(), &req, nil, testAudit))
 		assert.Equal(t, req.Name, "Test1")
 		assert.Equal(t, req.Surname, "Test1")
 		assert.Equal(t, req.Gender, utils.StringToPtr("male"))
@@ -219,8 +357,80 @@ func TestUpdate(t *testing.T) {
 		deletePerson(t, repo, &req)
 	})
 
+	t.Run("success_drops_confidence", func(t *testing.T) {
+		req := domain.Person{
+			Name:              "Test",
+			Surname:           "Test",
+			Age:               utils.IntToPtr(40),
+			AgeCount:          utils.IntToPtr(120),
+			Gender:            utils.StringToPtr("female"),
+			GenderProbability: utils.Float64ToPtr(0.98),
+			GenderCount:       utils.IntToPtr(300),
+		}
+
+		createPerson(t, repo, &req)
+
+		req.Age = utils.IntToPtr(41)
+
+		require.NoError(t, repo.Update(context.Background(), &req, nil, testAudit))
+
+		assert.Nil(t, req.AgeCount)
+		assert.Equal(t, 0.98, *req.GenderProbability)
+		assert.Equal(t, 300, *req.GenderCount)
+
+		deletePerson(t, repo, &req)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		err = repo.Update(context.Background(), &domain.Person{}, nil, testAudit)
+		if assert.Error(t, err) {
+			assert.Equal(t, sql.ErrNoRows, errors.Cause(err))
+		}
+	})
+}
+
+func TestPatch(t *testing.T) {
+	db, err := connectToDB()
+
+	require.NoError(t, err)
+	require.NotNil(t, db)
+
+	repo := NewRepository(db)
+
+	t.Run("success", func(t *testing.T) {
+		req := domain.Person{
+			Name:              "Test",
+			Surname:           "Test",
+			Age:               utils.IntToPtr(40),
+			AgeCount:          utils.IntToPtr(120),
+			Gender:            utils.StringToPtr("female"),
+			GenderProbability: utils.Float64ToPtr(0.98),
+			GenderCount:       utils.IntToPtr(300),
+		}
+
+		createPerson(t, repo, &req)
+
+		person, err := repo.Patch(context.Background(), &domain.PersonPatch{
+			ID:   req.ID,
+			Name: domain.NewField("Test1"),
+			Age:  domain.NewField(41),
+		}, &req.Version, testAudit)
+		require.NoError(t, err)
+
+		assert.Equal(t, req.ID, person.ID)
+		assert.Equal(t, "Test1", person.Name)
+		assert.Equal(t, "Test", person.Surname)
+		assert.Equal(t, 41, *person.Age)
+		assert.Nil(t, person.AgeCount)
+		assert.Equal(t, 0.98, *person.GenderProbability)
+		assert.Equal(t, 300, *person.GenderCount)
+		assert.Equal(t, req.Version+1, person.Version)
+
+		deletePerson(t, repo, person)
+	})
+
 	t.Run("error", func(t *testing.T) {
-		err = repo.Update(&domain.Person{})
+		_, err = repo.Patch(context.Background(), &domain.PersonPatch{Name: domain.NewField("Test")}, nil, testAudit)
 		if assert.Error(t, err) {
 			assert.Equal(t, sql.ErrNoRows, errors.Cause(err))
 		}
@@ -247,15 +457,57 @@ func TestDelete(t *testing.T) {
 	})
 
 	t.Run("error", func(t *testing.T) {
-		aff, err := repo.Delete(0)
+		aff, err := repo.Delete(context.Background(), 0, nil, testAudit)
 
 		assert.NoError(t, err)
 		assert.Equal(t, *aff, int64(0))
 	})
 }
 
+func TestRestore(t *testing.T) {
+	db, err := connectToDB()
+
+	require.NoError(t, err)
+	require.NotNil(t, db)
+
+	repo := NewRepository(db)
+
+	t.Run("success", func(t *testing.T) {
+		req := domain.Person{
+			Name:              "Test",
+			Surname:           "Test",
+			Gender:            utils.StringToPtr("male"),
+			GenderProbability: utils.Float64ToPtr(0.97),
+			GenderCount:       utils.IntToPtr(500),
+		}
+
+		createPerson(t, repo, &req)
+		deletePerson(t, repo, &req)
+
+		person, err := repo.GetByID(context.Background(), req.ID)
+		require.NoError(t, err)
+		assert.NotNil(t, person.DeletedAt)
+
+		person, err = repo.Restore(context.Background(), req.ID, &person.Version, testAudit)
+		require.NoError(t, err)
+		assert.Equal(t, req.ID, person.ID)
+		assert.Nil(t, person.DeletedAt)
+		assert.Equal(t, req.GenderProbability, person.GenderProbability)
+		assert.Equal(t, req.GenderCount, person.GenderCount)
+
+		deletePerson(t, repo, person)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, err = repo.Restore(context.Background(), 0, nil, testAudit)
+		if assert.Error(t, err) {
+			assert.Equal(t, sql.ErrNoRows, errors.Cause(err))
+		}
+	})
+}
+
 func createPerson(t *testing.T, repo *PersonRepository, person *domain.Person) {
-	require.NoError(t, repo.Create(person))
+	require.NoError(t, repo.Create(context.Background(), person, testAudit))
 
 	assert.NotEqual(t, person.ID, 0)
 	assert.Equal(t, person.Name, person.Name)
@@ -264,7 +516,7 @@ func createPerson(t *testing.T, repo *PersonRepository, person *domain.Person) {
 }
 
 func deletePerson(t *testing.T, repo *PersonRepository, person *domain.Person) {
-	aff, err := repo.Delete(person.ID)
+	aff, err := repo.Delete(context.Background(), person.ID, nil, testAudit)
 
 	require.NoError(t, err)
 	require.NotEqual(t, *aff, 0)
@@ -3,6 +3,8 @@
 package mocks
 
 import (
+	context "context"
+
 	external "namer/internal/domain/external"
 
 	mock "github.com/stretchr/testify/mock"
@@ -13,25 +15,51 @@ type APIRepository struct {
 	mock.Mock
 }
 
-// GetNameInfo provides a mock function with given fields: name
-func (_m *APIRepository) GetNameInfo(name string) (*external.ExternalResponse, error) {
-	ret := _m.Called(name)
+// GetNameInfo provides a mock function with given fields: ctx, name, country
+func (_m *APIRepository) GetNameInfo(ctx context.Context, name string, country string) (*external.ExternalResponse, error) {
+	ret := _m.Called(ctx, name, country)
 
 	var r0 *external.ExternalResponse
 	var r1 error
-	if rf, ok := ret.Get(0).(func(string) (*external.ExternalResponse, error)); ok {
-		return rf(name)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) (*external.ExternalResponse, error)); ok {
+		return rf(ctx, name, country)
 	}
-	if rf, ok := ret.Get(0).(func(string) *external.ExternalResponse); ok {
-		r0 = rf(name)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) *external.ExternalResponse); ok {
+		r0 = rf(ctx, name, country)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*external.ExternalResponse)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(string) error); ok {
-		r1 = rf(name)
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, name, country)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetNamesInfo provides a mock function with given fields: ctx, names, country
+func (_m *APIRepository) GetNamesInfo(ctx context.Context, names []string, country string) (map[string]*external.ExternalResponse, error) {
+	ret := _m.Called(ctx, names, country)
+
+	var r0 map[string]*external.ExternalResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, []string, string) (map[string]*external.ExternalResponse, error)); ok {
+		return rf(ctx, names, country)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, []string, string) map[string]*external.ExternalResponse); ok {
+		r0 = rf(ctx, names, country)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]*external.ExternalResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, []string, string) error); ok {
+		r1 = rf(ctx, names, country)
 	} else {
 		r1 = ret.Error(1)
 	}
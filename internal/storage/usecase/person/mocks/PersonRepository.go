@@ -3,8 +3,14 @@
 package mocks
 
 import (
+	context "context"
+
 	domain "namer/internal/domain"
 
+	query "namer/pkg/query"
+
+	time "time"
+
 	mock "github.com/stretchr/testify/mock"
 )
 
@@ -13,13 +19,101 @@ type PersonRepository struct {
 	mock.Mock
 }
 
-// Create provides a mock function with given fields: req
-func (_m *PersonRepository) Create(req *domain.Person) error {
-	ret := _m.Called(req)
+// ClaimJobs provides a mock function with given fields: ctx, limit, lease
+func (_m *PersonRepository) ClaimJobs(ctx context.Context, limit int, lease time.Duration) ([]domain.EnrichmentJob, error) {
+	ret := _m.Called(ctx, limit, lease)
+
+	var r0 []domain.EnrichmentJob
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int, time.Duration) ([]domain.EnrichmentJob, error)); ok {
+		return rf(ctx, limit, lease)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int, time.Duration) []domain.EnrichmentJob); ok {
+		r0 = rf(ctx, limit, lease)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]domain.EnrichmentJob)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int, time.Duration) error); ok {
+		r1 = rf(ctx, limit, lease)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CompleteJob provides a mock function with given fields: ctx, id, attempts, req, audit
+func (_m *PersonRepository) CompleteJob(ctx context.Context, id int64, attempts int, req *domain.Person, audit domain.Audit) error {
+	ret := _m.Called(ctx, id, attempts, req, audit)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int, *domain.Person, domain.Audit) error); ok {
+		r0 = rf(ctx, id, attempts, req, audit)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Count provides a mock function with given fields: ctx, q
+func (_m *PersonRepository) Count(ctx context.Context, q *query.Query) (int, error) {
+	ret := _m.Called(ctx, q)
+
+	var r0 int
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *query.Query) (int, error)); ok {
+		return rf(ctx, q)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *query.Query) int); ok {
+		r0 = rf(ctx, q)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *query.Query) error); ok {
+		r1 = rf(ctx, q)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CountHistory provides a mock function with given fields: ctx, q
+func (_m *PersonRepository) CountHistory(ctx context.Context, q *query.Query) (int, error) {
+	ret := _m.Called(ctx, q)
+
+	var r0 int
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *query.Query) (int, error)); ok {
+		return rf(ctx, q)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *query.Query) int); ok {
+		r0 = rf(ctx, q)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *query.Query) error); ok {
+		r1 = rf(ctx, q)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Create provides a mock function with given fields: ctx, req, audit
+func (_m *PersonRepository) Create(ctx context.Context, req *domain.Person, audit domain.Audit) error {
+	ret := _m.Called(ctx, req, audit)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(*domain.Person) error); ok {
-		r0 = rf(req)
+	if rf, ok := ret.Get(0).(func(context.Context, *domain.Person, domain.Audit) error); ok {
+		r0 = rf(ctx, req, audit)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -27,25 +121,39 @@ func (_m *PersonRepository) Create(req *domain.Person) error {
 	return r0
 }
 
-// Delete provides a mock function with given fields: id
-func (_m *PersonRepository) Delete(id int) (*int64, error) {
-	ret := _m.Called(id)
+// CreateMany provides a mock function with given fields: ctx, reqs, audit
+func (_m *PersonRepository) CreateMany(ctx context.Context, reqs []domain.Person, audit domain.Audit) error {
+	ret := _m.Called(ctx, reqs, audit)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, []domain.Person, domain.Audit) error); ok {
+		r0 = rf(ctx, reqs, audit)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Delete provides a mock function with given fields: ctx, id, version, audit
+func (_m *PersonRepository) Delete(ctx context.Context, id int, version *int, audit domain.Audit) (*int64, error) {
+	ret := _m.Called(ctx, id, version, audit)
 
 	var r0 *int64
 	var r1 error
-	if rf, ok := ret.Get(0).(func(int) (*int64, error)); ok {
-		return rf(id)
+	if rf, ok := ret.Get(0).(func(context.Context, int, *int, domain.Audit) (*int64, error)); ok {
+		return rf(ctx, id, version, audit)
 	}
-	if rf, ok := ret.Get(0).(func(int) *int64); ok {
-		r0 = rf(id)
+	if rf, ok := ret.Get(0).(func(context.Context, int, *int, domain.Audit) *int64); ok {
+		r0 = rf(ctx, id, version, audit)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*int64)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(int) error); ok {
-		r1 = rf(id)
+	if rf, ok := ret.Get(1).(func(context.Context, int, *int, domain.Audit) error); ok {
+		r1 = rf(ctx, id, version, audit)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -53,25 +161,77 @@ func (_m *PersonRepository) Delete(id int) (*int64, error) {
 	return r0, r1
 }
 
-// GetByID provides a mock function with given fields: id
-func (_m *PersonRepository) GetByID(id int) (*domain.Person, error) {
-	ret := _m.Called(id)
+// GetByID provides a mock function with given fields: ctx, id
+func (_m *PersonRepository) GetByID(ctx context.Context, id int) (*domain.Person, error) {
+	ret := _m.Called(ctx, id)
 
 	var r0 *domain.Person
 	var r1 error
-	if rf, ok := ret.Get(0).(func(int) (*domain.Person, error)); ok {
-		return rf(id)
+	if rf, ok := ret.Get(0).(func(context.Context, int) (*domain.Person, error)); ok {
+		return rf(ctx, id)
 	}
-	if rf, ok := ret.Get(0).(func(int) *domain.Person); ok {
-		r0 = rf(id)
+	if rf, ok := ret.Get(0).(func(context.Context, int) *domain.Person); ok {
+		r0 = rf(ctx, id)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*domain.Person)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(int) error); ok {
-		r1 = rf(id)
+	if rf, ok := ret.Get(1).(func(context.Context, int) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetHistory provides a mock function with given fields: ctx, q
+func (_m *PersonRepository) GetHistory(ctx context.Context, q *query.Query) ([]domain.PersonHistory, error) {
+	ret := _m.Called(ctx, q)
+
+	var r0 []domain.PersonHistory
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *query.Query) ([]domain.PersonHistory, error)); ok {
+		return rf(ctx, q)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *query.Query) []domain.PersonHistory); ok {
+		r0 = rf(ctx, q)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]domain.PersonHistory)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *query.Query) error); ok {
+		r1 = rf(ctx, q)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetJobs provides a mock function with given fields: ctx, status, limit
+func (_m *PersonRepository) GetJobs(ctx context.Context, status string, limit int) ([]domain.EnrichmentJob, error) {
+	ret := _m.Called(ctx, status, limit)
+
+	var r0 []domain.EnrichmentJob
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) ([]domain.EnrichmentJob, error)); ok {
+		return rf(ctx, status, limit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) []domain.EnrichmentJob); ok {
+		r0 = rf(ctx, status, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]domain.EnrichmentJob)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, int) error); ok {
+		r1 = rf(ctx, status, limit)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -79,25 +239,25 @@ func (_m *PersonRepository) GetByID(id int) (*domain.Person, error) {
 	return r0, r1
 }
 
-// GetWithFilterAndPagination provides a mock function with given fields: filter, pagination
-func (_m *PersonRepository) GetWithFilterAndPagination(filter string, pagination string) ([]byte, error) {
-	ret := _m.Called(filter, pagination)
+// GetWithFilterAndPagination provides a mock function with given fields: ctx, q
+func (_m *PersonRepository) GetWithFilterAndPagination(ctx context.Context, q *query.Query) ([]domain.Person, error) {
+	ret := _m.Called(ctx, q)
 
-	var r0 []byte
+	var r0 []domain.Person
 	var r1 error
-	if rf, ok := ret.Get(0).(func(string, string) ([]byte, error)); ok {
-		return rf(filter, pagination)
+	if rf, ok := ret.Get(0).(func(context.Context, *query.Query) ([]domain.Person, error)); ok {
+		return rf(ctx, q)
 	}
-	if rf, ok := ret.Get(0).(func(string, string) []byte); ok {
-		r0 = rf(filter, pagination)
+	if rf, ok := ret.Get(0).(func(context.Context, *query.Query) []domain.Person); ok {
+		r0 = rf(ctx, q)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]byte)
+			r0 = ret.Get(0).([]domain.Person)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(string, string) error); ok {
-		r1 = rf(filter, pagination)
+	if rf, ok := ret.Get(1).(func(context.Context, *query.Query) error); ok {
+		r1 = rf(ctx, q)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -105,13 +265,159 @@ func (_m *PersonRepository) GetWithFilterAndPagination(filter string, pagination
 	return r0, r1
 }
 
-// Update provides a mock function with given fields: req
-func (_m *PersonRepository) Update(req *domain.Person) error {
-	ret := _m.Called(req)
+// KillJob provides a mock function with given fields: ctx, id, attempts, personID, reason, audit
+func (_m *PersonRepository) KillJob(ctx context.Context, id int64, attempts int, personID int, reason string, audit domain.Audit) error {
+	ret := _m.Called(ctx, id, attempts, personID, reason, audit)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int, int, string, domain.Audit) error); ok {
+		r0 = rf(ctx, id, attempts, personID, reason, audit)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Patch provides a mock function with given fields: ctx, req, version, audit
+func (_m *PersonRepository) Patch(ctx context.Context, req *domain.PersonPatch, version *int, audit domain.Audit) (*domain.Person, error) {
+	ret := _m.Called(ctx, req, version, audit)
+
+	var r0 *domain.Person
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *domain.PersonPatch, *int, domain.Audit) (*domain.Person, error)); ok {
+		return rf(ctx, req, version, audit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *domain.PersonPatch, *int, domain.Audit) *domain.Person); ok {
+		r0 = rf(ctx, req, version, audit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*domain.Person)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *domain.PersonPatch, *int, domain.Audit) error); ok {
+		r1 = rf(ctx, req, version, audit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Purge provides a mock function with given fields: ctx, retention, audit
+func (_m *PersonRepository) Purge(ctx context.Context, retention time.Duration, audit domain.Audit) (*domain.PurgeResult, error) {
+	ret := _m.Called(ctx, retention, audit)
+
+	var r0 *domain.PurgeResult
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, time.Duration, domain.Audit) (*domain.PurgeResult, error)); ok {
+		return rf(ctx, retention, audit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, time.Duration, domain.Audit) *domain.PurgeResult); ok {
+		r0 = rf(ctx, retention, audit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*domain.PurgeResult)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, time.Duration, domain.Audit) error); ok {
+		r1 = rf(ctx, retention, audit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Reenrich provides a mock function with given fields: ctx, req, version, audit
+func (_m *PersonRepository) Reenrich(ctx context.Context, req *domain.Person, version int, audit domain.Audit) error {
+	ret := _m.Called(ctx, req, version, audit)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *domain.Person, int, domain.Audit) error); ok {
+		r0 = rf(ctx, req, version, audit)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RequeueJob provides a mock function with given fields: ctx, id, audit
+func (_m *PersonRepository) RequeueJob(ctx context.Context, id int64, audit domain.Audit) (*domain.EnrichmentJob, error) {
+	ret := _m.Called(ctx, id, audit)
+
+	var r0 *domain.EnrichmentJob
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64, domain.Audit) (*domain.EnrichmentJob, error)); ok {
+		return rf(ctx, id, audit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64, domain.Audit) *domain.EnrichmentJob); ok {
+		r0 = rf(ctx, id, audit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*domain.EnrichmentJob)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64, domain.Audit) error); ok {
+		r1 = rf(ctx, id, audit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Restore provides a mock function with given fields: ctx, id, version, audit
+func (_m *PersonRepository) Restore(ctx context.Context, id int, version *int, audit domain.Audit) (*domain.Person, error) {
+	ret := _m.Called(ctx, id, version, audit)
+
+	var r0 *domain.Person
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int, *int, domain.Audit) (*domain.Person, error)); ok {
+		return rf(ctx, id, version, audit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int, *int, domain.Audit) *domain.Person); ok {
+		r0 = rf(ctx, id, version, audit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*domain.Person)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int, *int, domain.Audit) error); ok {
+		r1 = rf(ctx, id, version, audit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RetryJob provides a mock function with given fields: ctx, id, attempts, delay, reason
+func (_m *PersonRepository) RetryJob(ctx context.Context, id int64, attempts int, delay time.Duration, reason string) error {
+	ret := _m.Called(ctx, id, attempts, delay, reason)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int, time.Duration, string) error); ok {
+		r0 = rf(ctx, id, attempts, delay, reason)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Update provides a mock function with given fields: ctx, req, version, audit
+func (_m *PersonRepository) Update(ctx context.Context, req *domain.Person, version *int, audit domain.Audit) error {
+	ret := _m.Called(ctx, req, version, audit)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(*domain.Person) error); ok {
-		r0 = rf(req)
+	if rf, ok := ret.Get(0).(func(context.Context, *domain.Person, *int, domain.Audit) error); ok {
+		r0 = rf(ctx, req, version, audit)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -1,49 +1,151 @@
 package person
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"github.com/pkg/errors"
+	"maps"
+	"math"
 	"namer/internal/customErrors"
 	"namer/internal/domain"
 	"namer/internal/domain/external"
-	personAPI "namer/internal/storage/repository/api/person"
 	personPostgres "namer/internal/storage/repository/postgres/person"
+	"namer/pkg/jsonpatch"
+	"namer/pkg/query"
 	"namer/pkg/utils"
 	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
 )
 
 //go:generate mockery --name APIRepositgoory
 type APIRepository interface {
-	GetNameInfo(name string) (*external.ExternalResponse, error)
+	GetNameInfo(ctx context.Context, name, country string) (*external.ExternalResponse, error)
+	GetNamesInfo(ctx context.Context, names []string, country string) (map[string]*external.ExternalResponse, error)
 }
 
 //go:generate mockery --name PersonRepository
 type PersonRepository interface {
-	Create(req *domain.Person) error
-	GetByID(id int) (*domain.Person, error)
-	GetWithFilterAndPagination(filter, pagination string) ([]byte, error)
-	Update(req *domain.Person) error
-	Delete(id int) (*int64, error)
+	Create(ctx context.Context, req *domain.Person, audit domain.Audit) error
+	CreateMany(ctx context.Context, reqs []domain.Person, audit domain.Audit) error
+	ClaimJobs(ctx context.Context, limit int, lease time.Duration) ([]domain.EnrichmentJob, error)
+	CompleteJob(ctx context.Context, id int64, attempts int, req *domain.Person, audit domain.Audit) error
+	RetryJob(ctx context.Context, id int64, attempts int, delay time.Duration, reason string) error
+	KillJob(ctx context.Context, id int64, attempts int, personID int, reason string, audit domain.Audit) error
+	GetJobs(ctx context.Context, status string, limit int) ([]domain.EnrichmentJob, error)
+	RequeueJob(ctx context.Context, id int64, audit domain.Audit) (*domain.EnrichmentJob, error)
+	Reenrich(ctx context.Context, req *domain.Person, version int, audit domain.Audit) error
+	GetByID(ctx context.Context, id int) (*domain.Person, error)
+	GetWithFilterAndPagination(ctx context.Context, q *query.Query) ([]domain.Person, error)
+	Count(ctx context.Context, q *query.Query) (int, error)
+	Update(ctx context.Context, req *domain.Person, version *int, audit domain.Audit) error
+	Patch(ctx context.Context, req *domain.PersonPatch, version *int, audit domain.Audit) (*domain.Person, error)
+	Delete(ctx context.Context, id int, version *int, audit domain.Audit) (*int64, error)
+	Restore(ctx context.Context, id int, version *int, audit domain.Audit) (*domain.Person, error)
+	Purge(ctx context.Context, retention time.Duration, audit domain.Audit) (*domain.PurgeResult, error)
+	GetHistory(ctx context.Context, q *query.Query) ([]domain.PersonHistory, error)
+	CountHistory(ctx context.Context, q *query.Query) (int, error)
 }
 
 var (
-	personNotFoundErr     = "person not found"
-	emptyNameOrSurnameErr = "empty name or surname"
+	personNotFoundErr        = "person not found"
+	emptyNameOrSurnameErr    = "empty name or surname"
+	invalidGenderErr         = "gender must be male or female"
+	invalidAgeErr            = "invalid age"
+	invalidPatchErr          = "invalid patch"
+	patchTestFailedErr       = "patch test failed"
+	versionMismatchErr       = "person was modified by another request"
+	deletedPersonNotFoundErr = "deleted person not found"
+	invalidRetentionErr      = "retention must be positive"
+	invalidBulkSizeErr       = "persons count must be between 1 and 100"
+	missingNameInfoErr       = "missing name info"
+	invalidJobStatusErr      = "status must be queued, running, done or dead"
+	invalidLimitErr          = "limit must be between 1 and 100"
+	deadJobNotFoundErr       = "dead job not found"
+	lookupFailedErr          = "name provider request failed"
+	lookupTimeoutErr         = "name provider timed out"
 )
 
+const maxBulkSize = 100
+
+// Enrichment policies, they decide what happens to a new person when the name providers fail.
+const (
+	// PolicyReject fails the request, nothing is saved.
+	PolicyReject = "reject"
+	// PolicyDefer saves the person with a pending enrichment, a job completes it later.
+	PolicyDefer = "defer"
+)
+
+// enrichmentActor is recorded in the history of persons changed by enrichment jobs.
+const enrichmentActor = "enrichment"
+
+const (
+	DefaultMaxJobAttempts = 5
+
+	maxJobsLimit = 100
+	// jobLease is how long a claimed job may run before another worker claims it again.
+	jobLease          = time.Minute * 5
+	jobRetryBaseDelay = time.Second * 30
+	jobRetryMaxDelay  = time.Hour
+
+	// reenrichBatchSize is how many persons ReenrichAll reads at once.
+	reenrichBatchSize = 100
+)
+
+type Config struct {
+	EnrichmentPolicy string
+	// AsyncEnrichment saves every new person as pending and leaves the lookup to the jobs.
+	AsyncEnrichment bool
+	MaxJobAttempts  int
+	// NationHint keeps the nation sent by the client and passes it to the providers as a
+	// country hint. Without it the nation is a guess like age and gender: the top candidate
+	// of nationalize overwrites it.
+	NationHint bool
+	// ReenrichRepository answers Reenrich and ReenrichAll, which must not be served from a
+	// cache. Without it they use the repository passed to NewUsecase.
+	ReenrichRepository APIRepository
+}
+
+var patchableFields = []string{"name", "surname", "patronymic", "age", "gender", "nation"}
+
 type Usecase struct {
-	apiRepository    APIRepository
-	personRepository PersonRepository
+	apiRepository       APIRepository
+	reenrichRepository  APIRepository
+	personRepository    PersonRepository
+	queryBuilder        *query.Builder
+	historyQueryBuilder *query.Builder
+	deferEnrichment     bool
+	asyncEnrichment     bool
+	maxJobAttempts      int
+	nationHint          bool
 }
 
-func NewUsecase(db *sql.DB) *Usecase {
+func NewUsecase(db *sql.DB, apiRepository APIRepository, cfg Config) *Usecase {
+	if cfg.MaxJobAttempts < 1 {
+		cfg.MaxJobAttempts = DefaultMaxJobAttempts
+	}
+
+	if cfg.ReenrichRepository == nil {
+		cfg.ReenrichRepository = apiRepository
+	}
+
 	return &Usecase{
-		apiRepository:    personAPI.NewRepository(),
-		personRepository: personPostgres.NewRepository(db),
+		apiRepository:       apiRepository,
+		reenrichRepository:  cfg.ReenrichRepository,
+		personRepository:    personPostgres.NewRepository(db),
+		queryBuilder:        personPostgres.NewQueryBuilder(),
+		historyQueryBuilder: personPostgres.NewHistoryQueryBuilder(),
+		deferEnrichment:     cfg.EnrichmentPolicy == PolicyDefer,
+		asyncEnrichment:     cfg.AsyncEnrichment,
+		maxJobAttempts:      cfg.MaxJobAttempts,
+		nationHint:          cfg.NationHint,
 	}
 }
 
-func (u *Usecase) NewPerson(req *domain.Person) (*domain.Response, error) {
+func (u *Usecase) NewPerson(ctx context.Context, req *domain.Person, audit domain.Audit) (*domain.Response, error) {
 	utils.PrepareRequest(req)
 
 	if req.Name == "" || req.Surname == "" {
@@ -54,45 +156,669 @@ func (u *Usecase) NewPerson(req *domain.Person) (*domain.Response, error) {
 		)
 	}
 
-	info, err := u.apiRepository.GetNameInfo(req.Name)
+	country := u.countryHint(req)
+
+	if u.asyncEnrichment {
+		req.EnrichmentStatus = domain.EnrichmentPending
+	} else {
+		info, err := u.apiRepository.GetNameInfo(ctx, req.Name, country)
+
+		switch {
+		case (err != nil || info.Error != nil) && u.deferrable(ctx, info, err):
+			req.EnrichmentStatus = domain.EnrichmentPending
+		case errors.Is(err, external.ErrProviderUnavailable):
+			return nil, customErrors.New(
+				external.ErrProviderUnavailable.Error(),
+				errors.Wrap(err, "NewPerson #2"),
+				http.StatusServiceUnavailable,
+			)
+		case err != nil:
+			return nil, customErrors.New(
+				http.StatusText(http.StatusInternalServerError),
+				errors.Wrap(err, "NewPerson #3"),
+				http.StatusInternalServerError,
+			)
+		case info.Error != nil:
+			return nil, customErrors.New(
+				*info.Error,
+				errors.Wrap(errors.New(*info.Error), "NewPerson #4"),
+				http.StatusServiceUnavailable,
+			)
+		default:
+			u.applyNameInfo(req, info)
+		}
+	}
+
+	if err := u.personRepository.Create(ctx, req, audit); err != nil {
+		return nil, customErrors.New(
+			http.StatusText(http.StatusInternalServerError),
+			errors.Wrap(err, "NewPerson #5"),
+			http.StatusInternalServerError,
+		)
+	}
+
+	return &domain.Response{
+		Data:       req,
+		StatusCode: createdStatus(req),
+	}, nil
+}
+
+// NewPersons creates up to maxBulkSize persons at once. Names are looked up in batches, one
+// batch per country hint, and nobody is created unless every person could be enriched.
+func (u *Usecase) NewPersons(ctx context.Context, reqs []domain.Person, audit domain.Audit) (*domain.Response, error) {
+	if len(reqs) == 0 || len(reqs) > maxBulkSize {
+		return nil, customErrors.New(
+			invalidBulkSizeErr,
+			errors.Wrap(errors.New(invalidBulkSizeErr), "NewPersons #1"),
+			http.StatusBadRequest,
+		)
+	}
+
+	namesByCountry := make(map[string][]string)
+	countries := make([]string, len(reqs))
+
+	for i := range reqs {
+		utils.PrepareRequest(&reqs[i])
+
+		if reqs[i].Name == "" || reqs[i].Surname == "" {
+			return nil, customErrors.New(
+				emptyNameOrSurnameErr,
+				errors.Wrap(errors.New(emptyNameOrSurnameErr), "NewPersons #2"),
+				http.StatusBadRequest,
+			)
+		}
+
+		countries[i] = u.countryHint(&reqs[i])
+		namesByCountry[countries[i]] = append(namesByCountry[countries[i]], reqs[i].Name)
+	}
+
+	var (
+		infos    = make(map[string]map[string]*external.ExternalResponse, len(namesByCountry))
+		deferred = make(map[string]bool)
+	)
+
+	for country, names := range namesByCountry {
+		if u.asyncEnrichment {
+			deferred[country] = true
+
+			continue
+		}
+
+		res, err := u.apiRepository.GetNamesInfo(ctx, names, country)
+
+		switch {
+		case err == nil:
+		case u.deferrable(ctx, nil, err):
+			deferred[country] = true
+		case errors.Is(err, external.ErrProviderUnavailable):
+			return nil, customErrors.New(
+				external.ErrProviderUnavailable.Error(),
+				errors.Wrap(err, "NewPersons #3"),
+				http.StatusServiceUnavailable,
+			)
+		default:
+			return nil, customErrors.New(
+				http.StatusText(http.StatusInternalServerError),
+				errors.Wrap(err, "NewPersons #4"),
+				http.StatusInternalServerError,
+			)
+		}
+
+		infos[country] = res
+	}
+
+	for i := range reqs {
+		country := countries[i]
+		info := infos[country][reqs[i].Name]
+
+		switch {
+		case deferred[country] || info != nil && info.Error != nil && u.deferrable(ctx, info, nil):
+			reqs[i].EnrichmentStatus = domain.EnrichmentPending
+		case info == nil:
+			return nil, customErrors.New(
+				http.StatusText(http.StatusInternalServerError),
+				errors.Wrap(errors.New(missingNameInfoErr), "NewPersons #5"),
+				http.StatusInternalServerError,
+			)
+		case info.Error != nil:
+			return nil, customErrors.New(
+				*info.Error,
+				errors.Wrap(errors.New(*info.Error), "NewPersons #6"),
+				http.StatusServiceUnavailable,
+			)
+		default:
+			u.applyNameInfo(&reqs[i], info)
+		}
+	}
+
+	if err := u.personRepository.CreateMany(ctx, reqs, audit); err != nil {
+		return nil, customErrors.New(
+			http.StatusText(http.StatusInternalServerError),
+			errors.Wrap(err, "NewPersons #7"),
+			http.StatusInternalServerError,
+		)
+	}
+
+	statusCode := http.StatusCreated
+
+	for i := range reqs {
+		statusCode = max(statusCode, createdStatus(&reqs[i]))
+	}
+
+	return &domain.Response{
+		Data:       reqs,
+		StatusCode: statusCode,
+	}, nil
+}
+
+// ProcessJobs claims up to limit enrichment jobs and runs them, the names are looked up in
+// batches, one per country hint. A job claimed again by another worker in the meantime is left
+// to it. It returns the number of claimed jobs.
+func (u *Usecase) ProcessJobs(ctx context.Context, limit int) (int, error) {
+	jobs, err := u.personRepository.ClaimJobs(ctx, limit, jobLease)
+	if err != nil {
+		return 0, errors.Wrap(err, "ProcessJobs #1")
+	}
+
+	byCountry := make(map[string][]*domain.EnrichmentJob)
+
+	for i := range jobs {
+		country := u.countryHint(jobs[i].Person)
+		byCountry[country] = append(byCountry[country], &jobs[i])
+	}
+
+	for country, batch := range byCountry {
+		names := make([]string, 0, len(batch))
+
+		for _, job := range batch {
+			names = append(names, job.Person.Name)
+		}
+
+		infos, lookupErr := u.apiRepository.GetNamesInfo(ctx, names, country)
+
+		for _, job := range batch {
+			err = u.finishJob(ctx, job, infos[job.Person.Name], lookupErr)
+			if err != nil && errors.Cause(err) != domain.ErrLeaseLost {
+				return len(jobs), errors.Wrap(err, "ProcessJobs #2")
+			}
+		}
+	}
+
+	return len(jobs), nil
+}
+
+// finishJob completes the job when the lookup succeeded. Otherwise the job is retried later,
+// unless the providers rejected the name or the job ran out of attempts, then it is dead.
+func (u *Usecase) finishJob(ctx context.Context, job *domain.EnrichmentJob, info *external.ExternalResponse, lookupErr error) error {
+	audit := domain.Audit{Actor: enrichmentActor}
+
+	var reason string
+
+	switch {
+	case lookupErr != nil:
+		reason = lookupReason(lookupErr)
+	case info == nil:
+		reason = missingNameInfoErr
+	case info.Error != nil:
+		reason = *info.Error
+
+		if !providerFailed(info) {
+			return errors.Wrap(u.personRepository.KillJob(ctx, job.ID, job.Attempts, job.PersonID, reason, audit), "finishJob #1")
+		}
+	default:
+		u.applyNameInfo(job.Person, info)
+
+		return errors.Wrap(u.personRepository.CompleteJob(ctx, job.ID, job.Attempts, job.Person, audit), "finishJob #2")
+	}
+
+	if job.Attempts >= u.maxJobAttempts {
+		return errors.Wrap(u.personRepository.KillJob(ctx, job.ID, job.Attempts, job.PersonID, reason, audit), "finishJob #3")
+	}
+
+	return errors.Wrap(u.personRepository.RetryJob(ctx, job.ID, job.Attempts, jobRetryDelay(job.Attempts), reason), "finishJob #4")
+}
+
+// lookupReason tells why a lookup failed without the request details, the URL of a failed
+// request carries the API key.
+func lookupReason(err error) string {
+	switch {
+	case errors.Is(err, external.ErrProviderUnavailable):
+		return external.ErrProviderUnavailable.Error()
+	case errors.Is(err, context.DeadlineExceeded):
+		return lookupTimeoutErr
+	}
+
+	return lookupFailedErr
+}
+
+// GetJobs lists the enrichment jobs with the status, dead ones by default.
+func (u *Usecase) GetJobs(ctx context.Context, status string, limit int) (*domain.Response, error) {
+	if status == "" {
+		status = domain.JobDead
+	}
+
+	if !slices.Contains([]string{domain.JobQueued, domain.JobRunning, domain.JobDone, domain.JobDead}, status) {
+		return nil, customErrors.New(
+			invalidJobStatusErr,
+			errors.Wrap(errors.New(invalidJobStatusErr), "GetJobs #1"),
+			http.StatusBadRequest,
+		)
+	}
+
+	if limit < 1 || limit > maxJobsLimit {
+		return nil, customErrors.New(
+			invalidLimitErr,
+			errors.Wrap(errors.New(invalidLimitErr), "GetJobs #2"),
+			http.StatusBadRequest,
+		)
+	}
+
+	jobs, err := u.personRepository.GetJobs(ctx, status, limit)
 	if err != nil {
 		return nil, customErrors.New(
 			http.StatusText(http.StatusInternalServerError),
-			errors.Wrap(err, "NewPerson #2"),
+			errors.Wrap(err, "GetJobs #3"),
 			http.StatusInternalServerError,
 		)
 	}
 
-	if info.Error != nil {
+	return &domain.Response{
+		Data:       jobs,
+		StatusCode: http.StatusOK,
+	}, nil
+}
+
+// RequeueJob gives a dead job another round of attempts.
+func (u *Usecase) RequeueJob(ctx context.Context, id int64, audit domain.Audit) (*domain.Response, error) {
+	job, err := u.personRepository.RequeueJob(ctx, id, audit)
+	if err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, customErrors.New(
+				deadJobNotFoundErr,
+				errors.Wrap(err, "RequeueJob #1"),
+				http.StatusNotFound,
+			)
+		}
+
 		return nil, customErrors.New(
-			*info.Error,
-			errors.Wrap(errors.New(*info.Error), "NewPerson #3"),
-			http.StatusServiceUnavailable,
+			http.StatusText(http.StatusInternalServerError),
+			errors.Wrap(err, "RequeueJob #2"),
+			http.StatusInternalServerError,
 		)
 	}
 
-	req.Age, req.Gender = info.Agify.Age, info.Genderize.Gender
+	return &domain.Response{
+		Data:       job,
+		StatusCode: http.StatusOK,
+	}, nil
+}
 
-	if len(info.Nationalize.Country) != 0 {
-		req.Nation = &info.Nationalize.Country[0].CountryId
+// Reenrich looks the person up again and overwrites age, gender, nation and their confidence
+// with the answer, a field the providers know nothing about keeps its value. A dry run writes nothing and only
+// shows what would change. A non-nil version must match the current one.
+func (u *Usecase) Reenrich(ctx context.Context, id int, version *int, dryRun bool, audit domain.Audit) (*domain.Response, error) {
+	person, err := u.personRepository.GetByID(ctx, id)
+	if err == nil && person.DeletedAt != nil {
+		err = sql.ErrNoRows
+	}
+
+	if err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, customErrors.New(
+				personNotFoundErr,
+				errors.Wrap(err, "Reenrich #1"),
+				http.StatusNotFound,
+			)
+		}
+
+		return nil, customErrors.New(
+			http.StatusText(http.StatusInternalServerError),
+			errors.Wrap(err, "Reenrich #2"),
+			http.StatusInternalServerError,
+		)
+	}
+
+	if version != nil && person.Version != *version {
+		return nil, customErrors.New(
+			versionMismatchErr,
+			errors.Wrap(domain.ErrVersionMismatch, "Reenrich #3"),
+			http.StatusPreconditionFailed,
+		)
 	}
 
-	if err = u.personRepository.Create(req); err != nil {
+	info, err := u.reenrichRepository.GetNameInfo(ctx, person.Name, u.countryHint(person))
+	if err != nil {
 		return nil, customErrors.New(
 			http.StatusText(http.StatusInternalServerError),
-			errors.Wrap(err, "NewPerson #4"),
+			errors.Wrap(err, "Reenrich #4"),
 			http.StatusInternalServerError,
 		)
 	}
 
+	if info.Error != nil {
+		return nil, customErrors.New(
+			*info.Error,
+			errors.Wrap(errors.New(*info.Error), "Reenrich #5"),
+			http.StatusServiceUnavailable,
+		)
+	}
+
+	res := u.reenrichment(person, info)
+
+	if !dryRun {
+		if err = u.personRepository.Reenrich(ctx, res.Person, person.Version, audit); err != nil {
+			switch errors.Cause(err) {
+			case sql.ErrNoRows:
+				return nil, customErrors.New(
+					personNotFoundErr,
+					errors.Wrap(err, "Reenrich #6"),
+					http.StatusNotFound,
+				)
+			case domain.ErrVersionMismatch:
+				return nil, customErrors.New(
+					versionMismatchErr,
+					errors.Wrap(err, "Reenrich #7"),
+					http.StatusPreconditionFailed,
+				)
+			}
+
+			return nil, customErrors.New(
+				http.StatusText(http.StatusInternalServerError),
+				errors.Wrap(err, "Reenrich #8"),
+				http.StatusInternalServerError,
+			)
+		}
+
+		res.Applied = true
+	}
+
 	return &domain.Response{
-		Data:       req,
-		StatusCode: http.StatusCreated,
+		Data:       res,
+		StatusCode: http.StatusOK,
 	}, nil
 }
 
-func (u *Usecase) GetByID(id int) (*domain.Response, error) {
-	person, err := u.personRepository.GetByID(id)
+// ReenrichAll re-enriches the live persons matching where, with a positive olderThan only those
+// enriched longer ago than that or never. Persons are read in pages by id and looked up in batches, one
+// per country hint. report gets the outcome of every person in id order, a failed lookup or
+// write does not stop the run. It returns the number of matching persons.
+func (u *Usecase) ReenrichAll(ctx context.Context, where *domain.FilterGroup, olderThan time.Duration, dryRun bool, audit domain.Audit, report func(person *domain.Person, res *domain.Reenrichment, err error)) (int, error) {
+	// enriched_at has no time zone and is written by sessions in UTC
+	cutoff := time.Now().UTC().Add(-olderThan).Format(time.RFC3339Nano)
+
+	if olderThan > 0 {
+		stale := domain.FilterGroup{
+			Operator: query.GroupOr,
+			Filter: []domain.Filter{
+				{Field: "enriched_at", Operator: query.OpIsNull, Value: true},
+				{Field: "enriched_at", Operator: query.OpLt, Value: cutoff},
+			},
+		}
+
+		if where != nil {
+			stale = domain.FilterGroup{Operator: query.GroupAnd, Groups: []domain.FilterGroup{*where, stale}}
+		}
+
+		where = &stale
+	}
+
+	var matched, lastID int
+
+	for {
+		req := &domain.FilterWithPagination{
+			Filter: []domain.Filter{
+				{Field: "deleted_at", Operator: query.OpIsNull, Value: true},
+				{Field: "id", Operator: query.OpGt, Value: lastID},
+			},
+			Where: where,
+			Sort:  []domain.Sort{{Field: "id", Direction: query.SortAsc}},
+			Pagination: &domain.Pagination{
+				Limit: reenrichBatchSize,
+				Page:  1,
+				Count: query.CountNone,
+			},
+		}
+
+		q, err := u.queryBuilder.Build(req)
+		if err != nil {
+			return matched, errors.Wrap(err, "ReenrichAll #1")
+		}
+
+		persons, err := u.personRepository.GetWithFilterAndPagination(ctx, q)
+		if err != nil {
+			return matched, errors.Wrap(err, "ReenrichAll #2")
+		}
+
+		// the page holds one row more than the limit when there is a next one
+		more := len(persons) > reenrichBatchSize
+		persons = persons[:min(len(persons), reenrichBatchSize)]
+
+		if len(persons) == 0 {
+			return matched, nil
+		}
+
+		matched, lastID = matched+len(persons), persons[len(persons)-1].ID
+
+		byCountry := make(map[string][]int)
+
+		for i := range persons {
+			country := u.countryHint(&persons[i])
+			byCountry[country] = append(byCountry[country], i)
+		}
+
+		results := make([]*domain.Reenrichment, len(persons))
+		errs := make([]error, len(persons))
+
+		for country, batch := range byCountry {
+			names := make([]string, 0, len(batch))
+
+			for _, i := range batch {
+				names = append(names, persons[i].Name)
+			}
+
+			infos, lookupErr := u.reenrichRepository.GetNamesInfo(ctx, names, country)
+
+			for _, i := range batch {
+				results[i], errs[i] = u.reenrichOne(ctx, &persons[i], infos[persons[i].Name], lookupErr, dryRun, audit)
+			}
+		}
+
+		for i := range persons {
+			report(&persons[i], results[i], errs[i])
+		}
+
+		if err = ctx.Err(); err != nil {
+			return matched, errors.Wrap(err, "ReenrichAll #3")
+		}
+
+		if !more {
+			return matched, nil
+		}
+	}
+}
+
+func (u *Usecase) reenrichOne(ctx context.Context, person *domain.Person, info *external.ExternalResponse, lookupErr error, dryRun bool, audit domain.Audit) (*domain.Reenrichment, error) {
+	switch {
+	case lookupErr != nil:
+		return nil, errors.Wrap(lookupErr, "reenrichOne #1")
+	case info == nil:
+		return nil, errors.Wrap(errors.New(missingNameInfoErr), "reenrichOne #2")
+	case info.Error != nil:
+		return nil, errors.Wrap(errors.New(*info.Error), "reenrichOne #3")
+	}
+
+	res := u.reenrichment(person, info)
+
+	if !dryRun {
+		if err := u.personRepository.Reenrich(ctx, res.Person, person.Version, audit); err != nil {
+			return nil, errors.Wrap(err, "reenrichOne #4")
+		}
+
+		res.Applied = true
+	}
+
+	return res, nil
+}
+
+// nationalities lists the candidate countries of the name in the order nationalize ranks them.
+func nationalities(info *external.ExternalResponse) []domain.Nationality {
+	res := make([]domain.Nationality, len(info.Nationalize.Country))
+
+	for i, c := range info.Nationalize.Country {
+		res[i] = domain.Nationality{
+			CountryID:   c.CountryId,
+			Probability: c.Probability,
+			Rank:        i + 1,
+		}
+	}
+
+	return res
+}
+
+// reenrichment applies the answer of the providers to a copy of the person and lists the
+// fields it changes.
+func (u *Usecase) reenrichment(person *domain.Person, info *external.ExternalResponse) *domain.Reenrichment {
+	updated := *person
+
+	if info.Agify.Age != nil {
+		updated.Age, updated.AgeCount = info.Agify.Age, info.Agify.Count
+	}
+
+	if info.Genderize.Gender != nil {
+		updated.Gender, updated.GenderProbability, updated.GenderCount = info.Genderize.Gender, info.Genderize.Probability, info.Genderize.Count
+	}
+
+	if len(info.Nationalize.Country) != 0 {
+		u.applyNation(&updated, info)
+		updated.Nationalities = nationalities(info)
+	}
+
+	fields := []struct {
+		name     string
+		old, new any
+	}{
+		{"age", person.Age, updated.Age},
+		{"age_count", person.AgeCount, updated.AgeCount},
+		{"gender", person.Gender, updated.Gender},
+		{"gender_probability", person.GenderProbability, updated.GenderProbability},
+		{"gender_count", person.GenderCount, updated.GenderCount},
+		{"nation", person.Nation, updated.Nation},
+		{"nation_probability", person.NationProbability, updated.NationProbability},
+		{"nation_count", person.NationCount, updated.NationCount},
+		{"nationalities", person.Nationalities, updated.Nationalities},
+	}
+
+	changes := make(map[string]domain.Change)
+
+	for _, f := range fields {
+		if !reflect.DeepEqual(f.old, f.new) {
+			changes[f.name] = domain.Change{Old: f.old, New: f.new}
+		}
+	}
+
+	return &domain.Reenrichment{
+		Person:  &updated,
+		Changes: changes,
+	}
+}
+
+// jobRetryDelay doubles the delay with every failed attempt.
+func jobRetryDelay(attempts int) time.Duration {
+	if attempts < 1 || attempts > 16 {
+		return jobRetryMaxDelay
+	}
+
+	return min(jobRetryBaseDelay<<(attempts-1), jobRetryMaxDelay)
+}
+
+// createdStatus tells a person that still waits for the enrichment apart from a finished one.
+func createdStatus(req *domain.Person) int {
+	if req.EnrichmentStatus == domain.EnrichmentPending {
+		return http.StatusAccepted
+	}
+
+	return http.StatusCreated
+}
+
+// deferrable reports whether a person can be saved with a pending enrichment: the policy
+// allows it and the providers failed, rather than rejected the name.
+func (u *Usecase) deferrable(ctx context.Context, info *external.ExternalResponse, err error) bool {
+	if !u.deferEnrichment || ctx.Err() != nil {
+		return false
+	}
+
+	return err != nil || providerFailed(info)
+}
+
+// providerFailed tells a provider that is down or out of quota from one that rejected the name.
+func providerFailed(info *external.ExternalResponse) bool {
+	return info.StatusCode == http.StatusTooManyRequests || info.StatusCode >= http.StatusInternalServerError
+}
+
+// countryHint normalizes the nation sent by the client and returns it as the country hint of
+// the lookups, there is no hint unless the usecase is configured with NationHint.
+func (u *Usecase) countryHint(req *domain.Person) string {
+	if req.Nation == nil {
+		return ""
+	}
+
+	country := strings.ToUpper(strings.TrimSpace(*req.Nation))
+	if country == "" {
+		req.Nation = nil
+
+		return ""
+	}
+
+	req.Nation = &country
+
+	if !u.nationHint {
+		return ""
+	}
+
+	return country
+}
+
+// applyNameInfo fills in what the providers know along with their confidence.
+func (u *Usecase) applyNameInfo(req *domain.Person, info *external.ExternalResponse) {
+	req.Age, req.AgeCount = info.Agify.Age, info.Agify.Count
+	req.Gender, req.GenderProbability, req.GenderCount = info.Genderize.Gender, info.Genderize.Probability, info.Genderize.Count
+	req.Nationalities = nationalities(info)
+	req.EnrichmentStatus = domain.EnrichmentDone
+
+	u.applyNation(req, info)
+}
+
+// applyNation makes the top candidate of nationalize the nation, unless a nation hint was given:
+// then the nation is kept and gets the probability nationalize has for it, none when it is not
+// among the candidates.
+func (u *Usecase) applyNation(req *domain.Person, info *external.ExternalResponse) {
+	if u.nationHint && req.Nation != nil {
+		req.NationProbability, req.NationCount = nil, nil
+
+		for _, c := range info.Nationalize.Country {
+			if c.CountryId == *req.Nation {
+				req.NationProbability, req.NationCount = utils.Float64ToPtr(c.Probability), info.Nationalize.Count
+
+				break
+			}
+		}
+
+		return
+	}
+
+	if len(info.Nationalize.Country) != 0 {
+		req.Nation, req.NationProbability = &info.Nationalize.Country[0].CountryId, &info.Nationalize.Country[0].Probability
+		req.NationCount = info.Nationalize.Count
+	}
+}
+
+// GetByID returns the person, deleted persons are only returned with includeDeleted.
+func (u *Usecase) GetByID(ctx context.Context, id int, includeDeleted bool) (*domain.Response, error) {
+	person, err := u.personRepository.GetByID(ctx, id)
+	if err == nil && person.DeletedAt != nil && !includeDeleted {
+		err = sql.ErrNoRows
+	}
+
 	if err != nil {
 		if errors.Cause(err) == sql.ErrNoRows {
 			return nil, customErrors.New(
@@ -115,17 +841,26 @@ func (u *Usecase) GetByID(id int) (*domain.Response, error) {
 	}, nil
 }
 
-func (u *Usecase) GetWithFilterAndPagination(req *domain.FilterWithPagination) (*domain.Response, error) {
-	result, err := utils.GetFilterAndPagination(req, "pt")
+func (u *Usecase) GetWithFilterAndPagination(ctx context.Context, req *domain.FilterWithPagination) (*domain.Response, error) {
+	if !req.IncludeDeleted {
+		req.Filter = append(req.Filter, domain.Filter{
+			Field:    "deleted_at",
+			Operator: query.OpIsNull,
+			Value:    true,
+		})
+	}
+
+	q, err := u.queryBuilder.Build(req)
 	if err != nil {
-		return nil, customErrors.New(
+		return nil, customErrors.NewWithDetails(
 			err.Error(),
+			err,
 			errors.Wrap(err, "GetWithFilterAndPagination #1"),
 			http.StatusBadRequest,
 		)
 	}
 
-	b, err := u.personRepository.GetWithFilterAndPagination(result[0], result[1])
+	persons, err := u.personRepository.GetWithFilterAndPagination(ctx, q)
 	if err != nil {
 		return nil, customErrors.New(
 			http.StatusText(http.StatusInternalServerError),
@@ -134,27 +869,175 @@ func (u *Usecase) GetWithFilterAndPagination(req *domain.FilterWithPagination) (
 		)
 	}
 
+	persons, meta, err := paginate(ctx, req, q, persons, u.personRepository.Count)
+	if err != nil {
+		return nil, customErrors.New(
+			http.StatusText(http.StatusInternalServerError),
+			errors.Wrap(err, "GetWithFilterAndPagination #3"),
+			http.StatusInternalServerError,
+		)
+	}
+
+	b, err := json.Marshal(domain.PersonList{
+		Data: persons,
+		Meta: *meta,
+	})
+	if err != nil {
+		return nil, customErrors.New(
+			http.StatusText(http.StatusInternalServerError),
+			errors.Wrap(err, "GetWithFilterAndPagination #4"),
+			http.StatusInternalServerError,
+		)
+	}
+
+	return &domain.Response{
+		StatusCode: http.StatusOK,
+		Data:       b,
+	}, nil
+}
+
+// GetHistory lists the recorded changes of the person, newest first unless req sorts otherwise.
+// The history of deleted and purged persons is only listed with includeDeleted.
+func (u *Usecase) GetHistory(ctx context.Context, id int, includeDeleted bool, req *domain.FilterWithPagination) (*domain.Response, error) {
+	if !includeDeleted {
+		person, err := u.personRepository.GetByID(ctx, id)
+		if err == nil && person.DeletedAt != nil {
+			err = sql.ErrNoRows
+		}
+
+		if err != nil {
+			if errors.Cause(err) == sql.ErrNoRows {
+				return nil, customErrors.New(
+					personNotFoundErr,
+					errors.Wrap(err, "GetHistory #1"),
+					http.StatusNotFound,
+				)
+			}
+
+			return nil, customErrors.New(
+				http.StatusText(http.StatusInternalServerError),
+				errors.Wrap(err, "GetHistory #2"),
+				http.StatusInternalServerError,
+			)
+		}
+	}
+
+	req.Filter = append(req.Filter, domain.Filter{
+		Field:    "person_id",
+		Operator: query.OpEq,
+		Value:    id,
+	})
+
+	q, err := u.historyQueryBuilder.Build(req)
+	if err != nil {
+		return nil, customErrors.NewWithDetails(
+			err.Error(),
+			err,
+			errors.Wrap(err, "GetHistory #3"),
+			http.StatusBadRequest,
+		)
+	}
+
+	// the history of a person is small enough to be counted exactly
+	if req.Pagination.Count == query.CountEstimate {
+		req.Pagination.Count = query.CountExact
+	}
+
+	history, err := u.personRepository.GetHistory(ctx, q)
+	if err != nil {
+		return nil, customErrors.New(
+			http.StatusText(http.StatusInternalServerError),
+			errors.Wrap(err, "GetHistory #4"),
+			http.StatusInternalServerError,
+		)
+	}
+
+	history, meta, err := paginate(ctx, req, q, history, u.personRepository.CountHistory)
+	if err != nil {
+		return nil, customErrors.New(
+			http.StatusText(http.StatusInternalServerError),
+			errors.Wrap(err, "GetHistory #5"),
+			http.StatusInternalServerError,
+		)
+	}
+
+	b, err := json.Marshal(domain.PersonHistoryList{
+		Data: history,
+		Meta: *meta,
+	})
+	if err != nil {
+		return nil, customErrors.New(
+			http.StatusText(http.StatusInternalServerError),
+			errors.Wrap(err, "GetHistory #6"),
+			http.StatusInternalServerError,
+		)
+	}
+
 	return &domain.Response{
 		StatusCode: http.StatusOK,
 		Data:       b,
 	}, nil
 }
 
-func (u *Usecase) Update(req *domain.Person) (*domain.Response, error) {
+// paginate trims the rows of a built query to the requested page and describes it,
+// the matching rows are counted with count unless the request turned counting off.
+func paginate[T any](ctx context.Context, req *domain.FilterWithPagination, q *query.Query, rows []T, count func(ctx context.Context, q *query.Query) (int, error)) ([]T, *domain.Meta, error) {
+	rows, page, err := query.Paginate(q, rows)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	meta := domain.Meta{
+		CountMode:  req.Pagination.Count,
+		Mode:       req.Pagination.Mode,
+		Limit:      req.Pagination.Limit,
+		HasNext:    page.HasNext,
+		HasPrev:    page.HasPrev,
+		NextCursor: page.Next,
+		PrevCursor: page.Prev,
+	}
+
+	if req.Pagination.Mode == query.ModePage {
+		meta.Page = &req.Pagination.Page
+	}
+
+	if req.Pagination.Count != query.CountNone {
+		total, err := count(ctx, q)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		totalPages := (total + req.Pagination.Limit - 1) / req.Pagination.Limit
+
+		meta.AllRowCount, meta.TotalPages = &total, &totalPages
+	}
+
+	return rows, &meta, nil
+}
+
+// Update overwrites the person, a non-nil version must match the current one.
+func (u *Usecase) Update(ctx context.Context, req *domain.Person, version *int, audit domain.Audit) (*domain.Response, error) {
 	utils.PrepareRequest(req)
 
-	if err := u.personRepository.Update(req); err != nil {
-		if errors.Cause(err) == sql.ErrNoRows {
+	if err := u.personRepository.Update(ctx, req, version, audit); err != nil {
+		switch errors.Cause(err) {
+		case sql.ErrNoRows:
 			return nil, customErrors.New(
 				personNotFoundErr,
 				errors.Wrap(err, "Update #1"),
 				http.StatusNotFound,
 			)
+		case domain.ErrVersionMismatch:
+			return nil, customErrors.New(
+				versionMismatchErr,
+				errors.Wrap(err, "Update #2"),
+				http.StatusPreconditionFailed,
+			)
 		}
 
 		return nil, customErrors.New(
 			http.StatusText(http.StatusInternalServerError),
-			errors.Wrap(err, "Update #2"),
+			errors.Wrap(err, "Update #3"),
 			http.StatusInternalServerError,
 		)
 	}
@@ -165,12 +1048,175 @@ func (u *Usecase) Update(req *domain.Person) (*domain.Response, error) {
 	}, nil
 }
 
-func (u *Usecase) Delete(id int) (*domain.Response, error) {
-	aff, err := u.personRepository.Delete(id)
+// Patch writes the fields that are set in req, a non-nil version must match the current one.
+func (u *Usecase) Patch(ctx context.Context, req *domain.PersonPatch, version *int, audit domain.Audit) (*domain.Response, error) {
+	utils.PreparePatch(req)
+
+	if msg := validatePatch(req); msg != "" {
+		return nil, customErrors.New(
+			msg,
+			errors.Wrap(errors.New(msg), "Patch #1"),
+			http.StatusBadRequest,
+		)
+	}
+
+	var (
+		person *domain.Person
+		err    error
+	)
+
+	if req.IsEmpty() {
+		person, err = u.personRepository.GetByID(ctx, req.ID)
+
+		switch {
+		case err != nil:
+		case person.DeletedAt != nil:
+			err = sql.ErrNoRows
+		case version != nil && person.Version != *version:
+			err = domain.ErrVersionMismatch
+		}
+	} else {
+		person, err = u.personRepository.Patch(ctx, req, version, audit)
+	}
+
+	if err != nil {
+		switch errors.Cause(err) {
+		case sql.ErrNoRows:
+			return nil, customErrors.New(
+				personNotFoundErr,
+				errors.Wrap(err, "Patch #2"),
+				http.StatusNotFound,
+			)
+		case domain.ErrVersionMismatch:
+			return nil, customErrors.New(
+				versionMismatchErr,
+				errors.Wrap(err, "Patch #3"),
+				http.StatusPreconditionFailed,
+			)
+		}
+
+		return nil, customErrors.New(
+			http.StatusText(http.StatusInternalServerError),
+			errors.Wrap(err, "Patch #4"),
+			http.StatusInternalServerError,
+		)
+	}
+
+	return &domain.Response{
+		Data:       person,
+		StatusCode: http.StatusOK,
+	}, nil
+}
+
+// JSONPatch applies RFC 6902 operations to the current state of the person
+// and writes the fields that changed as a partial update. The write is conditional
+// on the version the operations were applied to, so "test" operations hold.
+func (u *Usecase) JSONPatch(ctx context.Context, id int, ops []domain.PatchOperation, version *int, audit domain.Audit) (*domain.Response, error) {
+	person, err := u.personRepository.GetByID(ctx, id)
+	if err == nil && person.DeletedAt != nil {
+		err = sql.ErrNoRows
+	}
+
+	if err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, customErrors.New(
+				personNotFoundErr,
+				errors.Wrap(err, "JSONPatch #1"),
+				http.StatusNotFound,
+			)
+		}
+
+		return nil, customErrors.New(
+			http.StatusText(http.StatusInternalServerError),
+			errors.Wrap(err, "JSONPatch #2"),
+			http.StatusInternalServerError,
+		)
+	}
+
+	if version != nil && person.Version != *version {
+		return nil, customErrors.New(
+			versionMismatchErr,
+			errors.Wrap(domain.ErrVersionMismatch, "JSONPatch #3"),
+			http.StatusPreconditionFailed,
+		)
+	}
+
+	original, err := toDocument(person)
+	if err != nil {
+		return nil, customErrors.New(
+			http.StatusText(http.StatusInternalServerError),
+			errors.Wrap(err, "JSONPatch #4"),
+			http.StatusInternalServerError,
+		)
+	}
+
+	doc := maps.Clone(original)
+
+	if err = jsonpatch.Apply(doc, ops, patchableFields); err != nil {
+		var testErr *jsonpatch.TestError
+		if errors.As(err, &testErr) {
+			return nil, customErrors.NewWithDetails(
+				patchTestFailedErr,
+				testErr,
+				errors.Wrap(err, "JSONPatch #5"),
+				http.StatusConflict,
+			)
+		}
+
+		return nil, customErrors.NewWithDetails(
+			invalidPatchErr,
+			err,
+			errors.Wrap(err, "JSONPatch #6"),
+			http.StatusUnprocessableEntity,
+		)
+	}
+
+	changed := make(map[string]any)
+
+	for _, field := range patchableFields {
+		if !reflect.DeepEqual(doc[field], original[field]) {
+			changed[field] = doc[field]
+		}
+	}
+
+	b, err := json.Marshal(changed)
 	if err != nil {
 		return nil, customErrors.New(
 			http.StatusText(http.StatusInternalServerError),
-			errors.Wrap(err, "Delete #1"),
+			errors.Wrap(err, "JSONPatch #7"),
+			http.StatusInternalServerError,
+		)
+	}
+
+	patch := domain.PersonPatch{
+		ID: id,
+	}
+
+	if err = json.Unmarshal(b, &patch); err != nil {
+		return nil, customErrors.New(
+			invalidPatchErr,
+			errors.Wrap(err, "JSONPatch #8"),
+			http.StatusUnprocessableEntity,
+		)
+	}
+
+	return u.Patch(ctx, &patch, &person.Version, audit)
+}
+
+func (u *Usecase) Delete(ctx context.Context, id int, version *int, audit domain.Audit) (*domain.Response, error) {
+	aff, err := u.personRepository.Delete(ctx, id, version, audit)
+	if err != nil {
+		if errors.Cause(err) == domain.ErrVersionMismatch {
+			return nil, customErrors.New(
+				versionMismatchErr,
+				errors.Wrap(err, "Delete #1"),
+				http.StatusPreconditionFailed,
+			)
+		}
+
+		return nil, customErrors.New(
+			http.StatusText(http.StatusInternalServerError),
+			errors.Wrap(err, "Delete #2"),
 			http.StatusInternalServerError,
 		)
 	}
@@ -178,7 +1224,7 @@ func (u *Usecase) Delete(id int) (*domain.Response, error) {
 	if *aff == 0 {
 		return nil, customErrors.New(
 			personNotFoundErr,
-			errors.Wrap(errors.New(personNotFoundErr), "Delete #2"),
+			errors.Wrap(errors.New(personNotFoundErr), "Delete #3"),
 			http.StatusNotFound,
 		)
 	}
@@ -188,3 +1234,92 @@ func (u *Usecase) Delete(id int) (*domain.Response, error) {
 		StatusCode: http.StatusOK,
 	}, nil
 }
+
+// Restore brings back a deleted person, a non-nil version must match the current one.
+func (u *Usecase) Restore(ctx context.Context, id int, version *int, audit domain.Audit) (*domain.Response, error) {
+	person, err := u.personRepository.Restore(ctx, id, version, audit)
+	if err != nil {
+		switch errors.Cause(err) {
+		case sql.ErrNoRows:
+			return nil, customErrors.New(
+				deletedPersonNotFoundErr,
+				errors.Wrap(err, "Restore #1"),
+				http.StatusNotFound,
+			)
+		case domain.ErrVersionMismatch:
+			return nil, customErrors.New(
+				versionMismatchErr,
+				errors.Wrap(err, "Restore #2"),
+				http.StatusPreconditionFailed,
+			)
+		}
+
+		return nil, customErrors.New(
+			http.StatusText(http.StatusInternalServerError),
+			errors.Wrap(err, "Restore #3"),
+			http.StatusInternalServerError,
+		)
+	}
+
+	return &domain.Response{
+		Data:       person,
+		StatusCode: http.StatusOK,
+	}, nil
+}
+
+// Purge removes the persons deleted more than retention ago for good.
+func (u *Usecase) Purge(ctx context.Context, retention time.Duration, audit domain.Audit) (*domain.Response, error) {
+	if retention <= 0 {
+		return nil, customErrors.New(
+			invalidRetentionErr,
+			errors.Wrap(errors.New(invalidRetentionErr), "Purge #1"),
+			http.StatusBadRequest,
+		)
+	}
+
+	res, err := u.personRepository.Purge(ctx, retention, audit)
+	if err != nil {
+		return nil, customErrors.New(
+			http.StatusText(http.StatusInternalServerError),
+			errors.Wrap(err, "Purge #2"),
+			http.StatusInternalServerError,
+		)
+	}
+
+	return &domain.Response{
+		Data:       res,
+		StatusCode: http.StatusOK,
+	}, nil
+}
+
+func validatePatch(req *domain.PersonPatch) string {
+	if (req.Name.Set && (req.Name.Value == nil || *req.Name.Value == "")) ||
+		(req.Surname.Set && (req.Surname.Value == nil || *req.Surname.Value == "")) {
+		return emptyNameOrSurnameErr
+	}
+
+	if req.Gender.Value != nil && *req.Gender.Value != "male" && *req.Gender.Value != "female" {
+		return invalidGenderErr
+	}
+
+	if req.Age.Value != nil && (*req.Age.Value < 0 || *req.Age.Value > math.MaxInt16) {
+		return invalidAgeErr
+	}
+
+	return ""
+}
+
+func toDocument(person *domain.Person) (map[string]any, error) {
+	b, err := json.Marshal(person)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]any
+
+	if err = json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
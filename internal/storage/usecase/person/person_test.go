@@ -1,22 +1,35 @@
 package person
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"namer/internal/customErrors"
 	"namer/internal/domain"
 	"namer/internal/domain/external"
+	personAPI "namer/internal/storage/repository/api/person"
+	personPostgres "namer/internal/storage/repository/postgres/person"
 	"namer/internal/storage/usecase/person/mocks"
+	"namer/pkg/query"
 	"namer/pkg/utils"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 )
 
 func newUsecase(apiRepo APIRepository, personRepo PersonRepository) *Usecase {
 	return &Usecase{
-		apiRepository:    apiRepo,
-		personRepository: personRepo,
+		apiRepository:       apiRepo,
+		reenrichRepository:  apiRepo,
+		personRepository:    personRepo,
+		queryBuilder:        personPostgres.NewQueryBuilder(),
+		historyQueryBuilder: personPostgres.NewHistoryQueryBuilder(),
+		maxJobAttempts:      DefaultMaxJobAttempts,
 	}
 }
 
@@ -46,27 +59,78 @@ func TestNewPerson(t *testing.T) {
 		Nationalize: &external.NationalizeResponse{
 			Count: utils.IntToPtr(30),
 			Name:  utils.StringToPtr("Helen"),
-			Country: []struct {
-				CountryId   string  `json:"country_id"`
-				Probability float64 `json:"probability"`
-			}{
+			Country: []external.CountryProbability{
 				{CountryId: "GB", Probability: 0.1},
 			},
 		},
 	}
 
 	t.Run("success", func(t *testing.T) {
-		mockAPIRepository.On("GetNameInfo", person.Name).Return(&extRes, nil).Once()
+		mockAPIRepository.On("GetNameInfo", mock.Anything, person.Name, "").Return(&extRes, nil).Once()
 
-		mockPersonRepository.On("Create", &person).Return(nil).Once()
+		mockPersonRepository.On("Create", mock.Anything, &person, domain.Audit{}).Return(nil).Once()
 
-		res, err := usecase.NewPerson(&person)
+		res, err := usecase.NewPerson(context.Background(), &person, domain.Audit{})
 		assert.NoError(t, err)
 		assert.NotNil(t, res)
+
+		assert.Equal(t, 30, *person.AgeCount)
+		assert.Equal(t, 0.1, *person.GenderProbability)
+		assert.Equal(t, 0.1, *person.NationProbability)
+		assert.Equal(t, 30, *person.NationCount)
+		assert.Equal(t, []domain.Nationality{{CountryID: "GB", Probability: 0.1, Rank: 1}}, person.Nationalities)
+	})
+
+	t.Run("success_nation_overwritten", func(t *testing.T) {
+		sent := domain.Person{
+			Name:    "Helen",
+			Surname: "Johnson",
+			Nation:  utils.StringToPtr(" us "),
+		}
+
+		mockAPIRepository.On("GetNameInfo", mock.Anything, sent.Name, "").Return(&extRes, nil).Once()
+
+		mockPersonRepository.On("Create", mock.Anything, &sent, domain.Audit{}).Return(nil).Once()
+
+		_, err := usecase.NewPerson(context.Background(), &sent, domain.Audit{})
+		require.NoError(t, err)
+
+		assert.Equal(t, "GB", *sent.Nation)
+		assert.Equal(t, 0.1, *sent.NationProbability)
+	})
+
+	t.Run("success_country_hint", func(t *testing.T) {
+		usecase := newUsecase(mockAPIRepository, mockPersonRepository)
+		usecase.nationHint = true
+
+		for nation, probability := range map[string]*float64{" us ": nil, "gb": utils.Float64ToPtr(0.1)} {
+			hinted := domain.Person{
+				Name:    "Helen",
+				Surname: "Johnson",
+				Nation:  utils.StringToPtr(nation),
+			}
+
+			country := strings.ToUpper(strings.TrimSpace(nation))
+
+			mockAPIRepository.On("GetNameInfo", mock.Anything, hinted.Name, country).Return(&extRes, nil).Once()
+
+			mockPersonRepository.On("Create", mock.Anything, &hinted, domain.Audit{}).Return(nil).Once()
+
+			res, err := usecase.NewPerson(context.Background(), &hinted, domain.Audit{})
+			assert.NoError(t, err)
+			assert.NotNil(t, res)
+
+			if assert.NotNil(t, hinted.Nation) {
+				assert.Equal(t, country, *hinted.Nation)
+			}
+
+			assert.Equal(t, probability, hinted.NationProbability)
+			assert.Len(t, hinted.Nationalities, 1)
+		}
 	})
 
 	t.Run("error_empty_name_or_surname", func(t *testing.T) {
-		res, err := usecase.NewPerson(&domain.Person{})
+		res, err := usecase.NewPerson(context.Background(), &domain.Person{}, domain.Audit{})
 		if assert.Error(t, err) {
 			assert.Equal(t, emptyNameOrSurnameErr, errors.Cause(err).Error())
 		}
@@ -74,12 +138,12 @@ func TestNewPerson(t *testing.T) {
 	})
 
 	t.Run("error_external_api", func(t *testing.T) {
-		mockAPIRepository.On("GetNameInfo", person.Name).Return(
+		mockAPIRepository.On("GetNameInfo", mock.Anything, person.Name, mock.Anything).Return(
 			nil,
 			errors.New(http.StatusText(http.StatusInternalServerError)),
 		).Once()
 
-		res, err := usecase.NewPerson(&person)
+		res, err := usecase.NewPerson(context.Background(), &person, domain.Audit{})
 		if assert.Error(t, err) {
 			assert.Equal(t, http.StatusText(http.StatusInternalServerError), errors.Cause(err).Error())
 		}
@@ -87,15 +151,31 @@ func TestNewPerson(t *testing.T) {
 		assert.Nil(t, res)
 	})
 
+	t.Run("error_provider_unavailable", func(t *testing.T) {
+		mockAPIRepository.On("GetNameInfo", mock.Anything, person.Name, mock.Anything).Return(
+			nil,
+			errors.Wrap(external.ErrProviderUnavailable, "do #2"),
+		).Once()
+
+		res, err := usecase.NewPerson(context.Background(), &person, domain.Audit{})
+		var ce customErrors.Error
+		if assert.ErrorAs(t, err, &ce) {
+			assert.Equal(t, http.StatusServiceUnavailable, ce.StatusCode)
+			assert.Equal(t, external.ErrProviderUnavailable, errors.Cause(err))
+		}
+
+		assert.Nil(t, res)
+	})
+
 	t.Run("error_external_bad_request", func(t *testing.T) {
-		mockAPIRepository.On("GetNameInfo", person.Name).Return(
+		mockAPIRepository.On("GetNameInfo", mock.Anything, person.Name, mock.Anything).Return(
 			&external.ExternalResponse{
 				Error: utils.StringToPtr("Missing 'name' parameter"),
 			},
 			nil,
 		).Once()
 
-		res, err := usecase.NewPerson(&person)
+		res, err := usecase.NewPerson(context.Background(), &person, domain.Audit{})
 		if assert.Error(t, err) {
 			assert.Equal(t, "Missing 'name' parameter", errors.Cause(err).Error())
 		}
@@ -104,59 +184,865 @@ func TestNewPerson(t *testing.T) {
 	})
 
 	t.Run("error_postgres_create", func(t *testing.T) {
-		mockAPIRepository.On("GetNameInfo", person.Name).Return(&extRes, nil).Once()
+		mockAPIRepository.On("GetNameInfo", mock.Anything, person.Name, mock.Anything).Return(&extRes, nil).Once()
+
+		mockPersonRepository.On("Create", mock.Anything, &person, domain.Audit{}).Return(
+			errors.New("pg_error"),
+		).Once()
+
+		res, err := usecase.NewPerson(context.Background(), &person, domain.Audit{})
+		if assert.Error(t, err) {
+			assert.Equal(t, "pg_error", errors.Cause(err).Error())
+		}
+
+		assert.Nil(t, res)
+	})
+}
+
+func TestNewPersons(t *testing.T) {
+	mockAPIRepository := new(mocks.APIRepository)
+	mockPersonRepository := new(mocks.PersonRepository)
+
+	usecase := newUsecase(mockAPIRepository, mockPersonRepository)
+
+	info := func(age int, nation string) *external.ExternalResponse {
+		return &external.ExternalResponse{
+			Agify:     &external.AgifyResponse{Age: utils.IntToPtr(age)},
+			Genderize: &external.GenderizeResponse{Gender: utils.StringToPtr("female")},
+			Nationalize: &external.NationalizeResponse{
+				Country: []external.CountryProbability{
+					{CountryId: nation, Probability: 0.1},
+				},
+			},
+		}
+	}
+
+	t.Run("success", func(t *testing.T) {
+		usecase := newUsecase(mockAPIRepository, mockPersonRepository)
+		usecase.nationHint = true
+
+		persons := []domain.Person{
+			{Name: "Helen", Surname: "Johnson"},
+			{Name: "Anna", Surname: "Smith"},
+			{Name: "Helen", Surname: "Brown", Nation: utils.StringToPtr("us")},
+		}
+
+		mockAPIRepository.On("GetNamesInfo", mock.Anything, []string{"Helen", "Anna"}, "").Return(
+			map[string]*external.ExternalResponse{
+				"Helen": info(40, "GB"),
+				"Anna":  info(30, "SE"),
+			},
+			nil,
+		).Once()
+
+		mockAPIRepository.On("GetNamesInfo", mock.Anything, []string{"Helen"}, "US").Return(
+			map[string]*external.ExternalResponse{
+				"Helen": info(50, "GB"),
+			},
+			nil,
+		).Once()
+
+		mockPersonRepository.On("CreateMany", mock.Anything, persons, domain.Audit{}).Return(nil).Once()
+
+		res, err := usecase.NewPersons(context.Background(), persons, domain.Audit{})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+		assert.Equal(t, 40, *persons[0].Age)
+		assert.Equal(t, "GB", *persons[0].Nation)
+		assert.Equal(t, 30, *persons[1].Age)
+		assert.Equal(t, "SE", *persons[1].Nation)
+		assert.Equal(t, 50, *persons[2].Age)
+		assert.Equal(t, "US", *persons[2].Nation)
+
+		mockAPIRepository.AssertExpectations(t)
+	})
+
+	t.Run("error_bulk_size", func(t *testing.T) {
+		for _, persons := range [][]domain.Person{nil, make([]domain.Person, maxBulkSize+1)} {
+			res, err := usecase.NewPersons(context.Background(), persons, domain.Audit{})
+			if assert.Error(t, err) {
+				assert.Equal(t, invalidBulkSizeErr, errors.Cause(err).Error())
+			}
+
+			assert.Nil(t, res)
+		}
+	})
+
+	t.Run("error_empty_name_or_surname", func(t *testing.T) {
+		res, err := usecase.NewPersons(context.Background(), []domain.Person{{Name: "Helen"}}, domain.Audit{})
+		if assert.Error(t, err) {
+			assert.Equal(t, emptyNameOrSurnameErr, errors.Cause(err).Error())
+		}
+
+		assert.Nil(t, res)
+	})
+
+	t.Run("error_external_api", func(t *testing.T) {
+		mockAPIRepository.On("GetNamesInfo", mock.Anything, []string{"Helen"}, "").Return(
+			nil,
+			errors.New(http.StatusText(http.StatusInternalServerError)),
+		).Once()
+
+		res, err := usecase.NewPersons(context.Background(), []domain.Person{{Name: "Helen", Surname: "Johnson"}}, domain.Audit{})
+		if assert.Error(t, err) {
+			assert.Equal(t, http.StatusText(http.StatusInternalServerError), errors.Cause(err).Error())
+		}
+
+		assert.Nil(t, res)
+	})
+
+	t.Run("error_external_bad_request", func(t *testing.T) {
+		mockAPIRepository.On("GetNamesInfo", mock.Anything, []string{"Helen"}, "").Return(
+			map[string]*external.ExternalResponse{
+				"Helen": {Error: utils.StringToPtr("Request limit reached")},
+			},
+			nil,
+		).Once()
+
+		res, err := usecase.NewPersons(context.Background(), []domain.Person{{Name: "Helen", Surname: "Johnson"}}, domain.Audit{})
+		var ce customErrors.Error
+		if assert.ErrorAs(t, err, &ce) {
+			assert.Equal(t, http.StatusServiceUnavailable, ce.StatusCode)
+			assert.Equal(t, "Request limit reached", errors.Cause(err).Error())
+		}
+
+		assert.Nil(t, res)
+	})
+
+	t.Run("error_provider_unavailable", func(t *testing.T) {
+		mockAPIRepository.On("GetNamesInfo", mock.Anything, []string{"Helen"}, "").Return(
+			nil,
+			errors.Wrap(external.ErrProviderUnavailable, "do #2"),
+		).Once()
+
+		res, err := usecase.NewPersons(context.Background(), []domain.Person{{Name: "Helen", Surname: "Johnson"}}, domain.Audit{})
+		var ce customErrors.Error
+		if assert.ErrorAs(t, err, &ce) {
+			assert.Equal(t, http.StatusServiceUnavailable, ce.StatusCode)
+			assert.Equal(t, external.ErrProviderUnavailable, errors.Cause(err))
+		}
+
+		assert.Nil(t, res)
+	})
+
+	t.Run("error_postgres_create", func(t *testing.T) {
+		mockAPIRepository.On("GetNamesInfo", mock.Anything, []string{"Helen"}, "").Return(
+			map[string]*external.ExternalResponse{
+				"Helen": info(40, "GB"),
+			},
+			nil,
+		).Once()
 
-		mockPersonRepository.On("Create", &person).Return(
+		mockPersonRepository.On("CreateMany", mock.Anything, mock.Anything, domain.Audit{}).Return(
 			errors.New("pg_error"),
 		).Once()
 
-		res, err := usecase.NewPerson(&person)
+		res, err := usecase.NewPersons(context.Background(), []domain.Person{{Name: "Helen", Surname: "Johnson"}}, domain.Audit{})
+		if assert.Error(t, err) {
+			assert.Equal(t, "pg_error", errors.Cause(err).Error())
+		}
+
+		assert.Nil(t, res)
+	})
+}
+
+func TestNewPersonDeferEnrichment(t *testing.T) {
+	mockAPIRepository := new(mocks.APIRepository)
+	mockPersonRepository := new(mocks.PersonRepository)
+
+	usecase := newUsecase(mockAPIRepository, mockPersonRepository)
+	usecase.deferEnrichment = true
+	// the names of a bulk request are looked up in one batch per country hint
+	usecase.nationHint = true
+
+	pending := mock.MatchedBy(func(p *domain.Person) bool {
+		return p.EnrichmentStatus == domain.EnrichmentPending && p.Age == nil
+	})
+
+	t.Run("success_provider_unavailable", func(t *testing.T) {
+		mockAPIRepository.On("GetNameInfo", mock.Anything, "Helen", "").Return(
+			nil,
+			errors.Wrap(external.ErrProviderUnavailable, "do #2"),
+		).Once()
+
+		mockPersonRepository.On("Create", mock.Anything, pending, domain.Audit{}).Return(nil).Once()
+
+		res, err := usecase.NewPerson(context.Background(), &domain.Person{Name: "Helen", Surname: "Johnson"}, domain.Audit{})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusAccepted, res.StatusCode)
+	})
+
+	t.Run("success_rate_limited", func(t *testing.T) {
+		mockAPIRepository.On("GetNameInfo", mock.Anything, "Helen", "").Return(
+			&external.ExternalResponse{
+				Error:      utils.StringToPtr("Request limit reached"),
+				StatusCode: http.StatusTooManyRequests,
+			},
+			nil,
+		).Once()
+
+		mockPersonRepository.On("Create", mock.Anything, pending, domain.Audit{}).Return(nil).Once()
+
+		res, err := usecase.NewPerson(context.Background(), &domain.Person{Name: "Helen", Surname: "Johnson"}, domain.Audit{})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusAccepted, res.StatusCode)
+	})
+
+	t.Run("error_name_rejected", func(t *testing.T) {
+		mockAPIRepository.On("GetNameInfo", mock.Anything, "Helen", "").Return(
+			&external.ExternalResponse{
+				Error:      utils.StringToPtr("Invalid 'name' parameter"),
+				StatusCode: http.StatusUnprocessableEntity,
+			},
+			nil,
+		).Once()
+
+		res, err := usecase.NewPerson(context.Background(), &domain.Person{Name: "Helen", Surname: "Johnson"}, domain.Audit{})
+		assert.Nil(t, res)
+
+		var ce customErrors.Error
+		if assert.ErrorAs(t, err, &ce) {
+			assert.Equal(t, http.StatusServiceUnavailable, ce.StatusCode)
+		}
+	})
+
+	t.Run("success_bulk", func(t *testing.T) {
+		persons := []domain.Person{
+			{Name: "Helen", Surname: "Johnson"},
+			{Name: "Anna", Surname: "Smith", Nation: utils.StringToPtr("SE")},
+		}
+
+		mockAPIRepository.On("GetNamesInfo", mock.Anything, []string{"Helen"}, "").Return(
+			map[string]*external.ExternalResponse{
+				"Helen": {
+					Agify:       &external.AgifyResponse{Age: utils.IntToPtr(40)},
+					Genderize:   &external.GenderizeResponse{Gender: utils.StringToPtr("female")},
+					Nationalize: &external.NationalizeResponse{},
+				},
+			},
+			nil,
+		).Once()
+
+		mockAPIRepository.On("GetNamesInfo", mock.Anything, []string{"Anna"}, "SE").Return(
+			nil,
+			errors.Wrap(external.ErrProviderUnavailable, "do #2"),
+		).Once()
+
+		mockPersonRepository.On("CreateMany", mock.Anything, mock.Anything, domain.Audit{}).Return(nil).Once()
+
+		_, err := usecase.NewPersons(context.Background(), persons, domain.Audit{})
+		require.NoError(t, err)
+
+		assert.Equal(t, domain.EnrichmentDone, persons[0].EnrichmentStatus)
+		assert.Equal(t, domain.EnrichmentPending, persons[1].EnrichmentStatus)
+		assert.Equal(t, "SE", *persons[1].Nation)
+	})
+
+	mockAPIRepository.AssertExpectations(t)
+	mockPersonRepository.AssertExpectations(t)
+}
+
+func TestNewPersonAsyncEnrichment(t *testing.T) {
+	mockAPIRepository := new(mocks.APIRepository)
+	mockPersonRepository := new(mocks.PersonRepository)
+
+	usecase := newUsecase(mockAPIRepository, mockPersonRepository)
+	usecase.asyncEnrichment = true
+
+	pending := mock.MatchedBy(func(p *domain.Person) bool {
+		return p.EnrichmentStatus == domain.EnrichmentPending
+	})
+
+	t.Run("success", func(t *testing.T) {
+		mockPersonRepository.On("Create", mock.Anything, pending, domain.Audit{}).Return(nil).Once()
+
+		res, err := usecase.NewPerson(context.Background(), &domain.Person{Name: "Helen", Surname: "Johnson"}, domain.Audit{})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusAccepted, res.StatusCode)
+	})
+
+	t.Run("success_bulk", func(t *testing.T) {
+		persons := []domain.Person{
+			{Name: "Helen", Surname: "Johnson"},
+			{Name: "Anna", Surname: "Smith"},
+		}
+
+		mockPersonRepository.On("CreateMany", mock.Anything, mock.Anything, domain.Audit{}).Return(nil).Once()
+
+		res, err := usecase.NewPersons(context.Background(), persons, domain.Audit{})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusAccepted, res.StatusCode)
+
+		for _, p := range persons {
+			assert.Equal(t, domain.EnrichmentPending, p.EnrichmentStatus)
+		}
+	})
+
+	// no lookups are made while the request is served
+	mockAPIRepository.AssertNotCalled(t, "GetNameInfo", mock.Anything, mock.Anything, mock.Anything)
+	mockAPIRepository.AssertNotCalled(t, "GetNamesInfo", mock.Anything, mock.Anything, mock.Anything)
+	mockPersonRepository.AssertExpectations(t)
+}
+
+// TestNewPersonDictionary enriches through the offline dictionary instead of a mock.
+func TestNewPersonDictionary(t *testing.T) {
+	dictionary, err := personAPI.LoadDictionary("")
+	require.NoError(t, err)
+
+	registry, err := personAPI.NewRegistry(time.Second, dictionary)
+	require.NoError(t, err)
+
+	mockPersonRepository := new(mocks.PersonRepository)
+
+	usecase := newUsecase(registry, mockPersonRepository)
+
+	t.Run("success", func(t *testing.T) {
+		person := domain.Person{Name: "Helen", Surname: "Johnson"}
+
+		mockPersonRepository.On("Create", mock.Anything, &person, domain.Audit{}).Return(nil).Once()
+
+		_, err := usecase.NewPerson(context.Background(), &person, domain.Audit{})
+		require.NoError(t, err)
+
+		assert.Equal(t, 60, *person.Age)
+		assert.Equal(t, "female", *person.Gender)
+		assert.Equal(t, "GB", *person.Nation)
+		assert.Len(t, person.Nationalities, 3)
+	})
+
+	t.Run("success_unknown", func(t *testing.T) {
+		person := domain.Person{Name: "Zyxw", Surname: "Johnson"}
+
+		mockPersonRepository.On("Create", mock.Anything, &person, domain.Audit{}).Return(nil).Once()
+
+		_, err := usecase.NewPerson(context.Background(), &person, domain.Audit{})
+		require.NoError(t, err)
+
+		assert.Nil(t, person.Age)
+		assert.Nil(t, person.Gender)
+		assert.Nil(t, person.Nation)
+	})
+
+	mockPersonRepository.AssertExpectations(t)
+}
+
+func TestProcessJobs(t *testing.T) {
+	mockAPIRepository := new(mocks.APIRepository)
+	mockPersonRepository := new(mocks.PersonRepository)
+
+	usecase := newUsecase(mockAPIRepository, mockPersonRepository)
+
+	helen := &external.ExternalResponse{
+		Agify:       &external.AgifyResponse{Age: utils.IntToPtr(40)},
+		Genderize:   &external.GenderizeResponse{Gender: utils.StringToPtr("female")},
+		Nationalize: &external.NationalizeResponse{},
+	}
+
+	audit := domain.Audit{Actor: enrichmentActor}
+
+	job := func(id int64, attempts int, name string) domain.EnrichmentJob {
+		return domain.EnrichmentJob{
+			ID:       id,
+			PersonID: int(id),
+			Attempts: attempts,
+			Person:   &domain.Person{ID: int(id), Name: name},
+		}
+	}
+
+	t.Run("success", func(t *testing.T) {
+		mockPersonRepository.On("ClaimJobs", mock.Anything, 10, jobLease).Return(
+			[]domain.EnrichmentJob{
+				job(1, 1, "Helen"),
+				job(2, 1, "Anna"),
+				job(3, 1, "Mark"),
+				job(4, DefaultMaxJobAttempts, "Anna"),
+			},
+			nil,
+		).Once()
+
+		mockAPIRepository.On("GetNamesInfo", mock.Anything, []string{"Helen", "Anna", "Mark", "Anna"}, "").Return(
+			map[string]*external.ExternalResponse{
+				"Helen": helen,
+				"Anna": {
+					Error:      utils.StringToPtr("Request limit reached"),
+					StatusCode: http.StatusTooManyRequests,
+				},
+				"Mark": {
+					Error:      utils.StringToPtr("Invalid 'name' parameter"),
+					StatusCode: http.StatusUnprocessableEntity,
+				},
+			},
+			nil,
+		).Once()
+
+		mockPersonRepository.On("CompleteJob", mock.Anything, int64(1), 1, mock.MatchedBy(func(p *domain.Person) bool {
+			return *p.Age == 40 && p.EnrichmentStatus == domain.EnrichmentDone
+		}), audit).Return(nil).Once()
+
+		mockPersonRepository.On("RetryJob", mock.Anything, int64(2), 1, jobRetryBaseDelay, "Request limit reached").Return(nil).Once()
+
+		mockPersonRepository.On("KillJob", mock.Anything, int64(3), 1, 3, "Invalid 'name' parameter", audit).Return(nil).Once()
+
+		mockPersonRepository.On("KillJob", mock.Anything, int64(4), DefaultMaxJobAttempts, 4, "Request limit reached", audit).Return(nil).Once()
+
+		claimed, err := usecase.ProcessJobs(context.Background(), 10)
+		require.NoError(t, err)
+		assert.Equal(t, 4, claimed)
+	})
+
+	t.Run("success_nation_hint", func(t *testing.T) {
+		hinted := newUsecase(mockAPIRepository, mockPersonRepository)
+		hinted.nationHint = true
+
+		hintedJob := job(9, 1, "Helen")
+		hintedJob.Person.Nation, hintedJob.Person.Version = utils.StringToPtr(" gb "), 4
+
+		mockPersonRepository.On("ClaimJobs", mock.Anything, 10, jobLease).Return([]domain.EnrichmentJob{hintedJob}, nil).Once()
+
+		mockAPIRepository.On("GetNamesInfo", mock.Anything, []string{"Helen"}, "GB").Return(
+			map[string]*external.ExternalResponse{
+				"Helen": {
+					Agify:     &external.AgifyResponse{},
+					Genderize: &external.GenderizeResponse{},
+					Nationalize: &external.NationalizeResponse{
+						Country: []external.CountryProbability{
+							{CountryId: "US", Probability: 0.3},
+							{CountryId: "GB", Probability: 0.2},
+						},
+					},
+				},
+			},
+			nil,
+		).Once()
+
+		// the job resolves the nation as a person enriched right away, for the claimed version
+		mockPersonRepository.On("CompleteJob", mock.Anything, int64(9), 1, mock.MatchedBy(func(p *domain.Person) bool {
+			return *p.Nation == "GB" && *p.NationProbability == 0.2 && p.Version == 4
+		}), audit).Return(nil).Once()
+
+		claimed, err := hinted.ProcessJobs(context.Background(), 10)
+		require.NoError(t, err)
+		assert.Equal(t, 1, claimed)
+	})
+
+	t.Run("success_providers_unavailable", func(t *testing.T) {
+		mockPersonRepository.On("ClaimJobs", mock.Anything, 10, jobLease).Return(
+			[]domain.EnrichmentJob{job(5, 2, "Helen")},
+			nil,
+		).Once()
+
+		mockAPIRepository.On("GetNamesInfo", mock.Anything, []string{"Helen"}, "").Return(
+			nil,
+			errors.Wrap(external.ErrProviderUnavailable, "do #2"),
+		).Once()
+
+		mockPersonRepository.On("RetryJob", mock.Anything, int64(5), 2, jobRetryBaseDelay*2, external.ErrProviderUnavailable.Error()).Return(nil).Once()
+
+		claimed, err := usecase.ProcessJobs(context.Background(), 10)
+		require.NoError(t, err)
+		assert.Equal(t, 1, claimed)
+	})
+
+	t.Run("success_lookup_error_redacted", func(t *testing.T) {
+		mockPersonRepository.On("ClaimJobs", mock.Anything, 10, jobLease).Return(
+			[]domain.EnrichmentJob{job(8, 1, "Helen")},
+			nil,
+		).Once()
+
+		mockAPIRepository.On("GetNamesInfo", mock.Anything, []string{"Helen"}, "").Return(
+			nil,
+			errors.Wrap(errors.New(`Get "https://api.agify.io/?apikey=secret&name%5B%5D=Helen": EOF`), "do #4"),
+		).Once()
+
+		// the job keeps no request details, they carry the API key
+		mockPersonRepository.On("RetryJob", mock.Anything, int64(8), 1, jobRetryBaseDelay, lookupFailedErr).Return(nil).Once()
+
+		claimed, err := usecase.ProcessJobs(context.Background(), 10)
+		require.NoError(t, err)
+		assert.Equal(t, 1, claimed)
+	})
+
+	t.Run("success_lease_lost", func(t *testing.T) {
+		mockPersonRepository.On("ClaimJobs", mock.Anything, 10, jobLease).Return(
+			[]domain.EnrichmentJob{job(6, 1, "Helen"), job(7, 1, "Helen")},
+			nil,
+		).Once()
+
+		mockAPIRepository.On("GetNamesInfo", mock.Anything, []string{"Helen", "Helen"}, "").Return(
+			map[string]*external.ExternalResponse{"Helen": helen},
+			nil,
+		).Once()
+
+		// the first job was claimed again by another worker, the second one still completes
+		mockPersonRepository.On("CompleteJob", mock.Anything, int64(6), 1, mock.Anything, audit).Return(errors.Wrap(domain.ErrLeaseLost, "closeJob #3")).Once()
+		mockPersonRepository.On("CompleteJob", mock.Anything, int64(7), 1, mock.Anything, audit).Return(nil).Once()
+
+		claimed, err := usecase.ProcessJobs(context.Background(), 10)
+		require.NoError(t, err)
+		assert.Equal(t, 2, claimed)
+	})
+
+	t.Run("success_empty_queue", func(t *testing.T) {
+		mockPersonRepository.On("ClaimJobs", mock.Anything, 10, jobLease).Return([]domain.EnrichmentJob{}, nil).Once()
+
+		claimed, err := usecase.ProcessJobs(context.Background(), 10)
+		require.NoError(t, err)
+		assert.Equal(t, 0, claimed)
+	})
+
+	t.Run("error_postgres", func(t *testing.T) {
+		mockPersonRepository.On("ClaimJobs", mock.Anything, 10, jobLease).Return(nil, errors.New("pg_error")).Once()
+
+		_, err := usecase.ProcessJobs(context.Background(), 10)
 		if assert.Error(t, err) {
 			assert.Equal(t, "pg_error", errors.Cause(err).Error())
 		}
+	})
+
+	mockAPIRepository.AssertExpectations(t)
+	mockPersonRepository.AssertExpectations(t)
+}
+
+func TestGetJobs(t *testing.T) {
+	mockAPIRepository := new(mocks.APIRepository)
+	mockPersonRepository := new(mocks.PersonRepository)
+
+	usecase := newUsecase(mockAPIRepository, mockPersonRepository)
+
+	t.Run("success_dead_by_default", func(t *testing.T) {
+		mockPersonRepository.On("GetJobs", mock.Anything, domain.JobDead, 20).Return(
+			[]domain.EnrichmentJob{{ID: 1, Status: domain.JobDead}},
+			nil,
+		).Once()
+
+		res, err := usecase.GetJobs(context.Background(), "", 20)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+	})
+
+	t.Run("error_status", func(t *testing.T) {
+		res, err := usecase.GetJobs(context.Background(), "lost", 20)
+		assert.Nil(t, res)
+
+		if assert.Error(t, err) {
+			assert.Equal(t, invalidJobStatusErr, errors.Cause(err).Error())
+		}
+	})
+
+	t.Run("error_limit", func(t *testing.T) {
+		res, err := usecase.GetJobs(context.Background(), domain.JobDead, maxJobsLimit+1)
+		assert.Nil(t, res)
+
+		if assert.Error(t, err) {
+			assert.Equal(t, invalidLimitErr, errors.Cause(err).Error())
+		}
+	})
+}
+
+func TestRequeueJob(t *testing.T) {
+	mockAPIRepository := new(mocks.APIRepository)
+	mockPersonRepository := new(mocks.PersonRepository)
+
+	usecase := newUsecase(mockAPIRepository, mockPersonRepository)
+
+	t.Run("success", func(t *testing.T) {
+		mockPersonRepository.On("RequeueJob", mock.Anything, int64(1), domain.Audit{}).Return(
+			&domain.EnrichmentJob{ID: 1, Status: domain.JobQueued},
+			nil,
+		).Once()
+
+		res, err := usecase.RequeueJob(context.Background(), 1, domain.Audit{})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+	})
+
+	t.Run("error_not_found", func(t *testing.T) {
+		mockPersonRepository.On("RequeueJob", mock.Anything, int64(2), domain.Audit{}).Return(
+			nil,
+			errors.Wrap(sql.ErrNoRows, "RequeueJob #1"),
+		).Once()
+
+		res, err := usecase.RequeueJob(context.Background(), 2, domain.Audit{})
+		assert.Nil(t, res)
+
+		var ce customErrors.Error
+		if assert.ErrorAs(t, err, &ce) {
+			assert.Equal(t, http.StatusNotFound, ce.StatusCode)
+			assert.Equal(t, deadJobNotFoundErr, ce.Message)
+		}
+	})
+}
+
+func TestReenrich(t *testing.T) {
+	mockAPIRepository := new(mocks.APIRepository)
+	mockPersonRepository := new(mocks.PersonRepository)
+
+	// the cached repository is never asked
+	usecase := newUsecase(new(mocks.APIRepository), mockPersonRepository)
+	usecase.reenrichRepository = mockAPIRepository
+
+	stored := func() *domain.Person {
+		return &domain.Person{
+			ID:      1,
+			Name:    "Helen",
+			Surname: "Johnson",
+			Age:     utils.IntToPtr(38),
+			Gender:  utils.StringToPtr("female"),
+			Nation:  utils.StringToPtr("GB"),
+			Version: 3,
+		}
+	}
+
+	info := &external.ExternalResponse{
+		Agify:     &external.AgifyResponse{Age: utils.IntToPtr(40)},
+		Genderize: &external.GenderizeResponse{},
+		Nationalize: &external.NationalizeResponse{
+			Country: []external.CountryProbability{
+				{CountryId: "GB", Probability: 0.2},
+			},
+		},
+	}
+
+	t.Run("success_dry_run", func(t *testing.T) {
+		mockPersonRepository.On("GetByID", mock.Anything, 1).Return(stored(), nil).Once()
+		mockAPIRepository.On("GetNameInfo", mock.Anything, "Helen", "").Return(info, nil).Once()
+
+		res, err := usecase.Reenrich(context.Background(), 1, nil, true, domain.Audit{})
+		require.NoError(t, err)
+
+		reenrichment := res.Data.(*domain.Reenrichment)
+
+		assert.False(t, reenrichment.Applied)
+		assert.Equal(t, map[string]domain.Change{
+			"age":                {Old: utils.IntToPtr(38), New: utils.IntToPtr(40)},
+			"nation_probability": {Old: (*float64)(nil), New: utils.Float64ToPtr(0.2)},
+			"nationalities": {
+				Old: []domain.Nationality(nil),
+				New: []domain.Nationality{{CountryID: "GB", Probability: 0.2, Rank: 1}},
+			},
+		}, reenrichment.Changes)
+		assert.Equal(t, "female", *reenrichment.Person.Gender)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		mockPersonRepository.On("GetByID", mock.Anything, 1).Return(stored(), nil).Once()
+		mockAPIRepository.On("GetNameInfo", mock.Anything, "Helen", "").Return(info, nil).Once()
+		mockPersonRepository.On("Reenrich", mock.Anything, mock.MatchedBy(func(p *domain.Person) bool {
+			return *p.Age == 40
+		}), 3, domain.Audit{}).Return(nil).Once()
+
+		res, err := usecase.Reenrich(context.Background(), 1, utils.IntToPtr(3), false, domain.Audit{})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.True(t, res.Data.(*domain.Reenrichment).Applied)
+	})
+
+	t.Run("success_nation_hint", func(t *testing.T) {
+		hinted := newUsecase(new(mocks.APIRepository), mockPersonRepository)
+		hinted.reenrichRepository, hinted.nationHint = mockAPIRepository, true
+
+		mockPersonRepository.On("GetByID", mock.Anything, 1).Return(stored(), nil).Once()
+		mockAPIRepository.On("GetNameInfo", mock.Anything, "Helen", "GB").Return(&external.ExternalResponse{
+			Agify:     &external.AgifyResponse{},
+			Genderize: &external.GenderizeResponse{},
+			Nationalize: &external.NationalizeResponse{
+				Count: utils.IntToPtr(10),
+				Country: []external.CountryProbability{
+					{CountryId: "US", Probability: 0.3},
+					{CountryId: "GB", Probability: 0.2},
+				},
+			},
+		}, nil).Once()
+
+		res, err := hinted.Reenrich(context.Background(), 1, nil, true, domain.Audit{})
+		require.NoError(t, err)
+
+		// the nation sent by the client stays, it gets its own probability
+		person := res.Data.(*domain.Reenrichment).Person
+
+		assert.Equal(t, "GB", *person.Nation)
+		assert.Equal(t, 0.2, *person.NationProbability)
+		assert.Equal(t, 10, *person.NationCount)
+	})
+
+	t.Run("error_version_mismatch", func(t *testing.T) {
+		mockPersonRepository.On("GetByID", mock.Anything, 1).Return(stored(), nil).Once()
+
+		res, err := usecase.Reenrich(context.Background(), 1, utils.IntToPtr(2), false, domain.Audit{})
+		assert.Nil(t, res)
+
+		var ce customErrors.Error
+		if assert.ErrorAs(t, err, &ce) {
+			assert.Equal(t, http.StatusPreconditionFailed, ce.StatusCode)
+		}
+	})
+
+	t.Run("error_not_found", func(t *testing.T) {
+		mockPersonRepository.On("GetByID", mock.Anything, 2).Return(nil, errors.Wrap(sql.ErrNoRows, "GetByID #1")).Once()
 
+		res, err := usecase.Reenrich(context.Background(), 2, nil, false, domain.Audit{})
 		assert.Nil(t, res)
+
+		var ce customErrors.Error
+		if assert.ErrorAs(t, err, &ce) {
+			assert.Equal(t, http.StatusNotFound, ce.StatusCode)
+			assert.Equal(t, personNotFoundErr, ce.Message)
+		}
 	})
+
+	mockAPIRepository.AssertExpectations(t)
+	mockPersonRepository.AssertExpectations(t)
+}
+
+func TestReenrichAll(t *testing.T) {
+	mockAPIRepository := new(mocks.APIRepository)
+	mockPersonRepository := new(mocks.PersonRepository)
+
+	usecase := newUsecase(new(mocks.APIRepository), mockPersonRepository)
+	usecase.reenrichRepository = mockAPIRepository
+
+	t.Run("success", func(t *testing.T) {
+		mockPersonRepository.On("GetWithFilterAndPagination", mock.Anything, mock.MatchedBy(func(q *query.Query) bool {
+			cutoff, ok := q.Args[1].(time.Time)
+
+			return q.Args[0] == int64(0) && ok && cutoff.Location() == time.UTC &&
+				strings.Contains(q.Where, "enriched_at is null or")
+		})).Return(
+			[]domain.Person{
+				{ID: 1, Name: "Helen", Version: 1},
+				{ID: 2, Name: "Mark", Age: utils.IntToPtr(50), Version: 1},
+				{ID: 3, Name: "Anna", Version: 1},
+			},
+			nil,
+		).Once()
+
+		mockAPIRepository.On("GetNamesInfo", mock.Anything, []string{"Helen", "Mark", "Anna"}, "").Return(
+			map[string]*external.ExternalResponse{
+				"Helen": {
+					Agify:       &external.AgifyResponse{Age: utils.IntToPtr(40)},
+					Genderize:   &external.GenderizeResponse{},
+					Nationalize: &external.NationalizeResponse{},
+				},
+				"Mark": {
+					Agify:       &external.AgifyResponse{Age: utils.IntToPtr(50)},
+					Genderize:   &external.GenderizeResponse{},
+					Nationalize: &external.NationalizeResponse{},
+				},
+				"Anna": {
+					Error:      utils.StringToPtr("Request limit reached"),
+					StatusCode: http.StatusTooManyRequests,
+				},
+			},
+			nil,
+		).Once()
+
+		var (
+			ids    []int
+			failed []int
+		)
+
+		matched, err := usecase.ReenrichAll(context.Background(), nil, time.Hour*24*30, true, domain.Audit{}, func(p *domain.Person, res *domain.Reenrichment, err error) {
+			ids = append(ids, p.ID)
+
+			if err != nil {
+				failed = append(failed, p.ID)
+
+				return
+			}
+
+			assert.False(t, res.Applied)
+
+			if p.ID == 1 {
+				assert.Contains(t, res.Changes, "age")
+			} else {
+				assert.Empty(t, res.Changes)
+			}
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, 3, matched)
+		assert.Equal(t, []int{1, 2, 3}, ids)
+		assert.Equal(t, []int{3}, failed)
+	})
+
+	t.Run("error_filter", func(t *testing.T) {
+		where := &domain.FilterGroup{
+			Operator: "and",
+			Filter:   []domain.Filter{{Field: "unknown", Value: "x"}},
+		}
+
+		_, err := usecase.ReenrichAll(context.Background(), where, 0, true, domain.Audit{}, func(*domain.Person, *domain.Reenrichment, error) {})
+		assert.Error(t, err)
+	})
+
+	mockAPIRepository.AssertExpectations(t)
+	mockPersonRepository.AssertExpectations(t)
 }
 
 func TestGetByID(t *testing.T) {
 	mockAPIRepository := new(mocks.APIRepository)
 	mockPersonRepository := new(mocks.PersonRepository)
 
-	usecase := newUsecase(mockAPIRepository, mockPersonRepository)
+	usecase := newUsecase(mockAPIRepository, mockPersonRepository)
+
+	t.Run("success", func(t *testing.T) {
+		mockPersonRepository.On("GetByID", mock.Anything, 1).Return(
+			&domain.Person{},
+			nil,
+		).Once()
+
+		res, err := usecase.GetByID(context.Background(), 1, false)
+		assert.NoError(t, err)
+		assert.NotNil(t, res)
+	})
+
+	t.Run("error_not_found", func(t *testing.T) {
+		mockPersonRepository.On("GetByID", mock.Anything, 1).Return(
+			nil,
+			sql.ErrNoRows,
+		).Once()
+
+		res, err := usecase.GetByID(context.Background(), 1, false)
+		if assert.Error(t, err) {
+			assert.Equal(t, sql.ErrNoRows.Error(), errors.Cause(err).Error())
+		}
+
+		assert.Nil(t, res)
+	})
 
-	t.Run("success", func(t *testing.T) {
-		mockPersonRepository.On("GetByID", 1).Return(
-			&domain.Person{},
+	t.Run("success_include_deleted", func(t *testing.T) {
+		mockPersonRepository.On("GetByID", mock.Anything, 1).Return(
+			&domain.Person{DeletedAt: &time.Time{}},
 			nil,
 		).Once()
 
-		res, err := usecase.GetByID(1)
+		res, err := usecase.GetByID(context.Background(), 1, true)
 		assert.NoError(t, err)
 		assert.NotNil(t, res)
 	})
 
-	t.Run("error_not_found", func(t *testing.T) {
-		mockPersonRepository.On("GetByID", 1).Return(
+	t.Run("error_deleted", func(t *testing.T) {
+		mockPersonRepository.On("GetByID", mock.Anything, 1).Return(
+			&domain.Person{DeletedAt: &time.Time{}},
 			nil,
-			sql.ErrNoRows,
 		).Once()
 
-		res, err := usecase.GetByID(1)
+		res, err := usecase.GetByID(context.Background(), 1, false)
 		if assert.Error(t, err) {
-			assert.Equal(t, sql.ErrNoRows.Error(), errors.Cause(err).Error())
+			assert.Equal(t, sql.ErrNoRows, errors.Cause(err))
 		}
 
 		assert.Nil(t, res)
 	})
 
 	t.Run("error_postgres_create", func(t *testing.T) {
-		mockPersonRepository.On("GetByID", 1).Return(
+		mockPersonRepository.On("GetByID", mock.Anything, 1).Return(
 			nil,
 			errors.New("pg_error"),
 		).Once()
 
-		res, err := usecase.GetByID(1)
+		res, err := usecase.GetByID(context.Background(), 1, false)
 		if assert.Error(t, err) {
 			assert.Equal(t, "pg_error", errors.Cause(err).Error())
 		}
@@ -186,13 +1072,74 @@ func TestGetWithFilterAndPagination(t *testing.T) {
 
 	t.Run("success", func(t *testing.T) {
 		mockPersonRepository.On("GetWithFilterAndPagination", mock.Anything, mock.Anything).Return(
-			[]byte("test"),
+			[]domain.Person{{ID: 1, Name: "Helen", Surname: "Johnson"}},
 			nil,
 		).Once()
 
-		res, err := usecase.GetWithFilterAndPagination(&req)
+		mockPersonRepository.On("Count", mock.Anything, mock.Anything).Return(11, nil).Once()
+
+		res, err := usecase.GetWithFilterAndPagination(context.Background(), &req)
 		assert.NoError(t, err)
-		assert.NotNil(t, res)
+
+		if assert.NotNil(t, res) {
+			assert.JSONEq(
+				t,
+				`{"data":[{"id":1,"name":"Helen","surname":"Johnson","patronymic":null,"age":null,"gender":null,"nation":null,"age_count":null,"gender_probability":null,"gender_count":null,"nation_probability":null,"nation_count":null,"nationalities":null,"created_at":"0001-01-01T00:00:00Z","updated_at":null,"version":0,"enrichment_status":"","enriched_at":null}],"meta":{"all_row_count":11,"count_mode":"exact","mode":"page","page":1,"limit":5,"total_pages":3,"has_next":false,"has_prev":false}}`,
+				string(res.Data.([]byte)),
+			)
+		}
+	})
+
+	t.Run("success_deleted", func(t *testing.T) {
+		for includeDeleted, where := range map[bool]string{
+			false: "where pt.deleted_at is null",
+			true:  "",
+		} {
+			mockPersonRepository.On("GetWithFilterAndPagination", mock.Anything, mock.MatchedBy(func(q *query.Query) bool {
+				return q.Where == where
+			})).Return([]domain.Person{}, nil).Once()
+
+			res, err := usecase.GetWithFilterAndPagination(context.Background(), &domain.FilterWithPagination{
+				Pagination:     &domain.Pagination{Limit: 5, Page: 1, Count: query.CountNone},
+				IncludeDeleted: includeDeleted,
+			})
+			assert.NoError(t, err)
+			assert.NotNil(t, res)
+		}
+	})
+
+	t.Run("success_cursor", func(t *testing.T) {
+		mockReq := domain.FilterWithPagination{
+			Pagination: &domain.Pagination{
+				Limit: 1,
+				Mode:  query.ModeCursor,
+				Count: query.CountNone,
+			},
+		}
+
+		mockPersonRepository.On("GetWithFilterAndPagination", mock.Anything, mock.Anything).Return(
+			[]domain.Person{{ID: 2}, {ID: 1}},
+			nil,
+		).Once()
+
+		res, err := usecase.GetWithFilterAndPagination(context.Background(), &mockReq)
+		require.NoError(t, err)
+
+		var list domain.PersonList
+
+		require.NoError(t, json.Unmarshal(res.Data.([]byte), &list))
+
+		if assert.Len(t, list.Data, 1) {
+			assert.Equal(t, 2, list.Data[0].ID)
+		}
+
+		assert.NotNil(t, list.Meta.NextCursor)
+		assert.Nil(t, list.Meta.PrevCursor)
+		assert.True(t, list.Meta.HasNext)
+		assert.False(t, list.Meta.HasPrev)
+		assert.Nil(t, list.Meta.Page)
+		assert.Nil(t, list.Meta.AllRowCount)
+		assert.Nil(t, list.Meta.TotalPages)
 	})
 
 	t.Run("error_bad_request", func(t *testing.T) {
@@ -205,9 +1152,14 @@ func TestGetWithFilterAndPagination(t *testing.T) {
 			},
 		}
 
-		res, err := usecase.GetWithFilterAndPagination(&mockReq)
-		assert.Error(t, err)
+		res, err := usecase.GetWithFilterAndPagination(context.Background(), &mockReq)
 		assert.Nil(t, res)
+
+		var ce customErrors.Error
+		if assert.ErrorAs(t, err, &ce) {
+			assert.Equal(t, http.StatusBadRequest, ce.StatusCode)
+			assert.Equal(t, &query.Error{Field: "test test", Reason: "unknown field"}, ce.Details)
+		}
 	})
 
 	t.Run("error_postgres_get", func(t *testing.T) {
@@ -216,13 +1168,143 @@ func TestGetWithFilterAndPagination(t *testing.T) {
 			errors.New("pg_error"),
 		).Once()
 
-		res, err := usecase.GetWithFilterAndPagination(&req)
+		res, err := usecase.GetWithFilterAndPagination(context.Background(), &req)
+		if assert.Error(t, err) {
+			assert.Equal(t, "pg_error", errors.Cause(err).Error())
+		}
+
+		assert.Nil(t, res)
+	})
+
+	t.Run("error_postgres_count", func(t *testing.T) {
+		mockPersonRepository.On("GetWithFilterAndPagination", mock.Anything, mock.Anything).Return(
+			[]domain.Person{},
+			nil,
+		).Once()
+
+		mockPersonRepository.On("Count", mock.Anything, mock.Anything).Return(
+			0,
+			errors.New("pg_error"),
+		).Once()
+
+		res, err := usecase.GetWithFilterAndPagination(context.Background(), &req)
+		if assert.Error(t, err) {
+			assert.Equal(t, "pg_error", errors.Cause(err).Error())
+		}
+
+		assert.Nil(t, res)
+	})
+}
+
+func TestGetHistory(t *testing.T) {
+	mockAPIRepository := new(mocks.APIRepository)
+	mockPersonRepository := new(mocks.PersonRepository)
+
+	usecase := newUsecase(mockAPIRepository, mockPersonRepository)
+
+	t.Run("success", func(t *testing.T) {
+		mockPersonRepository.On("GetHistory", mock.Anything, mock.MatchedBy(func(q *query.Query) bool {
+			return q.Where == "where ph.person_id = $1" && q.OrderBy == "order by ph.id desc"
+		})).Return([]domain.PersonHistory{
+			{ID: 2, PersonID: 1, Operation: "update"},
+			{ID: 1, PersonID: 1, Operation: "create"},
+		}, nil).Once()
+
+		mockPersonRepository.On("CountHistory", mock.Anything, mock.Anything).Return(2, nil).Once()
+
+		res, err := usecase.GetHistory(context.Background(), 1, true, &domain.FilterWithPagination{
+			Pagination: &domain.Pagination{Limit: 5, Page: 1},
+		})
+		require.NoError(t, err)
+
+		var list domain.PersonHistoryList
+
+		require.NoError(t, json.Unmarshal(res.Data.([]byte), &list))
+
+		if assert.Len(t, list.Data, 2) {
+			assert.Equal(t, "update", list.Data[0].Operation)
+		}
+
+		if assert.NotNil(t, list.Meta.AllRowCount) {
+			assert.Equal(t, 2, *list.Meta.AllRowCount)
+		}
+	})
+
+	t.Run("success_live_person", func(t *testing.T) {
+		mockPersonRepository.On("GetByID", mock.Anything, 1).Return(&domain.Person{ID: 1}, nil).Once()
+		mockPersonRepository.On("GetHistory", mock.Anything, mock.Anything).Return([]domain.PersonHistory{}, nil).Once()
+		mockPersonRepository.On("CountHistory", mock.Anything, mock.Anything).Return(0, nil).Once()
+
+		_, err := usecase.GetHistory(context.Background(), 1, false, &domain.FilterWithPagination{
+			Pagination: &domain.Pagination{Limit: 5, Page: 1},
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("success_estimate_counts_exactly", func(t *testing.T) {
+		mockPersonRepository.On("GetHistory", mock.Anything, mock.Anything).Return([]domain.PersonHistory{}, nil).Once()
+		mockPersonRepository.On("CountHistory", mock.Anything, mock.Anything).Return(0, nil).Once()
+
+		res, err := usecase.GetHistory(context.Background(), 1, true, &domain.FilterWithPagination{
+			Pagination: &domain.Pagination{Limit: 5, Page: 1, Count: query.CountEstimate},
+		})
+		require.NoError(t, err)
+
+		var list domain.PersonHistoryList
+
+		require.NoError(t, json.Unmarshal(res.Data.([]byte), &list))
+
+		assert.Equal(t, query.CountExact, list.Meta.CountMode)
+	})
+
+	t.Run("error_deleted_person", func(t *testing.T) {
+		mockPersonRepository.On("GetByID", mock.Anything, 2).Return(&domain.Person{ID: 2, DeletedAt: &time.Time{}}, nil).Once()
+
+		res, err := usecase.GetHistory(context.Background(), 2, false, &domain.FilterWithPagination{})
+		assert.Nil(t, res)
+
+		var ce customErrors.Error
+		if assert.ErrorAs(t, err, &ce) {
+			assert.Equal(t, http.StatusNotFound, ce.StatusCode)
+		}
+	})
+
+	t.Run("error_purged_person", func(t *testing.T) {
+		mockPersonRepository.On("GetByID", mock.Anything, 3).Return(nil, errors.Wrap(sql.ErrNoRows, "GetByID #1")).Once()
+
+		res, err := usecase.GetHistory(context.Background(), 3, false, &domain.FilterWithPagination{})
+		assert.Nil(t, res)
+
+		var ce customErrors.Error
+		if assert.ErrorAs(t, err, &ce) {
+			assert.Equal(t, http.StatusNotFound, ce.StatusCode)
+		}
+	})
+
+	t.Run("error_bad_request", func(t *testing.T) {
+		res, err := usecase.GetHistory(context.Background(), 1, true, &domain.FilterWithPagination{
+			Pagination: &domain.Pagination{Limit: 0},
+		})
+		assert.Nil(t, res)
+
+		var ce customErrors.Error
+		if assert.ErrorAs(t, err, &ce) {
+			assert.Equal(t, http.StatusBadRequest, ce.StatusCode)
+		}
+	})
+
+	t.Run("error_postgres_history", func(t *testing.T) {
+		mockPersonRepository.On("GetHistory", mock.Anything, mock.Anything).Return(nil, errors.New("pg_error")).Once()
+
+		res, err := usecase.GetHistory(context.Background(), 1, true, &domain.FilterWithPagination{})
 		if assert.Error(t, err) {
 			assert.Equal(t, "pg_error", errors.Cause(err).Error())
 		}
 
 		assert.Nil(t, res)
 	})
+
+	mockPersonRepository.AssertExpectations(t)
 }
 
 func TestUpdate(t *testing.T) {
@@ -238,21 +1320,21 @@ func TestUpdate(t *testing.T) {
 	}
 
 	t.Run("success", func(t *testing.T) {
-		mockPersonRepository.On("Update", &person).Return(
+		mockPersonRepository.On("Update", mock.Anything, &person, (*int)(nil), domain.Audit{}).Return(
 			nil,
 		).Once()
 
-		res, err := usecase.Update(&person)
+		res, err := usecase.Update(context.Background(), &person, nil, domain.Audit{})
 		assert.NoError(t, err)
 		assert.NotNil(t, res)
 	})
 
 	t.Run("error_not_found", func(t *testing.T) {
-		mockPersonRepository.On("Update", &person).Return(
+		mockPersonRepository.On("Update", mock.Anything, &person, (*int)(nil), domain.Audit{}).Return(
 			sql.ErrNoRows,
 		).Once()
 
-		res, err := usecase.Update(&person)
+		res, err := usecase.Update(context.Background(), &person, nil, domain.Audit{})
 		if assert.Error(t, err) {
 			assert.Equal(t, sql.ErrNoRows, errors.Cause(err))
 		}
@@ -260,18 +1342,221 @@ func TestUpdate(t *testing.T) {
 		assert.Nil(t, res)
 	})
 
+	t.Run("error_version_mismatch", func(t *testing.T) {
+		mockPersonRepository.On("Update", mock.Anything, &person, utils.IntToPtr(2), domain.Audit{}).Return(
+			domain.ErrVersionMismatch,
+		).Once()
+
+		res, err := usecase.Update(context.Background(), &person, utils.IntToPtr(2), domain.Audit{})
+		assert.Nil(t, res)
+
+		var ce customErrors.Error
+		if assert.ErrorAs(t, err, &ce) {
+			assert.Equal(t, http.StatusPreconditionFailed, ce.StatusCode)
+		}
+	})
+
 	t.Run("error_postgres_update", func(t *testing.T) {
-		mockPersonRepository.On("Update", &person).Return(
+		mockPersonRepository.On("Update", mock.Anything, &person, (*int)(nil), domain.Audit{}).Return(
 			errors.New("pg_error"),
 		).Once()
 
-		res, err := usecase.Update(&person)
+		res, err := usecase.Update(context.Background(), &person, nil, domain.Audit{})
+		if assert.Error(t, err) {
+			assert.Equal(t, "pg_error", errors.Cause(err).Error())
+		}
+
+		assert.Nil(t, res)
+	})
+}
+
+func TestPatch(t *testing.T) {
+	mockAPIRepository := new(mocks.APIRepository)
+	mockPersonRepository := new(mocks.PersonRepository)
+
+	usecase := newUsecase(mockAPIRepository, mockPersonRepository)
+
+	t.Run("success", func(t *testing.T) {
+		patch := domain.PersonPatch{
+			ID:      1,
+			Surname: domain.NewField(" Smith "),
+			Age:     domain.NullField[int](),
+		}
+
+		mockPersonRepository.On("Patch", mock.Anything, &domain.PersonPatch{
+			ID:      1,
+			Surname: domain.NewField("Smith"),
+			Age:     domain.NullField[int](),
+		}, (*int)(nil), domain.Audit{}).Return(&domain.Person{ID: 1, Name: "Helen", Surname: "Smith"}, nil).Once()
+
+		res, err := usecase.Patch(context.Background(), &patch, nil, domain.Audit{})
+		assert.NoError(t, err)
+
+		if assert.NotNil(t, res) {
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+		}
+	})
+
+	t.Run("success_empty", func(t *testing.T) {
+		mockPersonRepository.On("GetByID", mock.Anything, 1).Return(&domain.Person{ID: 1}, nil).Once()
+
+		res, err := usecase.Patch(context.Background(), &domain.PersonPatch{ID: 1}, nil, domain.Audit{})
+		assert.NoError(t, err)
+		assert.NotNil(t, res)
+	})
+
+	t.Run("error_deleted", func(t *testing.T) {
+		mockPersonRepository.On("GetByID", mock.Anything, 1).Return(&domain.Person{ID: 1, DeletedAt: &time.Time{}}, nil).Once()
+
+		res, err := usecase.Patch(context.Background(), &domain.PersonPatch{ID: 1}, nil, domain.Audit{})
+		assert.Nil(t, res)
+
+		var ce customErrors.Error
+		if assert.ErrorAs(t, err, &ce) {
+			assert.Equal(t, http.StatusNotFound, ce.StatusCode)
+		}
+	})
+
+	t.Run("error_validation", func(t *testing.T) {
+		for _, patch := range []domain.PersonPatch{
+			{Name: domain.NullField[string]()},
+			{Surname: domain.NewField(" ")},
+			{Gender: domain.NewField("other")},
+			{Age: domain.NewField(-1)},
+		} {
+			res, err := usecase.Patch(context.Background(), &patch, nil, domain.Audit{})
+			assert.Nil(t, res)
+
+			var ce customErrors.Error
+			if assert.ErrorAs(t, err, &ce) {
+				assert.Equal(t, http.StatusBadRequest, ce.StatusCode)
+			}
+		}
+	})
+
+	t.Run("error_not_found", func(t *testing.T) {
+		patch := domain.PersonPatch{ID: 1, Nation: domain.NewField("GB")}
+
+		mockPersonRepository.On("Patch", mock.Anything, &patch, (*int)(nil), domain.Audit{}).Return(nil, sql.ErrNoRows).Once()
+
+		res, err := usecase.Patch(context.Background(), &patch, nil, domain.Audit{})
+		assert.Nil(t, res)
+
+		var ce customErrors.Error
+		if assert.ErrorAs(t, err, &ce) {
+			assert.Equal(t, http.StatusNotFound, ce.StatusCode)
+		}
+	})
+
+	t.Run("error_postgres_patch", func(t *testing.T) {
+		patch := domain.PersonPatch{ID: 1, Nation: domain.NewField("GB")}
+
+		mockPersonRepository.On("Patch", mock.Anything, &patch, (*int)(nil), domain.Audit{}).Return(nil, errors.New("pg_error")).Once()
+
+		res, err := usecase.Patch(context.Background(), &patch, nil, domain.Audit{})
 		if assert.Error(t, err) {
 			assert.Equal(t, "pg_error", errors.Cause(err).Error())
 		}
 
 		assert.Nil(t, res)
 	})
+
+	mockPersonRepository.AssertExpectations(t)
+}
+
+func TestJSONPatch(t *testing.T) {
+	mockAPIRepository := new(mocks.APIRepository)
+	mockPersonRepository := new(mocks.PersonRepository)
+
+	usecase := newUsecase(mockAPIRepository, mockPersonRepository)
+
+	current := domain.Person{
+		ID:      1,
+		Name:    "Helen",
+		Surname: "Johnson",
+		Age:     utils.IntToPtr(30),
+		Gender:  utils.StringToPtr("female"),
+		Version: 3,
+	}
+
+	t.Run("success", func(t *testing.T) {
+		mockPersonRepository.On("GetByID", mock.Anything, 1).Return(&current, nil).Once()
+
+		mockPersonRepository.On("Patch", mock.Anything, &domain.PersonPatch{
+			ID:         1,
+			Patronymic: domain.NewField("Johnson"),
+			Age:        domain.NullField[int](),
+		}, utils.IntToPtr(3), domain.Audit{}).Return(&domain.Person{ID: 1}, nil).Once()
+
+		res, err := usecase.JSONPatch(context.Background(), 1, []domain.PatchOperation{
+			{Op: "test", Path: "/gender", Value: json.RawMessage(`"female"`)},
+			{Op: "copy", From: "/surname", Path: "/patronymic"},
+			{Op: "remove", Path: "/age"},
+			{Op: "replace", Path: "/name", Value: json.RawMessage(`"Helen"`)},
+		}, utils.IntToPtr(3), domain.Audit{})
+		assert.NoError(t, err)
+		assert.NotNil(t, res)
+	})
+
+	t.Run("error_version_mismatch", func(t *testing.T) {
+		mockPersonRepository.On("GetByID", mock.Anything, 1).Return(&current, nil).Once()
+
+		res, err := usecase.JSONPatch(context.Background(), 1, []domain.PatchOperation{
+			{Op: "remove", Path: "/age"},
+		}, utils.IntToPtr(2), domain.Audit{})
+		assert.Nil(t, res)
+
+		var ce customErrors.Error
+		if assert.ErrorAs(t, err, &ce) {
+			assert.Equal(t, http.StatusPreconditionFailed, ce.StatusCode)
+		}
+	})
+
+	t.Run("error_test_failed", func(t *testing.T) {
+		mockPersonRepository.On("GetByID", mock.Anything, 1).Return(&current, nil).Once()
+
+		res, err := usecase.JSONPatch(context.Background(), 1, []domain.PatchOperation{
+			{Op: "test", Path: "/age", Value: json.RawMessage(`31`)},
+			{Op: "replace", Path: "/age", Value: json.RawMessage(`32`)},
+		}, nil, domain.Audit{})
+		assert.Nil(t, res)
+
+		var ce customErrors.Error
+		if assert.ErrorAs(t, err, &ce) {
+			assert.Equal(t, http.StatusConflict, ce.StatusCode)
+		}
+	})
+
+	t.Run("error_unprocessable", func(t *testing.T) {
+		for _, ops := range [][]domain.PatchOperation{
+			{{Op: "replace", Path: "/id", Value: json.RawMessage(`2`)}},
+			{{Op: "replace", Path: "/age", Value: json.RawMessage(`"old"`)}},
+		} {
+			mockPersonRepository.On("GetByID", mock.Anything, 1).Return(&current, nil).Once()
+
+			res, err := usecase.JSONPatch(context.Background(), 1, ops, nil, domain.Audit{})
+			assert.Nil(t, res)
+
+			var ce customErrors.Error
+			if assert.ErrorAs(t, err, &ce) {
+				assert.Equal(t, http.StatusUnprocessableEntity, ce.StatusCode)
+			}
+		}
+	})
+
+	t.Run("error_not_found", func(t *testing.T) {
+		mockPersonRepository.On("GetByID", mock.Anything, 1).Return(nil, sql.ErrNoRows).Once()
+
+		res, err := usecase.JSONPatch(context.Background(), 1, nil, nil, domain.Audit{})
+		assert.Nil(t, res)
+
+		var ce customErrors.Error
+		if assert.ErrorAs(t, err, &ce) {
+			assert.Equal(t, http.StatusNotFound, ce.StatusCode)
+		}
+	})
+
+	mockPersonRepository.AssertExpectations(t)
 }
 
 func TestDelete(t *testing.T) {
@@ -281,23 +1566,23 @@ func TestDelete(t *testing.T) {
 	usecase := newUsecase(mockAPIRepository, mockPersonRepository)
 
 	t.Run("success", func(t *testing.T) {
-		mockPersonRepository.On("Delete", 1).Return(
+		mockPersonRepository.On("Delete", mock.Anything, 1, (*int)(nil), domain.Audit{}).Return(
 			utils.Int64ToPtr(1),
 			nil,
 		).Once()
 
-		res, err := usecase.Delete(1)
+		res, err := usecase.Delete(context.Background(), 1, nil, domain.Audit{})
 		assert.NoError(t, err)
 		assert.NotNil(t, res)
 	})
 
 	t.Run("error_postgres_delete", func(t *testing.T) {
-		mockPersonRepository.On("Delete", 1).Return(
+		mockPersonRepository.On("Delete", mock.Anything, 1, (*int)(nil), domain.Audit{}).Return(
 			nil,
 			errors.New("pg_error"),
 		).Once()
 
-		res, err := usecase.Delete(1)
+		res, err := usecase.Delete(context.Background(), 1, nil, domain.Audit{})
 		if assert.Error(t, err) {
 			assert.Equal(t, "pg_error", errors.Cause(err).Error())
 		}
@@ -306,12 +1591,12 @@ func TestDelete(t *testing.T) {
 	})
 
 	t.Run("error_not_found", func(t *testing.T) {
-		mockPersonRepository.On("Delete", 1).Return(
+		mockPersonRepository.On("Delete", mock.Anything, 1, (*int)(nil), domain.Audit{}).Return(
 			utils.Int64ToPtr(0),
 			nil,
 		).Once()
 
-		res, err := usecase.Delete(1)
+		res, err := usecase.Delete(context.Background(), 1, nil, domain.Audit{})
 		if assert.Error(t, err) {
 			assert.Equal(t, personNotFoundErr, errors.Cause(err).Error())
 		}
@@ -319,3 +1604,88 @@ func TestDelete(t *testing.T) {
 		assert.Nil(t, res)
 	})
 }
+
+func TestRestore(t *testing.T) {
+	mockAPIRepository := new(mocks.APIRepository)
+	mockPersonRepository := new(mocks.PersonRepository)
+
+	usecase := newUsecase(mockAPIRepository, mockPersonRepository)
+
+	t.Run("success", func(t *testing.T) {
+		mockPersonRepository.On("Restore", mock.Anything, 1, (*int)(nil), domain.Audit{}).Return(&domain.Person{ID: 1}, nil).Once()
+
+		res, err := usecase.Restore(context.Background(), 1, nil, domain.Audit{})
+		assert.NoError(t, err)
+
+		if assert.NotNil(t, res) {
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+		}
+	})
+
+	t.Run("error_not_found", func(t *testing.T) {
+		mockPersonRepository.On("Restore", mock.Anything, 1, (*int)(nil), domain.Audit{}).Return(nil, sql.ErrNoRows).Once()
+
+		res, err := usecase.Restore(context.Background(), 1, nil, domain.Audit{})
+		assert.Nil(t, res)
+
+		var ce customErrors.Error
+		if assert.ErrorAs(t, err, &ce) {
+			assert.Equal(t, http.StatusNotFound, ce.StatusCode)
+		}
+	})
+
+	t.Run("error_version_mismatch", func(t *testing.T) {
+		mockPersonRepository.On("Restore", mock.Anything, 1, utils.IntToPtr(2), domain.Audit{}).Return(nil, domain.ErrVersionMismatch).Once()
+
+		res, err := usecase.Restore(context.Background(), 1, utils.IntToPtr(2), domain.Audit{})
+		assert.Nil(t, res)
+
+		var ce customErrors.Error
+		if assert.ErrorAs(t, err, &ce) {
+			assert.Equal(t, http.StatusPreconditionFailed, ce.StatusCode)
+		}
+	})
+
+	mockPersonRepository.AssertExpectations(t)
+}
+
+func TestPurge(t *testing.T) {
+	mockAPIRepository := new(mocks.APIRepository)
+	mockPersonRepository := new(mocks.PersonRepository)
+
+	usecase := newUsecase(mockAPIRepository, mockPersonRepository)
+
+	t.Run("success", func(t *testing.T) {
+		mockPersonRepository.On("Purge", mock.Anything, time.Hour, domain.Audit{}).Return(&domain.PurgeResult{Purged: 3}, nil).Once()
+
+		res, err := usecase.Purge(context.Background(), time.Hour, domain.Audit{})
+		assert.NoError(t, err)
+
+		if assert.NotNil(t, res) {
+			assert.Equal(t, int64(3), res.Data.(*domain.PurgeResult).Purged)
+		}
+	})
+
+	t.Run("error_invalid_retention", func(t *testing.T) {
+		res, err := usecase.Purge(context.Background(), 0, domain.Audit{})
+		assert.Nil(t, res)
+
+		var ce customErrors.Error
+		if assert.ErrorAs(t, err, &ce) {
+			assert.Equal(t, http.StatusBadRequest, ce.StatusCode)
+		}
+	})
+
+	t.Run("error_postgres_purge", func(t *testing.T) {
+		mockPersonRepository.On("Purge", mock.Anything, time.Hour, domain.Audit{}).Return(nil, errors.New("pg_error")).Once()
+
+		res, err := usecase.Purge(context.Background(), time.Hour, domain.Audit{})
+		if assert.Error(t, err) {
+			assert.Equal(t, "pg_error", errors.Cause(err).Error())
+		}
+
+		assert.Nil(t, res)
+	})
+
+	mockPersonRepository.AssertExpectations(t)
+}
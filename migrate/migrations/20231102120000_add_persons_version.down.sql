@@ -0,0 +1,6 @@
+drop trigger if exists persons_version_trigger on persons.persons_table;
+
+drop function if exists increment_version();
+
+alter table persons.persons_table
+    drop column if exists version;
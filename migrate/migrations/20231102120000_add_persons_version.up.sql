@@ -0,0 +1,18 @@
+alter table persons.persons_table
+    add column version integer default 1 not null;
+
+create or replace function increment_version() returns trigger
+    language plpgsql
+as
+$$
+begin
+    new.version = old.version + 1;
+    return new;
+end;
+$$;
+
+create trigger persons_version_trigger
+    before update
+    on persons.persons_table
+    for each row
+execute function increment_version();
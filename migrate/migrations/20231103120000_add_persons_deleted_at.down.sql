@@ -0,0 +1,6 @@
+delete
+from persons.persons_table
+where deleted_at is not null;
+
+alter table persons.persons_table
+    drop column if exists deleted_at;
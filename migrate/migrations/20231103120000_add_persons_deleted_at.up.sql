@@ -0,0 +1,4 @@
+alter table persons.persons_table
+    add column deleted_at timestamp;
+
+create index on persons.persons_table (deleted_at) where deleted_at is not null;
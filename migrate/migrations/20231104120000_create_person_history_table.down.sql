@@ -0,0 +1,7 @@
+drop trigger if exists persons_history_trigger on persons.persons_table;
+
+drop function if exists record_person_history();
+
+drop table if exists persons.person_history;
+
+drop function if exists forbid_person_history_change();
@@ -0,0 +1,6 @@
+create table if not exists persons.enrichment_cache
+(
+    key        varchar   not null primary key,
+    response   jsonb     not null,
+    expires_at timestamp not null
+);
@@ -0,0 +1,2 @@
+alter table persons.persons_table
+    drop column if exists enrichment_status;
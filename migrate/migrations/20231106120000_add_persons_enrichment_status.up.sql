@@ -0,0 +1,5 @@
+alter table persons.persons_table
+    add column enrichment_status varchar(16) default 'complete' not null
+        check (enrichment_status in ('complete', 'pending'));
+
+create index on persons.persons_table (id) where enrichment_status = 'pending' and deleted_at is null;
@@ -0,0 +1,17 @@
+drop table if exists persons.enrichment_jobs;
+
+alter table persons.persons_table
+    drop constraint if exists persons_table_enrichment_status_check;
+
+update persons.persons_table
+set enrichment_status = 'complete'
+where enrichment_status = 'done';
+
+update persons.persons_table
+set enrichment_status = 'pending'
+where enrichment_status = 'failed';
+
+alter table persons.persons_table
+    alter column enrichment_status set default 'complete',
+    add constraint persons_table_enrichment_status_check
+        check (enrichment_status in ('complete', 'pending'));
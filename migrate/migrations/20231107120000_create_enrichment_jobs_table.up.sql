@@ -0,0 +1,37 @@
+alter table persons.persons_table
+    drop constraint if exists persons_table_enrichment_status_check;
+
+update persons.persons_table
+set enrichment_status = 'done'
+where enrichment_status = 'complete';
+
+alter table persons.persons_table
+    alter column enrichment_status set default 'done',
+    add constraint persons_table_enrichment_status_check
+        check (enrichment_status in ('pending', 'done', 'failed'));
+
+create table if not exists persons.enrichment_jobs
+(
+    id         bigserial primary key,
+    person_id  bigint                  not null references persons.persons_table (id) on delete cascade,
+    status     varchar(16)             not null default 'queued'
+        check (status in ('queued', 'running', 'done', 'dead')),
+    attempts   integer                 not null default 0,
+    run_at     timestamp default now() not null,
+    locked_at  timestamp,
+    last_error text,
+    created_at timestamp default now() not null,
+    updated_at timestamp default now() not null
+);
+
+create index on persons.enrichment_jobs (run_at, id) where status in ('queued', 'running');
+
+create unique index on persons.enrichment_jobs (person_id) where status in ('queued', 'running');
+
+create index on persons.enrichment_jobs (person_id);
+
+insert into persons.enrichment_jobs (person_id)
+select id
+from persons.persons_table
+where enrichment_status = 'pending'
+  and deleted_at is null;
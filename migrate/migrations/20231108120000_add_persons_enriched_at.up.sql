@@ -0,0 +1,14 @@
+alter table persons.persons_table
+    add column enriched_at timestamp;
+
+alter table persons.persons_table
+    disable trigger user;
+
+update persons.persons_table
+set enriched_at = created_at
+where enrichment_status = 'done';
+
+alter table persons.persons_table
+    enable trigger user;
+
+create index on persons.persons_table (enriched_at) where deleted_at is null;
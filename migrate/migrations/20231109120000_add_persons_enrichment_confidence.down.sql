@@ -0,0 +1,6 @@
+alter table persons.persons_table
+    drop column if exists age_count,
+    drop column if exists gender_probability,
+    drop column if exists gender_count,
+    drop column if exists nation_probability,
+    drop column if exists nation_count;
@@ -0,0 +1,6 @@
+alter table persons.persons_table
+    add column age_count          integer,
+    add column gender_probability double precision,
+    add column gender_count       integer,
+    add column nation_probability double precision,
+    add column nation_count       integer;
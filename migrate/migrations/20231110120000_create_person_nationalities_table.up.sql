@@ -0,0 +1,16 @@
+create table if not exists persons.person_nationalities
+(
+    person_id   bigint           not null references persons.persons_table (id) on delete cascade,
+    rank        smallint         not null,
+    country_id  varchar(100)     not null,
+    probability double precision not null,
+    primary key (person_id, rank)
+);
+
+create index on persons.person_nationalities (country_id, probability);
+
+insert into persons.person_nationalities (person_id, rank, country_id, probability)
+select id, 1, nation, nation_probability
+from persons.persons_table
+where nation is not null
+  and nation_probability is not null;
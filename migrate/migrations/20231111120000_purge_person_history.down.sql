@@ -0,0 +1,39 @@
+create or replace function forbid_person_history_change() returns trigger
+    language plpgsql
+as
+$$
+begin
+    raise exception 'person_history is append-only';
+end;
+$$;
+
+create or replace function record_person_history() returns trigger
+    language plpgsql
+as
+$$
+declare
+    operation varchar(16);
+begin
+    if tg_op = 'INSERT' then
+        operation = 'create';
+    elsif tg_op = 'DELETE' then
+        operation = 'purge';
+    elsif old.deleted_at is null and new.deleted_at is not null then
+        operation = 'delete';
+    elsif old.deleted_at is not null and new.deleted_at is null then
+        operation = 'restore';
+    else
+        operation = 'update';
+    end if;
+
+    insert into persons.person_history (person_id, operation, old_values, new_values, actor, request_id)
+    values (case when tg_op = 'DELETE' then old.id else new.id end,
+            operation,
+            case when tg_op <> 'INSERT' then to_jsonb(old) end,
+            case when tg_op <> 'DELETE' then to_jsonb(new) end,
+            nullif(current_setting('namer.actor', true), ''),
+            nullif(current_setting('namer.request_id', true), ''));
+
+    return null;
+end;
+$$;
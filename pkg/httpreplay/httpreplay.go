@@ -0,0 +1,280 @@
+package httpreplay
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// RecordEnv switches the transports made by NewTest from replaying to recording.
+const RecordEnv = "HTTPREPLAY_RECORD"
+
+// ErrUnmatched is returned for a request no recorded exchange is left for.
+var ErrUnmatched = errors.New("no recorded exchange matches the request")
+
+// Exchange is a request with the response it got. A JSON body is kept as JSON, so the
+// fixtures stay readable, and replayed without the indentation.
+type Exchange struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+type Request struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+}
+
+type Response struct {
+	StatusCode int             `json:"status_code"`
+	Header     http.Header     `json:"header,omitempty"`
+	Body       json.RawMessage `json:"body,omitempty"`
+	Text       string          `json:"text,omitempty"`
+}
+
+// skippedHeaders change from one response to the next or must not end up in a fixture.
+var skippedHeaders = []string{"Date", "Set-Cookie"}
+
+// Recorder sends the requests with next and keeps the exchanges. The redacted query
+// parameters, such as API keys, are left out of the recorded URLs.
+type Recorder struct {
+	next      http.RoundTripper
+	redact    []string
+	mu        sync.Mutex
+	exchanges []Exchange
+}
+
+func NewRecorder(next http.RoundTripper, redact ...string) *Recorder {
+	return &Recorder{
+		next:   next,
+		redact: redact,
+	}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response body: %w", err)
+	}
+
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	exchange := Exchange{
+		Request: Request{
+			Method: req.Method,
+			URL:    canonicalURL(req.URL, r.redact),
+		},
+		Response: Response{
+			StatusCode: res.StatusCode,
+			Header:     res.Header.Clone(),
+		},
+	}
+
+	for _, header := range skippedHeaders {
+		exchange.Response.Header.Del(header)
+	}
+
+	if json.Valid(body) {
+		exchange.Response.Body = append(json.RawMessage(nil), body...)
+	} else {
+		exchange.Response.Text = string(body)
+	}
+
+	r.mu.Lock()
+	r.exchanges = append(r.exchanges, exchange)
+	r.mu.Unlock()
+
+	return res, nil
+}
+
+// Exchanges returns the exchanges recorded so far in the order the responses came in.
+func (r *Recorder) Exchanges() []Exchange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Exchange(nil), r.exchanges...)
+}
+
+// Save writes the exchanges recorded so far to the fixture at path.
+func (r *Recorder) Save(path string) error {
+	var data bytes.Buffer
+
+	encoder := json.NewEncoder(&data)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(r.Exchanges()); err != nil {
+		return fmt.Errorf("encode exchanges: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create fixture directory: %w", err)
+	}
+
+	return os.WriteFile(path, data.Bytes(), 0o644)
+}
+
+// Replayer answers the requests with the recorded responses and never sends them. Every
+// exchange is replayed once, the requests with the same method and URL get the responses in
+// the order they were recorded in.
+type Replayer struct {
+	redact    []string
+	mu        sync.Mutex
+	exchanges []Exchange
+	replayed  []bool
+	unmatched []string
+}
+
+func NewReplayer(exchanges []Exchange, redact ...string) *Replayer {
+	return &Replayer{
+		redact:    redact,
+		exchanges: exchanges,
+		replayed:  make([]bool, len(exchanges)),
+	}
+}
+
+// Load reads the exchanges from the fixture at path.
+func Load(path string) ([]Exchange, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read fixture: %w", err)
+	}
+
+	var exchanges []Exchange
+
+	if err = json.Unmarshal(data, &exchanges); err != nil {
+		return nil, fmt.Errorf("decode fixture %s: %w", path, err)
+	}
+
+	return exchanges, nil
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	method, u := req.Method, canonicalURL(req.URL, r.redact)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, exchange := range r.exchanges {
+		if r.replayed[i] || exchange.Request.Method != method || exchange.Request.URL != u {
+			continue
+		}
+
+		r.replayed[i] = true
+
+		body := []byte(exchange.Response.Text)
+
+		if exchange.Response.Body != nil {
+			var compact bytes.Buffer
+
+			if err := json.Compact(&compact, exchange.Response.Body); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", method, u, err)
+			}
+
+			body = compact.Bytes()
+		}
+
+		header := exchange.Response.Header.Clone()
+		if header == nil {
+			header = make(http.Header)
+		}
+
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", exchange.Response.StatusCode, http.StatusText(exchange.Response.StatusCode)),
+			StatusCode:    exchange.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+
+	r.unmatched = append(r.unmatched, method+" "+u)
+
+	return nil, fmt.Errorf("%s %s: %w", method, u, ErrUnmatched)
+}
+
+// Unmatched returns the requests no recorded exchange was left for.
+func (r *Replayer) Unmatched() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.unmatched...)
+}
+
+// NewTest replays the fixture at path and fails the test for every request it does not
+// match. With RecordEnv set it sends the requests for real instead and saves them to the
+// fixture once the test passed.
+func NewTest(tb testing.TB, path string, redact ...string) http.RoundTripper {
+	tb.Helper()
+
+	if os.Getenv(RecordEnv) != "" {
+		recorder := NewRecorder(http.DefaultTransport, redact...)
+
+		tb.Cleanup(func() {
+			if tb.Failed() {
+				return
+			}
+
+			if err := recorder.Save(path); err != nil {
+				tb.Errorf("save fixture: %v", err)
+			}
+		})
+
+		return recorder
+	}
+
+	exchanges, err := Load(path)
+	if err != nil {
+		tb.Fatalf("%v, record it with %s=1", err, RecordEnv)
+	}
+
+	replayer := NewReplayer(exchanges, redact...)
+
+	tb.Cleanup(func() {
+		for _, request := range replayer.Unmatched() {
+			tb.Errorf("request not in fixture %s: %s, record it again with %s=1", path, request, RecordEnv)
+		}
+	})
+
+	return replayer
+}
+
+// canonicalURL sorts the query parameters and leaves the redacted ones out.
+func canonicalURL(u *url.URL, redact []string) string {
+	c := *u
+	query := c.Query()
+
+	for _, param := range redact {
+		query.Del(param)
+	}
+
+	c.RawQuery, c.ForceQuery, c.Fragment = query.Encode(), false, ""
+
+	return c.String()
+}
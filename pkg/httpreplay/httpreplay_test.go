@@ -0,0 +1,127 @@
+package httpreplay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func get(t *testing.T, transport http.RoundTripper, url string) (*http.Response, string) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err.Error()
+	}
+
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	return res, string(body)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	var requests atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+
+		if r.URL.Path == "/text" {
+			fmt.Fprint(w, "plain")
+
+			return
+		}
+
+		w.Header().Set("X-Rate-Limit-Remaining", fmt.Sprint(100-n))
+		w.WriteHeader(http.StatusTeapot)
+		fmt.Fprintf(w, `{"n":%d}`, n)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "testdata", "fixture.json")
+
+	recorder := NewRecorder(http.DefaultTransport, "apikey")
+
+	res, body := get(t, recorder, server.URL+"/?name=b&name=a&apikey=secret")
+	assert.Equal(t, http.StatusTeapot, res.StatusCode)
+	assert.Equal(t, `{"n":1}`, body)
+
+	_, _ = get(t, recorder, server.URL+"/?apikey=other&name=b&name=a")
+	_, _ = get(t, recorder, server.URL+"/text")
+
+	require.NoError(t, recorder.Save(path))
+
+	exchanges, err := Load(path)
+	require.NoError(t, err)
+	require.Len(t, exchanges, 3)
+
+	assert.Equal(t, server.URL+"/?name=b&name=a", exchanges[0].Request.URL)
+	assert.Empty(t, exchanges[0].Response.Header.Get("Date"))
+	assert.Equal(t, "plain", exchanges[2].Response.Text)
+
+	t.Run("success", func(t *testing.T) {
+		replayer := NewReplayer(exchanges, "apikey")
+
+		// the same request gets the responses in the order they were recorded in
+		for i, want := range []string{`{"n":1}`, `{"n":2}`} {
+			res, body := get(t, replayer, server.URL+"/?name=b&name=a&apikey=changed")
+
+			assert.Equal(t, http.StatusTeapot, res.StatusCode)
+			assert.Equal(t, want, body)
+			assert.Equal(t, fmt.Sprint(99-i), res.Header.Get("X-Rate-Limit-Remaining"))
+		}
+
+		_, body := get(t, replayer, server.URL+"/text")
+		assert.Equal(t, "plain", body)
+
+		assert.Empty(t, replayer.Unmatched())
+		assert.Equal(t, int32(3), requests.Load())
+	})
+
+	t.Run("error_unmatched", func(t *testing.T) {
+		replayer := NewReplayer(exchanges, "apikey")
+
+		for _, url := range []string{server.URL + "/text", server.URL + "/text", server.URL + "/?name=a&name=b"} {
+			_, _ = get(t, replayer, url)
+		}
+
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/other", nil)
+		require.NoError(t, err)
+
+		_, err = replayer.RoundTrip(req)
+		assert.True(t, errors.Is(err, ErrUnmatched))
+
+		assert.Equal(t, []string{
+			"GET " + server.URL + "/text",
+			"GET " + server.URL + "/?name=a&name=b",
+			"GET " + server.URL + "/other",
+		}, replayer.Unmatched())
+	})
+
+	t.Run("error_canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/text", nil)
+		require.NoError(t, err)
+
+		_, err = NewReplayer(exchanges).RoundTrip(req)
+		assert.Equal(t, context.Canceled, err)
+	})
+
+	t.Run("error_load", func(t *testing.T) {
+		_, err := Load(filepath.Join(t.TempDir(), "missing.json"))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,125 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"namer/internal/domain"
+	"reflect"
+	"strings"
+)
+
+const (
+	OpAdd     = "add"
+	OpRemove  = "remove"
+	OpReplace = "replace"
+	OpMove    = "move"
+	OpCopy    = "copy"
+	OpTest    = "test"
+)
+
+// Error is returned for operations that cannot be applied to the document.
+type Error struct {
+	Index  int    `json:"index"`
+	Reason string `json:"reason"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("operation %d: %s", e.Index, e.Reason)
+}
+
+// TestError is returned when a "test" operation does not match the document.
+type TestError struct {
+	Index int    `json:"index"`
+	Path  string `json:"path"`
+}
+
+func (e *TestError) Error() string {
+	return fmt.Sprintf("operation %d: test failed for path %q", e.Index, e.Path)
+}
+
+// Apply applies RFC 6902 operations to a flat JSON object in place. Paths address
+// top level members only, members not listed in writable can be tested and copied
+// from but not modified.
+func Apply(doc map[string]any, ops []domain.PatchOperation, writable []string) error {
+	canWrite := make(map[string]bool, len(writable))
+	for _, w := range writable {
+		canWrite[w] = true
+	}
+
+	for i, op := range ops {
+		path, err := member(op.Path)
+		if err != nil {
+			return &Error{Index: i, Reason: err.Error()}
+		}
+
+		if op.Op != OpTest && !canWrite[path] {
+			return &Error{Index: i, Reason: fmt.Sprintf("path %q cannot be modified", op.Path)}
+		}
+
+		switch op.Op {
+		case OpAdd, OpReplace, OpTest:
+			var value any
+
+			if len(op.Value) == 0 {
+				return &Error{Index: i, Reason: "missing value"}
+			}
+
+			if err = json.Unmarshal(op.Value, &value); err != nil {
+				return &Error{Index: i, Reason: "invalid value"}
+			}
+
+			current, ok := doc[path]
+			if op.Op != OpAdd && !ok {
+				return &Error{Index: i, Reason: fmt.Sprintf("path %q does not exist", op.Path)}
+			}
+
+			if op.Op == OpTest {
+				if !reflect.DeepEqual(current, value) {
+					return &TestError{Index: i, Path: op.Path}
+				}
+
+				continue
+			}
+
+			doc[path] = value
+		case OpRemove:
+			if _, ok := doc[path]; !ok {
+				return &Error{Index: i, Reason: fmt.Sprintf("path %q does not exist", op.Path)}
+			}
+
+			delete(doc, path)
+		case OpMove, OpCopy:
+			from, err := member(op.From)
+			if err != nil {
+				return &Error{Index: i, Reason: err.Error()}
+			}
+
+			if op.Op == OpMove && !canWrite[from] {
+				return &Error{Index: i, Reason: fmt.Sprintf("path %q cannot be modified", op.From)}
+			}
+
+			value, ok := doc[from]
+			if !ok {
+				return &Error{Index: i, Reason: fmt.Sprintf("path %q does not exist", op.From)}
+			}
+
+			if op.Op == OpMove {
+				delete(doc, from)
+			}
+
+			doc[path] = value
+		default:
+			return &Error{Index: i, Reason: fmt.Sprintf("operation %q is not supported", op.Op)}
+		}
+	}
+
+	return nil
+}
+
+func member(pointer string) (string, error) {
+	if !strings.HasPrefix(pointer, "/") || strings.Count(pointer, "/") != 1 {
+		return "", fmt.Errorf("path %q is not a top level member", pointer)
+	}
+
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(pointer[1:]), nil
+}
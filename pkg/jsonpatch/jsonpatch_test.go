@@ -0,0 +1,136 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"namer/internal/domain"
+	"testing"
+)
+
+var writable = []string{"name", "surname", "patronymic", "age"}
+
+func newDocument() map[string]any {
+	return map[string]any{
+		"id":         float64(1),
+		"name":       "Helen",
+		"surname":    "Johnson",
+		"patronymic": nil,
+		"age":        float64(30),
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  []domain.PatchOperation
+		want map[string]any
+	}{
+		{
+			name: "replace",
+			ops: []domain.PatchOperation{
+				{Op: OpReplace, Path: "/surname", Value: json.RawMessage(`"Smith"`)},
+			},
+			want: map[string]any{"id": float64(1), "name": "Helen", "surname": "Smith", "patronymic": nil, "age": float64(30)},
+		},
+		{
+			name: "add_and_remove",
+			ops: []domain.PatchOperation{
+				{Op: OpAdd, Path: "/patronymic", Value: json.RawMessage(`"Ivanovna"`)},
+				{Op: OpRemove, Path: "/age"},
+			},
+			want: map[string]any{"id": float64(1), "name": "Helen", "surname": "Johnson", "patronymic": "Ivanovna"},
+		},
+		{
+			name: "test_then_copy",
+			ops: []domain.PatchOperation{
+				{Op: OpTest, Path: "/id", Value: json.RawMessage(`1`)},
+				{Op: OpCopy, From: "/name", Path: "/patronymic"},
+			},
+			want: map[string]any{"id": float64(1), "name": "Helen", "surname": "Johnson", "patronymic": "Helen", "age": float64(30)},
+		},
+		{
+			name: "move",
+			ops: []domain.PatchOperation{
+				{Op: OpMove, From: "/surname", Path: "/patronymic"},
+			},
+			want: map[string]any{"id": float64(1), "name": "Helen", "patronymic": "Johnson", "age": float64(30)},
+		},
+		{
+			name: "escaped_pointer",
+			ops: []domain.PatchOperation{
+				{Op: OpAdd, Path: "/a~1b~0c", Value: json.RawMessage(`1`)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := newDocument()
+
+			err := Apply(doc, tt.ops, append(writable, "a/b~c"))
+			assert.NoError(t, err)
+
+			if tt.want != nil {
+				assert.Equal(t, tt.want, doc)
+			}
+		})
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  []domain.PatchOperation
+		err  string
+	}{
+		{
+			name: "read_only",
+			ops:  []domain.PatchOperation{{Op: OpReplace, Path: "/id", Value: json.RawMessage(`2`)}},
+			err:  `operation 0: path "/id" cannot be modified`,
+		},
+		{
+			name: "nested_path",
+			ops:  []domain.PatchOperation{{Op: OpReplace, Path: "/name/0", Value: json.RawMessage(`"x"`)}},
+			err:  `operation 0: path "/name/0" is not a top level member`,
+		},
+		{
+			name: "missing_value",
+			ops:  []domain.PatchOperation{{Op: OpReplace, Path: "/name"}},
+			err:  "operation 0: missing value",
+		},
+		{
+			name: "replace_missing_member",
+			ops: []domain.PatchOperation{
+				{Op: OpRemove, Path: "/age"},
+				{Op: OpReplace, Path: "/age", Value: json.RawMessage(`1`)},
+			},
+			err: `operation 1: path "/age" does not exist`,
+		},
+		{
+			name: "unknown_op",
+			ops:  []domain.PatchOperation{{Op: "merge", Path: "/name"}},
+			err:  `operation 0: operation "merge" is not supported`,
+		},
+		{
+			name: "test_failed",
+			ops: []domain.PatchOperation{
+				{Op: OpReplace, Path: "/name", Value: json.RawMessage(`"Anna"`)},
+				{Op: OpTest, Path: "/age", Value: json.RawMessage(`31`)},
+			},
+			err: `operation 1: test failed for path "/age"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.EqualError(t, Apply(newDocument(), tt.ops, writable), tt.err)
+		})
+	}
+
+	t.Run("test_error_type", func(t *testing.T) {
+		err := Apply(newDocument(), []domain.PatchOperation{{Op: OpTest, Path: "/name", Value: json.RawMessage(`"Anna"`)}}, writable)
+
+		var testErr *TestError
+		assert.ErrorAs(t, err, &testErr)
+	})
+}
@@ -0,0 +1,88 @@
+package lru
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		c := New[string, int](2, time.Minute)
+
+		c.Add("a", 1)
+		c.Add("b", 2)
+
+		v, ok := c.Get("a")
+		assert.True(t, ok)
+		assert.Equal(t, 1, v)
+
+		c.Add("b", 3)
+
+		v, ok = c.Get("b")
+		assert.True(t, ok)
+		assert.Equal(t, 3, v)
+		assert.Equal(t, 2, c.Len())
+	})
+
+	t.Run("success_evicts_least_recently_used", func(t *testing.T) {
+		c := New[string, int](2, time.Minute)
+
+		c.Add("a", 1)
+		c.Add("b", 2)
+		c.Get("a")
+		c.Add("c", 3)
+
+		_, ok := c.Get("b")
+		assert.False(t, ok)
+
+		_, ok = c.Get("a")
+		assert.True(t, ok)
+
+		_, ok = c.Get("c")
+		assert.True(t, ok)
+	})
+
+	t.Run("success_expires", func(t *testing.T) {
+		now := time.Now()
+
+		c := New[string, int](2, time.Minute)
+		c.now = func() time.Time { return now }
+
+		c.Add("a", 1)
+
+		now = now.Add(time.Minute)
+
+		_, ok := c.Get("a")
+		assert.False(t, ok)
+		assert.Equal(t, 0, c.Len())
+	})
+
+	t.Run("success_expires_with_ttl", func(t *testing.T) {
+		now := time.Now()
+
+		c := New[string, int](2, time.Minute)
+		c.now = func() time.Time { return now }
+
+		c.AddWithTTL("a", 1, time.Second)
+		c.AddWithTTL("b", 2, 0)
+
+		_, ok := c.Get("b")
+		assert.False(t, ok)
+
+		now = now.Add(time.Second)
+
+		_, ok = c.Get("a")
+		assert.False(t, ok)
+		assert.Equal(t, 0, c.Len())
+	})
+
+	t.Run("success_disabled", func(t *testing.T) {
+		c := New[string, int](0, time.Minute)
+
+		c.Add("a", 1)
+
+		_, ok := c.Get("a")
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,234 @@
+package query
+
+import (
+	"fmt"
+	"math"
+	"namer/internal/domain"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	OpIlike   = "ilike"
+	OpEq      = "eq"
+	OpNe      = "ne"
+	OpGt      = "gt"
+	OpGte     = "gte"
+	OpLt      = "lt"
+	OpLte     = "lte"
+	OpIn      = "in"
+	OpBetween = "between"
+	OpIsNull  = "is_null"
+)
+
+const maxInValues = 100
+
+var comparisons = map[string]string{
+	OpEq:  "=",
+	OpNe:  "<>",
+	OpGt:  ">",
+	OpGte: ">=",
+	OpLt:  "<",
+	OpLte: "<=",
+}
+
+var operators = map[ColumnType][]string{
+	TypeText:      {OpIlike, OpEq, OpNe, OpIn, OpIsNull},
+	TypeEnum:      {OpIlike, OpEq, OpNe, OpIn, OpIsNull},
+	TypeInt:       {OpEq, OpNe, OpGt, OpGte, OpLt, OpLte, OpIn, OpBetween, OpIsNull},
+	TypeTimestamp: {OpEq, OpNe, OpGt, OpGte, OpLt, OpLte, OpIn, OpBetween, OpIsNull},
+	TypeFloat:     {OpEq, OpNe, OpGt, OpGte, OpLt, OpLte, OpBetween, OpIsNull},
+	TypeRelation:  {OpAny},
+}
+
+var timestampLayouts = []string{time.RFC3339Nano, time.DateTime, time.DateOnly}
+
+// compileFilter renders a filter of a group nested depth levels deep, a relation filter nests
+// its group one level deeper.
+func (b *Builder) compileFilter(q *Query, f *domain.Filter, depth int) (string, error) {
+	if f.Field == "" {
+		return "", &Error{Reason: "empty field"}
+	}
+
+	column, ok := b.columns[f.Field]
+	if !ok {
+		return "", &Error{Field: f.Field, Reason: "unknown field"}
+	}
+
+	op := f.Operator
+	if op == "" {
+		op = defaultOperator(column)
+	}
+
+	if !slices.Contains(operators[column.Type], op) {
+		return "", &Error{Field: f.Field, Reason: fmt.Sprintf("operator %q is not supported", op)}
+	}
+
+	expr := b.alias + "." + column.Name
+
+	switch op {
+	case OpAny:
+		return b.compileAny(q, f, column, depth)
+	case OpIlike:
+		s, ok := f.Value.(string)
+		if !ok || s == "" {
+			return "", &Error{Field: f.Field, Reason: "value must be a non-empty string"}
+		}
+
+		if column.Type != TypeText {
+			expr += "::text"
+		}
+
+		return fmt.Sprintf("%s ilike %s", expr, q.bind("%"+escapeLike(s)+"%")), nil
+	case OpIsNull:
+		isNull, ok := f.Value.(bool)
+		if f.Value == nil {
+			isNull, ok = true, true
+		}
+
+		if !ok {
+			return "", &Error{Field: f.Field, Reason: "value must be a boolean"}
+		}
+
+		if isNull {
+			return expr + " is null", nil
+		}
+
+		return expr + " is not null", nil
+	case OpIn:
+		values, ok := f.Value.([]any)
+		if !ok || len(values) == 0 || len(values) > maxInValues {
+			return "", &Error{
+				Field:  f.Field,
+				Reason: fmt.Sprintf("value must be an array of 1 to %d elements", maxInValues),
+			}
+		}
+
+		placeholders := make([]string, len(values))
+
+		for i := range values {
+			v, err := convertValue(column, f.Field, values[i])
+			if err != nil {
+				return "", err
+			}
+
+			placeholders[i] = q.bind(v)
+		}
+
+		return fmt.Sprintf("%s in (%s)", expr, strings.Join(placeholders, ", ")), nil
+	case OpBetween:
+		values, ok := f.Value.([]any)
+		if !ok || len(values) != 2 {
+			return "", &Error{Field: f.Field, Reason: "value must be an array of 2 elements"}
+		}
+
+		from, err := convertValue(column, f.Field, values[0])
+		if err != nil {
+			return "", err
+		}
+
+		to, err := convertValue(column, f.Field, values[1])
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("%s between %s and %s", expr, q.bind(from), q.bind(to)), nil
+	default:
+		v, err := convertValue(column, f.Field, f.Value)
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("%s %s %s", expr, comparisons[op], q.bind(v)), nil
+	}
+}
+
+// intRange returns the bounds of a TypeInt column, a bigint is kept to the integers a JSON
+// number holds exactly.
+func intRange(column Column) (float64, float64) {
+	switch column.Bits {
+	case 16:
+		return math.MinInt16, math.MaxInt16
+	case 64:
+		return -(1 << 53), 1 << 53
+	}
+
+	return math.MinInt32, math.MaxInt32
+}
+
+func defaultOperator(column Column) string {
+	switch column.Type {
+	case TypeText, TypeEnum:
+		return OpIlike
+	case TypeRelation:
+		return OpAny
+	}
+
+	return OpEq
+}
+
+// convertValue checks a JSON-decoded value against the column type and returns it as a driver argument.
+func convertValue(column Column, field string, value any) (any, error) {
+	switch column.Type {
+	case TypeInt:
+		// decoded JSON holds float64, filters built in code may hold int
+		if i, ok := value.(int); ok {
+			value = float64(i)
+		}
+
+		f, ok := value.(float64)
+		if !ok || f != math.Trunc(f) {
+			return nil, &Error{Field: field, Reason: "value must be an integer"}
+		}
+
+		if lo, hi := intRange(column); f < lo || f > hi {
+			return nil, &Error{Field: field, Reason: fmt.Sprintf("value must be between %.0f and %.0f", lo, hi)}
+		}
+
+		return int64(f), nil
+	case TypeFloat:
+		if i, ok := value.(int); ok {
+			value = float64(i)
+		}
+
+		f, ok := value.(float64)
+		if !ok || math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, &Error{Field: field, Reason: "value must be a number"}
+		}
+
+		return f, nil
+	case TypeTimestamp:
+		s, ok := value.(string)
+		if ok {
+			for _, layout := range timestampLayouts {
+				if t, err := time.Parse(layout, s); err == nil {
+					return t, nil
+				}
+			}
+		}
+
+		return nil, &Error{Field: field, Reason: "value must be an RFC 3339 timestamp or a date"}
+	case TypeEnum:
+		s, ok := value.(string)
+		if !ok || !slices.Contains(column.Values, s) {
+			return nil, &Error{
+				Field:  field,
+				Reason: fmt.Sprintf("value must be one of: %s", strings.Join(column.Values, ", ")),
+			}
+		}
+
+		return s, nil
+	default:
+		s, ok := value.(string)
+		if !ok {
+			return nil, &Error{Field: field, Reason: "value must be a string"}
+		}
+
+		return s, nil
+	}
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
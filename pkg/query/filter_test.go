@@ -0,0 +1,234 @@
+package query
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"namer/internal/domain"
+	"testing"
+	"time"
+)
+
+func TestCompileFilter(t *testing.T) {
+	b := NewBuilder("pt", "id", testColumns)
+
+	created := time.Date(2023, 10, 19, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		filter domain.Filter
+		sql    string
+		args   []any
+	}{
+		{
+			name:   "default_text",
+			filter: domain.Filter{Field: "name", Value: "iv"},
+			sql:    "pt.name ilike $1",
+			args:   []any{"%iv%"},
+		},
+		{
+			name:   "default_int",
+			filter: domain.Filter{Field: "age", Value: float64(30)},
+			sql:    "pt.age = $1",
+			args:   []any{int64(30)},
+		},
+		{
+			name:   "eq_int_from_code",
+			filter: domain.Filter{Field: "age", Operator: OpEq, Value: 30},
+			sql:    "pt.age = $1",
+			args:   []any{int64(30)},
+		},
+		{
+			name:   "eq_enum",
+			filter: domain.Filter{Field: "gender", Operator: OpEq, Value: "female"},
+			sql:    "pt.gender = $1",
+			args:   []any{"female"},
+		},
+		{
+			name:   "ne_text",
+			filter: domain.Filter{Field: "name", Operator: OpNe, Value: "Ivan"},
+			sql:    "pt.name <> $1",
+			args:   []any{"Ivan"},
+		},
+		{
+			name:   "gt_int",
+			filter: domain.Filter{Field: "age", Operator: OpGt, Value: float64(20)},
+			sql:    "pt.age > $1",
+			args:   []any{int64(20)},
+		},
+		{
+			name:   "gt_bigint",
+			filter: domain.Filter{Field: "id", Operator: OpGt, Value: float64(1 << 40)},
+			sql:    "pt.id > $1",
+			args:   []any{int64(1 << 40)},
+		},
+		{
+			name:   "gte_timestamp",
+			filter: domain.Filter{Field: "created_at", Operator: OpGte, Value: "2023-10-19T00:00:00Z"},
+			sql:    "pt.created_at >= $1",
+			args:   []any{created},
+		},
+		{
+			name:   "lt_timestamp_date",
+			filter: domain.Filter{Field: "created_at", Operator: OpLt, Value: "2023-10-19"},
+			sql:    "pt.created_at < $1",
+			args:   []any{created},
+		},
+		{
+			name:   "lte_int",
+			filter: domain.Filter{Field: "age", Operator: OpLte, Value: float64(60)},
+			sql:    "pt.age <= $1",
+			args:   []any{int64(60)},
+		},
+		{
+			name:   "in_text",
+			filter: domain.Filter{Field: "name", Operator: OpIn, Value: []any{"RU", "UA", "KZ"}},
+			sql:    "pt.name in ($1, $2, $3)",
+			args:   []any{"RU", "UA", "KZ"},
+		},
+		{
+			name:   "between_int",
+			filter: domain.Filter{Field: "age", Operator: OpBetween, Value: []any{float64(20), float64(30)}},
+			sql:    "pt.age between $1 and $2",
+			args:   []any{int64(20), int64(30)},
+		},
+		{
+			name:   "gte_float",
+			filter: domain.Filter{Field: "gender_probability", Operator: OpGte, Value: 0.9},
+			sql:    "pt.gender_probability >= $1",
+			args:   []any{0.9},
+		},
+		{
+			name:   "between_float_from_code",
+			filter: domain.Filter{Field: "gender_probability", Operator: OpBetween, Value: []any{0, 0.5}},
+			sql:    "pt.gender_probability between $1 and $2",
+			args:   []any{float64(0), 0.5},
+		},
+		{
+			name:   "is_null_default",
+			filter: domain.Filter{Field: "gender", Operator: OpIsNull},
+			sql:    "pt.gender is null",
+		},
+		{
+			name:   "is_not_null",
+			filter: domain.Filter{Field: "age", Operator: OpIsNull, Value: false},
+			sql:    "pt.age is not null",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var q Query
+
+			sql, err := b.compileFilter(&q, &tt.filter, 1)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.sql, sql)
+			assert.Equal(t, tt.args, q.Args)
+		})
+	}
+}
+
+func TestCompileFilterErrors(t *testing.T) {
+	b := NewBuilder("pt", "id", testColumns)
+
+	tests := []struct {
+		name   string
+		filter domain.Filter
+		reason string
+	}{
+		{
+			name:   "unknown_operator",
+			filter: domain.Filter{Field: "age", Operator: "like", Value: float64(1)},
+			reason: `operator "like" is not supported`,
+		},
+		{
+			name:   "ilike_on_int",
+			filter: domain.Filter{Field: "age", Operator: OpIlike, Value: "3"},
+			reason: `operator "ilike" is not supported`,
+		},
+		{
+			name:   "gt_on_text",
+			filter: domain.Filter{Field: "name", Operator: OpGt, Value: "a"},
+			reason: `operator "gt" is not supported`,
+		},
+		{
+			name:   "int_as_string",
+			filter: domain.Filter{Field: "age", Operator: OpEq, Value: "30"},
+			reason: "value must be an integer",
+		},
+		{
+			name:   "int_fraction",
+			filter: domain.Filter{Field: "age", Operator: OpEq, Value: 30.5},
+			reason: "value must be an integer",
+		},
+		{
+			name:   "smallint_out_of_range",
+			filter: domain.Filter{Field: "age", Operator: OpEq, Value: float64(40000)},
+			reason: "value must be between -32768 and 32767",
+		},
+		{
+			name:   "bigint_out_of_range",
+			filter: domain.Filter{Field: "id", Operator: OpGt, Value: float64(1 << 60)},
+			reason: "value must be between -9007199254740992 and 9007199254740992",
+		},
+		{
+			name:   "float_as_string",
+			filter: domain.Filter{Field: "gender_probability", Operator: OpGt, Value: "0.9"},
+			reason: "value must be a number",
+		},
+		{
+			name:   "in_on_float",
+			filter: domain.Filter{Field: "gender_probability", Operator: OpIn, Value: []any{0.5}},
+			reason: `operator "in" is not supported`,
+		},
+		{
+			name:   "bad_timestamp",
+			filter: domain.Filter{Field: "created_at", Operator: OpGt, Value: "yesterday"},
+			reason: "value must be an RFC 3339 timestamp or a date",
+		},
+		{
+			name:   "unknown_enum_value",
+			filter: domain.Filter{Field: "gender", Operator: OpEq, Value: "unknown"},
+			reason: "value must be one of: male, female",
+		},
+		{
+			name:   "in_empty",
+			filter: domain.Filter{Field: "name", Operator: OpIn, Value: []any{}},
+			reason: "value must be an array of 1 to 100 elements",
+		},
+		{
+			name:   "in_mixed_types",
+			filter: domain.Filter{Field: "age", Operator: OpIn, Value: []any{float64(1), "2"}},
+			reason: "value must be an integer",
+		},
+		{
+			name:   "between_one_value",
+			filter: domain.Filter{Field: "age", Operator: OpBetween, Value: []any{float64(1)}},
+			reason: "value must be an array of 2 elements",
+		},
+		{
+			name:   "is_null_not_bool",
+			filter: domain.Filter{Field: "age", Operator: OpIsNull, Value: "yes"},
+			reason: "value must be a boolean",
+		},
+		{
+			name:   "ilike_not_string",
+			filter: domain.Filter{Field: "name", Value: float64(1)},
+			reason: "value must be a non-empty string",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var q Query
+
+			_, err := b.compileFilter(&q, &tt.filter, 1)
+
+			var qErr *Error
+			if assert.ErrorAs(t, err, &qErr) {
+				assert.Equal(t, tt.filter.Field, qErr.Field)
+				assert.Equal(t, tt.reason, qErr.Reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package query
+
+import (
+	"fmt"
+	"namer/internal/domain"
+	"strings"
+)
+
+const (
+	GroupAnd = "and"
+	GroupOr  = "or"
+	GroupNot = "not"
+)
+
+const (
+	maxGroupDepth = 5
+	maxConditions = 100
+)
+
+// compileGroup renders a filter tree. A "not" group negates the conjunction of its children.
+func (b *Builder) compileGroup(q *Query, g *domain.FilterGroup, depth int) (string, error) {
+	if depth > maxGroupDepth {
+		return "", &Error{Field: "where", Reason: fmt.Sprintf("groups are nested deeper than %d levels", maxGroupDepth)}
+	}
+
+	op := g.Operator
+	if op == "" {
+		op = GroupAnd
+	}
+
+	if op != GroupAnd && op != GroupOr && op != GroupNot {
+		return "", &Error{Field: "where", Reason: fmt.Sprintf("group operator %q is not supported", op)}
+	}
+
+	if len(g.Filter)+len(g.Groups) == 0 {
+		return "", &Error{Field: "where", Reason: "empty group"}
+	}
+
+	if q.conditions += len(g.Filter) + len(g.Groups); q.conditions > maxConditions {
+		return "", &Error{Field: "where", Reason: fmt.Sprintf("filter has more than %d conditions", maxConditions)}
+	}
+
+	conditions := make([]string, 0, len(g.Filter)+len(g.Groups))
+
+	for i := range g.Filter {
+		condition, err := b.compileFilter(q, &g.Filter[i], depth)
+		if err != nil {
+			return "", err
+		}
+
+		conditions = append(conditions, condition)
+	}
+
+	for i := range g.Groups {
+		condition, err := b.compileGroup(q, &g.Groups[i], depth+1)
+		if err != nil {
+			return "", err
+		}
+
+		conditions = append(conditions, condition)
+	}
+
+	switch op {
+	case GroupOr:
+		return "(" + strings.Join(conditions, " or ") + ")", nil
+	case GroupNot:
+		return "not (" + strings.Join(conditions, " and ") + ")", nil
+	default:
+		return "(" + strings.Join(conditions, " and ") + ")", nil
+	}
+}
@@ -0,0 +1,153 @@
+package query
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"namer/internal/domain"
+	"testing"
+)
+
+func TestCompileGroup(t *testing.T) {
+	b := NewBuilder("pt", "id", testColumns)
+
+	tests := []struct {
+		name  string
+		group domain.FilterGroup
+		sql   string
+		args  []any
+	}{
+		{
+			name: "default_and",
+			group: domain.FilterGroup{
+				Filter: []domain.Filter{
+					{Field: "name", Value: "iv"},
+					{Field: "age", Operator: OpGte, Value: float64(18)},
+				},
+			},
+			sql:  "(pt.name ilike $1 and pt.age >= $2)",
+			args: []any{"%iv%", int64(18)},
+		},
+		{
+			name: "or",
+			group: domain.FilterGroup{
+				Operator: GroupOr,
+				Filter: []domain.Filter{
+					{Field: "name", Value: "Iv"},
+					{Field: "gender", Operator: OpEq, Value: "male"},
+				},
+			},
+			sql:  "(pt.name ilike $1 or pt.gender = $2)",
+			args: []any{"%Iv%", "male"},
+		},
+		{
+			name: "not",
+			group: domain.FilterGroup{
+				Operator: GroupNot,
+				Filter: []domain.Filter{
+					{Field: "gender", Operator: OpIsNull},
+					{Field: "age", Operator: OpLt, Value: float64(18)},
+				},
+			},
+			sql:  "not (pt.gender is null and pt.age < $1)",
+			args: []any{int64(18)},
+		},
+		{
+			name: "nested",
+			group: domain.FilterGroup{
+				Operator: GroupAnd,
+				Filter: []domain.Filter{
+					{Field: "age", Operator: OpBetween, Value: []any{float64(20), float64(30)}},
+				},
+				Groups: []domain.FilterGroup{
+					{
+						Operator: GroupOr,
+						Filter: []domain.Filter{
+							{Field: "name", Value: "Iv"},
+						},
+						Groups: []domain.FilterGroup{
+							{
+								Operator: GroupNot,
+								Filter: []domain.Filter{
+									{Field: "gender", Operator: OpEq, Value: "female"},
+								},
+							},
+						},
+					},
+				},
+			},
+			sql:  "(pt.age between $1 and $2 and (pt.name ilike $3 or not (pt.gender = $4)))",
+			args: []any{int64(20), int64(30), "%Iv%", "female"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var q Query
+
+			sql, err := b.compileGroup(&q, &tt.group, 1)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.sql, sql)
+			assert.Equal(t, tt.args, q.Args)
+		})
+	}
+}
+
+func TestCompileGroupErrors(t *testing.T) {
+	b := NewBuilder("pt", "id", testColumns)
+
+	deep := domain.FilterGroup{Filter: []domain.Filter{{Field: "name", Value: "a"}}}
+	for i := 0; i < maxGroupDepth; i++ {
+		deep = domain.FilterGroup{Groups: []domain.FilterGroup{deep}}
+	}
+
+	wide := domain.FilterGroup{Operator: GroupOr}
+	for i := 0; i <= maxConditions; i++ {
+		wide.Filter = append(wide.Filter, domain.Filter{Field: "name", Value: "a"})
+	}
+
+	tests := []struct {
+		name  string
+		group domain.FilterGroup
+		err   string
+	}{
+		{
+			name:  "too_deep",
+			group: deep,
+			err:   "where: groups are nested deeper than 5 levels",
+		},
+		{
+			name:  "too_many_conditions",
+			group: wide,
+			err:   "where: filter has more than 100 conditions",
+		},
+		{
+			name:  "unknown_operator",
+			group: domain.FilterGroup{Operator: "xor", Filter: []domain.Filter{{Field: "name", Value: "a"}}},
+			err:   `where: group operator "xor" is not supported`,
+		},
+		{
+			name:  "empty",
+			group: domain.FilterGroup{Operator: GroupOr},
+			err:   "where: empty group",
+		},
+		{
+			name: "invalid_leaf",
+			group: domain.FilterGroup{
+				Groups: []domain.FilterGroup{
+					{Filter: []domain.Filter{{Field: "password", Value: "a"}}},
+				},
+			},
+			err: "password: unknown field",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var q Query
+
+			_, err := b.compileGroup(&q, &tt.group, 1)
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package query
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strings"
+)
+
+const (
+	ModePage   = "page"
+	ModeCursor = "cursor"
+
+	cursorNext = "next"
+	cursorPrev = "prev"
+)
+
+type keyset struct {
+	keys        []sortKey
+	fingerprint string
+	prev        bool
+	fromCursor  bool
+}
+
+// cursor is the decoded form of the opaque pagination token: the sort key values
+// of the last seen row, the direction to move in and the sort it was issued for.
+type cursor struct {
+	Direction   string `json:"d"`
+	Values      []any  `json:"v"`
+	Fingerprint string `json:"s"`
+}
+
+type Page struct {
+	HasNext bool
+	HasPrev bool
+	Next    *string
+	Prev    *string
+}
+
+func (b *Builder) fingerprint(keys []sortKey) string {
+	h := fnv.New32a()
+	h.Write([]byte(b.renderOrderBy(keys)))
+
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var c cursor
+
+	if err = json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+func encodeCursor(c *cursor) (*string, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	s := base64.RawURLEncoding.EncodeToString(b)
+
+	return &s, nil
+}
+
+// compileKeyset renders a condition matching the rows that come strictly after values in the keys order.
+func (b *Builder) compileKeyset(q *Query, keys []sortKey, values []any) (string, error) {
+	placeholders := make([]string, len(keys))
+
+	for i, k := range keys {
+		if values[i] == nil {
+			continue
+		}
+
+		v, err := convertValue(k.column, k.field, values[i])
+		if err != nil {
+			return "", &Error{Field: "pagination.cursor", Reason: "invalid cursor"}
+		}
+
+		placeholders[i] = q.bind(v)
+	}
+
+	var (
+		branches []string
+		equal    []string
+	)
+
+	for i, k := range keys {
+		expr := b.alias + "." + k.column.Name
+
+		if after := keyAfter(k, expr, placeholders[i]); after != "" {
+			branches = append(branches, strings.Join(append(slices.Clone(equal), after), " and "))
+		}
+
+		if placeholders[i] == "" {
+			equal = append(equal, expr+" is null")
+		} else {
+			equal = append(equal, fmt.Sprintf("%s = %s", expr, placeholders[i]))
+		}
+	}
+
+	if len(branches) == 0 {
+		return "false", nil
+	}
+
+	return "((" + strings.Join(branches, ") or (") + "))", nil
+}
+
+// keyAfter renders "expr comes after the placeholder value" for a single key, an empty
+// placeholder stands for null. It returns an empty string when nothing can come after.
+func keyAfter(k sortKey, expr, placeholder string) string {
+	if placeholder == "" {
+		if k.nullsFirst() {
+			return expr + " is not null"
+		}
+
+		return ""
+	}
+
+	cmp := ">"
+	if k.desc {
+		cmp = "<"
+	}
+
+	if k.nullsFirst() || k.column.NotNull {
+		return fmt.Sprintf("%s %s %s", expr, cmp, placeholder)
+	}
+
+	return fmt.Sprintf("(%s %s %s or %s is null)", expr, cmp, placeholder, expr)
+}
+
+// Paginate post-processes the rows of a built query: it drops the look-ahead row and tells
+// whether neighbouring pages exist. In cursor mode it also restores the requested order when
+// paging backwards and issues cursors for the neighbouring pages, rows are matched to sort
+// keys by their JSON field names.
+func Paginate[T any](q *Query, rows []T) ([]T, *Page, error) {
+	hasMore := len(rows) > q.limit
+	if hasMore {
+		rows = rows[:q.limit]
+	}
+
+	ks := q.keyset
+	if ks == nil {
+		return rows, &Page{
+			HasNext: hasMore,
+			HasPrev: q.page > 1,
+		}, nil
+	}
+
+	if ks.prev {
+		slices.Reverse(rows)
+	}
+
+	var (
+		page Page
+		err  error
+	)
+
+	if len(rows) == 0 {
+		return rows, &page, nil
+	}
+
+	if hasMore || ks.prev {
+		if page.Next, err = ks.cursor(rows[len(rows)-1], cursorNext); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if (ks.prev && hasMore) || (!ks.prev && ks.fromCursor) {
+		if page.Prev, err = ks.cursor(rows[0], cursorPrev); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	page.HasNext, page.HasPrev = page.Next != nil, page.Prev != nil
+
+	return rows, &page, nil
+}
+
+func (ks *keyset) cursor(row any, direction string) (*string, error) {
+	b, err := json.Marshal(row)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]any
+
+	if err = json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+
+	c := cursor{
+		Direction:   direction,
+		Values:      make([]any, len(ks.keys)),
+		Fingerprint: ks.fingerprint,
+	}
+
+	for i, k := range ks.keys {
+		c.Values[i] = fields[k.field]
+	}
+
+	return encodeCursor(&c)
+}
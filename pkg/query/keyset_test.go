@@ -0,0 +1,306 @@
+package query
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"namer/internal/domain"
+	"testing"
+)
+
+type testRow struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Age  *int   `json:"age"`
+}
+
+func TestCompileKeyset(t *testing.T) {
+	b := NewBuilder("pt", "id", testColumns)
+
+	tests := []struct {
+		name   string
+		sort   []domain.Sort
+		values []any
+		sql    string
+		args   []any
+	}{
+		{
+			name:   "default_sort",
+			values: []any{float64(10)},
+			sql:    "((pt.id < $1))",
+			args:   []any{int64(10)},
+		},
+		{
+			name:   "asc_nulls_last",
+			sort:   []domain.Sort{{Field: "age"}},
+			values: []any{float64(30), float64(10)},
+			sql:    "(((pt.age > $1 or pt.age is null)) or (pt.age = $1 and pt.id < $2))",
+			args:   []any{int64(30), int64(10)},
+		},
+		{
+			name:   "asc_nulls_last_null_value",
+			sort:   []domain.Sort{{Field: "age"}},
+			values: []any{nil, float64(10)},
+			sql:    "((pt.age is null and pt.id < $1))",
+			args:   []any{int64(10)},
+		},
+		{
+			name:   "desc_nulls_first_null_value",
+			sort:   []domain.Sort{{Field: "age", Direction: SortDesc}},
+			values: []any{nil, float64(10)},
+			sql:    "((pt.age is not null) or (pt.age is null and pt.id < $1))",
+			args:   []any{int64(10)},
+		},
+		{
+			name:   "desc_nulls_last",
+			sort:   []domain.Sort{{Field: "gender", Direction: SortDesc, Nulls: NullsLast}, {Field: "id", Direction: SortAsc}},
+			values: []any{"male", float64(10)},
+			sql:    "(((pt.gender < $1 or pt.gender is null)) or (pt.gender = $1 and pt.id > $2))",
+			args:   []any{"male", int64(10)},
+		},
+		{
+			name:   "not_null_column",
+			sort:   []domain.Sort{{Field: "name", Direction: SortDesc, Nulls: NullsLast}},
+			values: []any{"Ivan", float64(10)},
+			sql:    "((pt.name < $1) or (pt.name = $1 and pt.id < $2))",
+			args:   []any{"Ivan", int64(10)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := b.compileSort(tt.sort)
+			require.NoError(t, err)
+
+			var q Query
+
+			sql, err := b.compileKeyset(&q, keys, tt.values)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.sql, sql)
+			assert.Equal(t, tt.args, q.Args)
+		})
+	}
+}
+
+func TestSortKeyReverse(t *testing.T) {
+	b := NewBuilder("pt", "id", testColumns)
+
+	keys, err := b.compileSort([]domain.Sort{
+		{Field: "name"},
+		{Field: "age", Direction: SortDesc, Nulls: NullsLast},
+		{Field: "created_at", Nulls: NullsFirst},
+	})
+	require.NoError(t, err)
+
+	for i := range keys {
+		keys[i] = keys[i].reverse()
+	}
+
+	assert.Equal(
+		t,
+		"order by pt.name desc, pt.age asc nulls first, pt.created_at desc nulls last, pt.id asc",
+		b.renderOrderBy(keys),
+	)
+}
+
+func TestBuildCursor(t *testing.T) {
+	b := NewBuilder("pt", "id", testColumns)
+
+	sort := []domain.Sort{{Field: "age"}}
+
+	t.Run("success_first_page", func(t *testing.T) {
+		q, err := b.Build(&domain.FilterWithPagination{
+			Sort:       sort,
+			Pagination: &domain.Pagination{Limit: 2, Mode: ModeCursor},
+		})
+		require.NoError(t, err)
+
+		assert.Empty(t, q.Where)
+		assert.Equal(t, "order by pt.age asc, pt.id desc", q.OrderBy)
+		assert.Equal(t, "limit $1", q.Pagination)
+		assert.Equal(t, []any{3}, q.Args)
+	})
+
+	t.Run("success_prev", func(t *testing.T) {
+		keys, err := b.compileSort(sort)
+		require.NoError(t, err)
+
+		c, err := encodeCursor(&cursor{
+			Direction:   cursorPrev,
+			Values:      []any{float64(30), float64(10)},
+			Fingerprint: b.fingerprint(keys),
+		})
+		require.NoError(t, err)
+
+		q, err := b.Build(&domain.FilterWithPagination{
+			Filter:     []domain.Filter{{Field: "name", Value: "iv"}},
+			Sort:       sort,
+			Pagination: &domain.Pagination{Limit: 2, Cursor: *c},
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, "where pt.name ilike $1", q.Where)
+		assert.Equal(t, "and ((pt.age < $2) or (pt.age = $2 and pt.id > $3))", q.Seek)
+		assert.Equal(t, []any{"%iv%"}, q.CountArgs())
+		assert.Equal(t, "order by pt.age desc, pt.id asc", q.OrderBy)
+		assert.Equal(t, "limit $4", q.Pagination)
+		assert.Equal(t, []any{"%iv%", int64(30), int64(10), 3}, q.Args)
+	})
+
+	t.Run("error_invalid_cursor", func(t *testing.T) {
+		_, err := b.Build(&domain.FilterWithPagination{
+			Pagination: &domain.Pagination{Limit: 2, Cursor: "garbage"},
+		})
+		assert.EqualError(t, err, "pagination.cursor: invalid cursor")
+	})
+
+	t.Run("error_cursor_for_other_sort", func(t *testing.T) {
+		keys, err := b.compileSort(sort)
+		require.NoError(t, err)
+
+		c, err := encodeCursor(&cursor{
+			Direction:   cursorNext,
+			Values:      []any{"Ivan", float64(10)},
+			Fingerprint: b.fingerprint(keys),
+		})
+		require.NoError(t, err)
+
+		_, err = b.Build(&domain.FilterWithPagination{
+			Sort:       []domain.Sort{{Field: "name"}},
+			Pagination: &domain.Pagination{Limit: 2, Cursor: *c},
+		})
+		assert.EqualError(t, err, "pagination.cursor: cursor was issued for a different sort")
+	})
+
+	t.Run("error_cursor_value_type", func(t *testing.T) {
+		keys, err := b.compileSort(sort)
+		require.NoError(t, err)
+
+		c, err := encodeCursor(&cursor{
+			Direction:   cursorNext,
+			Values:      []any{"thirty", float64(10)},
+			Fingerprint: b.fingerprint(keys),
+		})
+		require.NoError(t, err)
+
+		_, err = b.Build(&domain.FilterWithPagination{
+			Sort:       sort,
+			Pagination: &domain.Pagination{Limit: 2, Cursor: *c},
+		})
+		assert.EqualError(t, err, "pagination.cursor: invalid cursor")
+	})
+
+	t.Run("error_mode", func(t *testing.T) {
+		_, err := b.Build(&domain.FilterWithPagination{
+			Pagination: &domain.Pagination{Limit: 2, Mode: "scroll"},
+		})
+		assert.EqualError(t, err, `pagination.mode: mode "scroll" is not supported`)
+	})
+}
+
+func TestPaginate(t *testing.T) {
+	b := NewBuilder("pt", "id", testColumns)
+
+	age := 30
+
+	rows := []testRow{
+		{ID: 3, Name: "c", Age: &age},
+		{ID: 2, Name: "b", Age: &age},
+		{ID: 1, Name: "a"},
+	}
+
+	build := func(t *testing.T, cursor string) *Query {
+		q, err := b.Build(&domain.FilterWithPagination{
+			Sort:       []domain.Sort{{Field: "age"}},
+			Pagination: &domain.Pagination{Limit: 2, Mode: ModeCursor, Cursor: cursor},
+		})
+		require.NoError(t, err)
+
+		return q
+	}
+
+	t.Run("page_mode", func(t *testing.T) {
+		q, err := b.Build(&domain.FilterWithPagination{
+			Pagination: &domain.Pagination{Limit: 2, Page: 2},
+		})
+		require.NoError(t, err)
+
+		data, page, err := Paginate(q, rows)
+		require.NoError(t, err)
+
+		assert.Equal(t, rows[:2], data)
+		assert.Equal(t, &Page{HasNext: true, HasPrev: true}, page)
+
+		data, page, err = Paginate(q, rows[:1])
+		require.NoError(t, err)
+
+		assert.Equal(t, rows[:1], data)
+		assert.Equal(t, &Page{HasPrev: true}, page)
+	})
+
+	t.Run("first_page", func(t *testing.T) {
+		data, page, err := Paginate(build(t, ""), rows)
+		require.NoError(t, err)
+
+		assert.Equal(t, rows[:2], data)
+		assert.Nil(t, page.Prev)
+		assert.True(t, page.HasNext)
+		assert.False(t, page.HasPrev)
+
+		if assert.NotNil(t, page.Next) {
+			c, err := decodeCursor(*page.Next)
+			require.NoError(t, err)
+
+			assert.Equal(t, cursorNext, c.Direction)
+			assert.Equal(t, []any{float64(30), float64(2)}, c.Values)
+
+			q := build(t, *page.Next)
+			assert.Empty(t, q.Where)
+			assert.Equal(t, "where (((pt.age > $1 or pt.age is null)) or (pt.age = $1 and pt.id < $2))", q.Seek)
+		}
+	})
+
+	t.Run("last_page", func(t *testing.T) {
+		next, err := encodeCursor(&cursor{
+			Direction:   cursorNext,
+			Values:      []any{float64(30), float64(2)},
+			Fingerprint: build(t, "").keyset.fingerprint,
+		})
+		require.NoError(t, err)
+
+		data, page, err := Paginate(build(t, *next), rows[2:])
+		require.NoError(t, err)
+
+		assert.Equal(t, rows[2:], data)
+		assert.Nil(t, page.Next)
+
+		if assert.NotNil(t, page.Prev) {
+			c, err := decodeCursor(*page.Prev)
+			require.NoError(t, err)
+
+			assert.Equal(t, cursorPrev, c.Direction)
+			assert.Equal(t, []any{nil, float64(1)}, c.Values)
+		}
+	})
+
+	t.Run("prev_page", func(t *testing.T) {
+		prev, err := encodeCursor(&cursor{
+			Direction:   cursorPrev,
+			Values:      []any{nil, float64(1)},
+			Fingerprint: build(t, "").keyset.fingerprint,
+		})
+		require.NoError(t, err)
+
+		q := build(t, *prev)
+		assert.Equal(t, "where ((pt.age is not null) or (pt.age is null and pt.id > $1))", q.Seek)
+
+		reversed := []testRow{rows[1], rows[0]}
+
+		data, page, err := Paginate(q, reversed)
+		require.NoError(t, err)
+
+		assert.Equal(t, rows[:2], data)
+		assert.Nil(t, page.Prev)
+		assert.NotNil(t, page.Next)
+	})
+}
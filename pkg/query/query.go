@@ -0,0 +1,230 @@
+package query
+
+import (
+	"fmt"
+	"namer/internal/domain"
+	"strings"
+)
+
+const (
+	defaultLimit = 5
+	defaultPage  = 1
+)
+
+const (
+	CountExact    = "exact"
+	CountEstimate = "estimate"
+	CountNone     = "none"
+)
+
+type ColumnType int
+
+const (
+	TypeText ColumnType = iota
+	TypeEnum
+	TypeInt
+	TypeTimestamp
+	TypeFloat
+	TypeRelation
+)
+
+type Column struct {
+	Name    string
+	Type    ColumnType
+	NotNull bool
+	// Bits is the size of a TypeInt column, 16 for smallint and 64 for bigint, 32 otherwise.
+	Bits int
+	// Values lists the accepted values of a TypeEnum column.
+	Values []string
+	// Relation is the child table of a TypeRelation column.
+	Relation *Relation
+}
+
+// Builder compiles a domain.FilterWithPagination into parameterized SQL.
+// Only fields present in the columns whitelist can be filtered and sorted on,
+// whitelist keys match the JSON names of the listed rows. The key column must be
+// whitelisted and unique, it breaks ties between equal sort values.
+type Builder struct {
+	alias   string
+	key     string
+	columns map[string]Column
+}
+
+// Query holds SQL fragments with $n placeholders and the arguments bound to them.
+// Where holds the filter alone and can be reused with CountArgs to count matching
+// rows, Seek narrows it down to the rows after the cursor.
+type Query struct {
+	Where      string
+	Seek       string
+	OrderBy    string
+	Pagination string
+	Count      string
+	Args       []any
+
+	conditions int
+	filterArgs int
+	limit      int
+	page       int
+	keyset     *keyset
+}
+
+// Error describes why a request could not be compiled. It is safe to return to the client.
+type Error struct {
+	Field  string `json:"field,omitempty"`
+	Reason string `json:"reason"`
+}
+
+func (e *Error) Error() string {
+	if e.Field == "" {
+		return e.Reason
+	}
+
+	return fmt.Sprintf("%s: %s", e.Field, e.Reason)
+}
+
+func NewBuilder(alias, key string, columns map[string]Column) *Builder {
+	return &Builder{
+		alias:   alias,
+		key:     key,
+		columns: columns,
+	}
+}
+
+func (b *Builder) Build(req *domain.FilterWithPagination) (*Query, error) {
+	var (
+		q          Query
+		conditions []string
+	)
+
+	// the top-level filters count toward the conditions of the where group
+	if q.conditions = len(req.Filter); q.conditions > maxConditions {
+		return nil, &Error{Field: "filter", Reason: fmt.Sprintf("filter has more than %d conditions", maxConditions)}
+	}
+
+	for i := range req.Filter {
+		condition, err := b.compileFilter(&q, &req.Filter[i], 1)
+		if err != nil {
+			return nil, err
+		}
+
+		conditions = append(conditions, condition)
+	}
+
+	if req.Where != nil {
+		condition, err := b.compileGroup(&q, req.Where, 1)
+		if err != nil {
+			return nil, err
+		}
+
+		conditions = append(conditions, condition)
+	}
+
+	if len(conditions) != 0 {
+		q.Where = "where " + strings.Join(conditions, " and ")
+	}
+
+	q.filterArgs = len(q.Args)
+
+	keys, err := b.compileSort(req.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Pagination == nil {
+		req.Pagination = &domain.Pagination{
+			Limit: defaultLimit,
+			Page:  defaultPage,
+		}
+	}
+
+	if req.Pagination.Limit < 1 {
+		return nil, &Error{Field: "pagination.limit", Reason: "invalid limit"}
+	}
+
+	if req.Pagination.Count == "" {
+		req.Pagination.Count = CountExact
+	}
+
+	if req.Pagination.Count != CountExact && req.Pagination.Count != CountEstimate && req.Pagination.Count != CountNone {
+		return nil, &Error{Field: "pagination.count", Reason: fmt.Sprintf("count %q is not supported", req.Pagination.Count)}
+	}
+
+	q.limit, q.Count = req.Pagination.Limit, req.Pagination.Count
+
+	switch {
+	case req.Pagination.Mode == ModeCursor || req.Pagination.Cursor != "":
+		ks := &keyset{
+			keys:        keys,
+			fingerprint: b.fingerprint(keys),
+		}
+
+		if req.Pagination.Cursor != "" {
+			c, err := decodeCursor(req.Pagination.Cursor)
+			if err != nil || (c.Direction != cursorNext && c.Direction != cursorPrev) || len(c.Values) != len(keys) {
+				return nil, &Error{Field: "pagination.cursor", Reason: "invalid cursor"}
+			}
+
+			if c.Fingerprint != ks.fingerprint {
+				return nil, &Error{Field: "pagination.cursor", Reason: "cursor was issued for a different sort"}
+			}
+
+			ks.prev, ks.fromCursor = c.Direction == cursorPrev, true
+
+			if ks.prev {
+				reversed := make([]sortKey, len(keys))
+
+				for i := range keys {
+					reversed[i] = keys[i].reverse()
+				}
+
+				keys = reversed
+			}
+
+			condition, err := b.compileKeyset(&q, keys, c.Values)
+			if err != nil {
+				return nil, err
+			}
+
+			if q.Where == "" {
+				q.Seek = "where " + condition
+			} else {
+				q.Seek = "and " + condition
+			}
+		}
+
+		req.Pagination.Mode, q.keyset = ModeCursor, ks
+		q.Pagination = fmt.Sprintf("limit %s", q.bind(q.limit+1))
+	case req.Pagination.Mode == "" || req.Pagination.Mode == ModePage:
+		if req.Pagination.Page < 1 {
+			return nil, &Error{Field: "pagination.page", Reason: "invalid page"}
+		}
+
+		req.Pagination.Mode, q.page = ModePage, req.Pagination.Page
+		q.Pagination = fmt.Sprintf("limit %s", q.bind(q.limit+1))
+
+		if q.page > 1 {
+			q.Pagination = fmt.Sprintf(
+				"%s offset %s",
+				q.Pagination,
+				q.bind((q.page-1)*q.limit),
+			)
+		}
+	default:
+		return nil, &Error{Field: "pagination.mode", Reason: fmt.Sprintf("mode %q is not supported", req.Pagination.Mode)}
+	}
+
+	q.OrderBy = b.renderOrderBy(keys)
+
+	return &q, nil
+}
+
+// CountArgs returns the arguments bound by Where.
+func (q *Query) CountArgs() []any {
+	return q.Args[:q.filterArgs]
+}
+
+func (q *Query) bind(arg any) string {
+	q.Args = append(q.Args, arg)
+
+	return fmt.Sprintf("$%d", len(q.Args))
+}
@@ -0,0 +1,187 @@
+package query
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"namer/internal/domain"
+	"testing"
+)
+
+var testColumns = map[string]Column{
+	"id":                 {Name: "id", Type: TypeInt, NotNull: true, Bits: 64},
+	"name":               {Name: "name", Type: TypeText, NotNull: true},
+	"age":                {Name: "age", Type: TypeInt, Bits: 16},
+	"gender":             {Name: "gender", Type: TypeEnum, Values: []string{"male", "female"}},
+	"gender_probability": {Name: "gender_probability", Type: TypeFloat},
+	"created_at":         {Name: "created_at", Type: TypeTimestamp},
+	"nationalities": {
+		Type: TypeRelation,
+		Relation: &Relation{
+			Table:      "persons.person_nationalities",
+			Alias:      "pn",
+			ForeignKey: "person_id",
+			Columns: map[string]Column{
+				"country_id":  {Name: "country_id", Type: TypeText, NotNull: true},
+				"probability": {Name: "probability", Type: TypeFloat, NotNull: true},
+			},
+		},
+	},
+}
+
+func TestBuild(t *testing.T) {
+	b := NewBuilder("pt", "id", testColumns)
+
+	t.Run("success", func(t *testing.T) {
+		q, err := b.Build(&domain.FilterWithPagination{
+			Filter: []domain.Filter{
+				{Field: "name", Value: "en"},
+				{Field: "gender", Value: "fe"},
+			},
+			Pagination: &domain.Pagination{
+				Limit: 10,
+				Page:  3,
+			},
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, "where pt.name ilike $1 and pt.gender::text ilike $2", q.Where)
+		assert.Equal(t, "order by pt.id desc", q.OrderBy)
+		assert.Equal(t, "limit $3 offset $4", q.Pagination)
+		assert.Equal(t, []any{"%en%", "%fe%", 11, 20}, q.Args)
+		assert.Equal(t, []any{"%en%", "%fe%"}, q.CountArgs())
+		assert.Equal(t, CountExact, q.Count)
+	})
+
+	t.Run("success_filter_and_where", func(t *testing.T) {
+		q, err := b.Build(&domain.FilterWithPagination{
+			Filter: []domain.Filter{
+				{Field: "gender", Operator: OpEq, Value: "male"},
+			},
+			Where: &domain.FilterGroup{
+				Operator: GroupOr,
+				Filter: []domain.Filter{
+					{Field: "name", Value: "Iv"},
+					{Field: "name", Operator: OpIsNull},
+				},
+			},
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, "where pt.gender = $1 and (pt.name ilike $2 or pt.name is null)", q.Where)
+		assert.Equal(t, "limit $3", q.Pagination)
+		assert.Equal(t, []any{"male", "%Iv%", defaultLimit + 1}, q.Args)
+	})
+
+	t.Run("success_default_pagination", func(t *testing.T) {
+		req := domain.FilterWithPagination{}
+
+		q, err := b.Build(&req)
+		require.NoError(t, err)
+
+		assert.Empty(t, q.Where)
+		assert.Equal(t, "limit $1", q.Pagination)
+		assert.Equal(t, []any{defaultLimit + 1}, q.Args)
+		assert.Equal(t, &domain.Pagination{Limit: defaultLimit, Page: defaultPage, Mode: ModePage, Count: CountExact}, req.Pagination)
+	})
+
+	t.Run("success_value_is_not_sql", func(t *testing.T) {
+		q, err := b.Build(&domain.FilterWithPagination{
+			Filter: []domain.Filter{
+				{Field: "name", Value: "' or 1=1 --"},
+			},
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, "where pt.name ilike $1", q.Where)
+		assert.Equal(t, "%' or 1=1 --%", q.Args[0])
+	})
+
+	t.Run("success_like_wildcards_escaped", func(t *testing.T) {
+		q, err := b.Build(&domain.FilterWithPagination{
+			Filter: []domain.Filter{
+				{Field: "name", Value: `50%_\`},
+			},
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, `%50\%\_\\%`, q.Args[0])
+	})
+
+	t.Run("error_unknown_field", func(t *testing.T) {
+		q, err := b.Build(&domain.FilterWithPagination{
+			Filter: []domain.Filter{
+				{Field: "name; drop table persons.persons_table", Value: "x"},
+			},
+		})
+		assert.Nil(t, q)
+
+		var qErr *Error
+		if assert.ErrorAs(t, err, &qErr) {
+			assert.Equal(t, "name; drop table persons.persons_table", qErr.Field)
+			assert.Equal(t, "unknown field", qErr.Reason)
+		}
+	})
+
+	t.Run("error_empty_field", func(t *testing.T) {
+		_, err := b.Build(&domain.FilterWithPagination{
+			Filter: []domain.Filter{{Value: "x"}},
+		})
+		assert.EqualError(t, err, "empty field")
+	})
+
+	t.Run("error_empty_value", func(t *testing.T) {
+		_, err := b.Build(&domain.FilterWithPagination{
+			Filter: []domain.Filter{{Field: "name"}},
+		})
+		assert.EqualError(t, err, "name: value must be a non-empty string")
+	})
+
+	t.Run("error_invalid_pagination", func(t *testing.T) {
+		_, err := b.Build(&domain.FilterWithPagination{
+			Pagination: &domain.Pagination{Limit: 0, Page: 1},
+		})
+		assert.EqualError(t, err, "pagination.limit: invalid limit")
+
+		_, err = b.Build(&domain.FilterWithPagination{
+			Pagination: &domain.Pagination{Limit: 1, Page: 0},
+		})
+		assert.EqualError(t, err, "pagination.page: invalid page")
+
+		_, err = b.Build(&domain.FilterWithPagination{
+			Pagination: &domain.Pagination{Limit: 1, Page: 1, Count: "approximate"},
+		})
+		assert.EqualError(t, err, `pagination.count: count "approximate" is not supported`)
+	})
+
+	t.Run("error_too_many_top_level_filters", func(t *testing.T) {
+		var filters []domain.Filter
+
+		for i := 0; i <= maxConditions; i++ {
+			filters = append(filters, domain.Filter{Field: "name", Value: "a"})
+		}
+
+		_, err := b.Build(&domain.FilterWithPagination{Filter: filters})
+		assert.EqualError(t, err, "filter: filter has more than 100 conditions")
+
+		// the top-level filters and the where group share the limit
+		where := &domain.FilterGroup{Filter: filters[:maxConditions/2+1]}
+
+		_, err = b.Build(&domain.FilterWithPagination{Filter: filters[:maxConditions/2], Where: where})
+		assert.EqualError(t, err, "where: filter has more than 100 conditions")
+	})
+
+	t.Run("error_relation_too_deep", func(t *testing.T) {
+		// the relation group sits one level below the group of its filter
+		where := domain.FilterGroup{Filter: []domain.Filter{{
+			Field: "nationalities",
+			Value: domain.FilterGroup{Filter: []domain.Filter{{Field: "country_id", Operator: OpEq, Value: "US"}}},
+		}}}
+
+		for i := 1; i < maxGroupDepth; i++ {
+			where = domain.FilterGroup{Groups: []domain.FilterGroup{where}}
+		}
+
+		_, err := b.Build(&domain.FilterWithPagination{Where: &where})
+		assert.EqualError(t, err, "nationalities.where: groups are nested deeper than 5 levels")
+	})
+}
@@ -0,0 +1,58 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"namer/internal/domain"
+)
+
+// OpAny matches the rows that have at least one related row matching a filter group.
+const OpAny = "any"
+
+// Relation describes a child table, a TypeRelation column matches its rows with an exists
+// subquery. Columns whitelists the child columns the same way the builder columns do.
+type Relation struct {
+	Table      string
+	Alias      string
+	ForeignKey string
+	Columns    map[string]Column
+}
+
+// compileAny renders "any related row matches the group". The value is a filter group over
+// the relation columns, decoded from JSON or built in code. It is nested one level below the
+// group of the filter, so the relation counts toward the depth limit.
+func (b *Builder) compileAny(q *Query, f *domain.Filter, column Column, depth int) (string, error) {
+	var group domain.FilterGroup
+
+	raw, err := json.Marshal(f.Value)
+	if err == nil {
+		err = json.Unmarshal(raw, &group)
+	}
+
+	if err != nil || f.Value == nil {
+		return "", &Error{Field: f.Field, Reason: "value must be a filter group"}
+	}
+
+	rel := column.Relation
+	sub := &Builder{alias: rel.Alias, columns: rel.Columns}
+
+	condition, err := sub.compileGroup(q, &group, depth+1)
+	if err != nil {
+		if qErr, ok := err.(*Error); ok {
+			return "", &Error{Field: f.Field + "." + qErr.Field, Reason: qErr.Reason}
+		}
+
+		return "", err
+	}
+
+	return fmt.Sprintf(
+		"exists (select 1 from %s as %s where %s.%s = %s.%s and %s)",
+		rel.Table,
+		rel.Alias,
+		rel.Alias,
+		rel.ForeignKey,
+		b.alias,
+		b.columns[b.key].Name,
+		condition,
+	), nil
+}
@@ -0,0 +1,95 @@
+package query
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"namer/internal/domain"
+	"testing"
+)
+
+func TestCompileAny(t *testing.T) {
+	b := NewBuilder("pt", "id", testColumns)
+
+	t.Run("success", func(t *testing.T) {
+		var req domain.FilterWithPagination
+
+		require.NoError(t, json.Unmarshal([]byte(`{
+			"filter": [
+				{"field": "age", "operator": "gte", "value": 18},
+				{"field": "nationalities", "value": {"filter": [
+					{"field": "country_id", "operator": "eq", "value": "US"},
+					{"field": "probability", "operator": "gte", "value": 0.5}
+				]}}
+			]
+		}`), &req))
+
+		q, err := b.Build(&req)
+		require.NoError(t, err)
+
+		assert.Equal(
+			t,
+			"where pt.age >= $1 and exists (select 1 from persons.person_nationalities as pn where pn.person_id = pt.id and (pn.country_id = $2 and pn.probability >= $3))",
+			q.Where,
+		)
+		assert.Equal(t, []any{int64(18), "US", 0.5}, q.CountArgs())
+	})
+
+	t.Run("success_from_code", func(t *testing.T) {
+		var q Query
+
+		sql, err := b.compileFilter(&q, &domain.Filter{
+			Field:    "nationalities",
+			Operator: OpAny,
+			Value: domain.FilterGroup{
+				Operator: GroupOr,
+				Filter: []domain.Filter{
+					{Field: "country_id", Operator: OpEq, Value: "US"},
+					{Field: "country_id", Operator: OpEq, Value: "CA"},
+				},
+			},
+		}, 1)
+		require.NoError(t, err)
+
+		assert.Equal(t, "exists (select 1 from persons.person_nationalities as pn where pn.person_id = pt.id and (pn.country_id = $1 or pn.country_id = $2))", sql)
+		assert.Equal(t, []any{"US", "CA"}, q.Args)
+	})
+
+	t.Run("error_value", func(t *testing.T) {
+		var q Query
+
+		_, err := b.compileFilter(&q, &domain.Filter{Field: "nationalities", Value: "US"}, 1)
+
+		var qErr *Error
+		if assert.ErrorAs(t, err, &qErr) {
+			assert.Equal(t, "nationalities", qErr.Field)
+			assert.Equal(t, "value must be a filter group", qErr.Reason)
+		}
+	})
+
+	t.Run("error_unknown_field", func(t *testing.T) {
+		var q Query
+
+		_, err := b.compileFilter(&q, &domain.Filter{
+			Field: "nationalities",
+			Value: map[string]any{"filter": []any{map[string]any{"field": "age", "value": float64(1)}}},
+		}, 1)
+
+		var qErr *Error
+		if assert.ErrorAs(t, err, &qErr) {
+			assert.Equal(t, "nationalities.age", qErr.Field)
+			assert.Equal(t, "unknown field", qErr.Reason)
+		}
+	})
+
+	t.Run("error_sort", func(t *testing.T) {
+		_, err := b.Build(&domain.FilterWithPagination{
+			Sort: []domain.Sort{{Field: "nationalities"}},
+		})
+
+		var qErr *Error
+		if assert.ErrorAs(t, err, &qErr) {
+			assert.Equal(t, "unknown sort field", qErr.Reason)
+		}
+	})
+}
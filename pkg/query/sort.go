@@ -0,0 +1,126 @@
+package query
+
+import (
+	"fmt"
+	"namer/internal/domain"
+	"strings"
+)
+
+const (
+	SortAsc  = "asc"
+	SortDesc = "desc"
+
+	NullsFirst = "first"
+	NullsLast  = "last"
+)
+
+const maxSortKeys = 5
+
+type sortKey struct {
+	field  string
+	column Column
+	desc   bool
+	nulls  string
+}
+
+// nullsFirst reports the effective placement, postgres puts nulls first only in descending order by default.
+func (k sortKey) nullsFirst() bool {
+	if k.nulls == "" {
+		return k.desc
+	}
+
+	return k.nulls == NullsFirst
+}
+
+func (k sortKey) reverse() sortKey {
+	nullsFirst := !k.nullsFirst()
+
+	k.desc = !k.desc
+
+	switch {
+	case nullsFirst == k.desc:
+		k.nulls = ""
+	case nullsFirst:
+		k.nulls = NullsFirst
+	default:
+		k.nulls = NullsLast
+	}
+
+	return k
+}
+
+func (b *Builder) compileSort(sort []domain.Sort) ([]sortKey, error) {
+	if len(sort) > maxSortKeys {
+		return nil, &Error{Field: "sort", Reason: fmt.Sprintf("more than %d sort keys", maxSortKeys)}
+	}
+
+	var (
+		keys   = make([]sortKey, 0, len(sort)+1)
+		seen   = make(map[string]bool, len(sort))
+		hasKey bool
+	)
+
+	for _, s := range sort {
+		column, ok := b.columns[s.Field]
+		if !ok || column.Type == TypeRelation {
+			return nil, &Error{Field: s.Field, Reason: "unknown sort field"}
+		}
+
+		if seen[s.Field] {
+			return nil, &Error{Field: s.Field, Reason: "duplicate sort field"}
+		}
+
+		seen[s.Field] = true
+
+		direction := s.Direction
+		if direction == "" {
+			direction = SortAsc
+		}
+
+		if direction != SortAsc && direction != SortDesc {
+			return nil, &Error{Field: s.Field, Reason: fmt.Sprintf("sort direction %q is not supported", direction)}
+		}
+
+		if s.Nulls != "" && s.Nulls != NullsFirst && s.Nulls != NullsLast {
+			return nil, &Error{Field: s.Field, Reason: fmt.Sprintf("nulls placement %q is not supported", s.Nulls)}
+		}
+
+		keys = append(keys, sortKey{
+			field:  s.Field,
+			column: column,
+			desc:   direction == SortDesc,
+			nulls:  s.Nulls,
+		})
+
+		hasKey = hasKey || column.Name == b.key
+	}
+
+	if !hasKey {
+		keys = append(keys, sortKey{
+			field:  b.key,
+			column: b.columns[b.key],
+			desc:   true,
+		})
+	}
+
+	return keys, nil
+}
+
+func (b *Builder) renderOrderBy(keys []sortKey) string {
+	rendered := make([]string, len(keys))
+
+	for i, k := range keys {
+		direction := SortAsc
+		if k.desc {
+			direction = SortDesc
+		}
+
+		rendered[i] = fmt.Sprintf("%s.%s %s", b.alias, k.column.Name, direction)
+
+		if k.nulls != "" {
+			rendered[i] += " nulls " + k.nulls
+		}
+	}
+
+	return "order by " + strings.Join(rendered, ", ")
+}
@@ -0,0 +1,93 @@
+package query
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"namer/internal/domain"
+	"testing"
+)
+
+func TestCompileSort(t *testing.T) {
+	b := NewBuilder("pt", "id", testColumns)
+
+	tests := []struct {
+		name string
+		sort []domain.Sort
+		sql  string
+	}{
+		{
+			name: "default",
+			sql:  "order by pt.id desc",
+		},
+		{
+			name: "default_direction",
+			sort: []domain.Sort{{Field: "name"}},
+			sql:  "order by pt.name asc, pt.id desc",
+		},
+		{
+			name: "multiple_keys",
+			sort: []domain.Sort{
+				{Field: "age", Direction: SortDesc, Nulls: NullsLast},
+				{Field: "created_at", Direction: SortAsc, Nulls: NullsFirst},
+			},
+			sql: "order by pt.age desc nulls last, pt.created_at asc nulls first, pt.id desc",
+		},
+		{
+			name: "explicit_key",
+			sort: []domain.Sort{{Field: "name"}, {Field: "id", Direction: SortAsc}},
+			sql:  "order by pt.name asc, pt.id asc",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := b.compileSort(tt.sort)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.sql, b.renderOrderBy(keys))
+		})
+	}
+}
+
+func TestCompileSortErrors(t *testing.T) {
+	b := NewBuilder("pt", "id", testColumns)
+
+	tests := []struct {
+		name string
+		sort []domain.Sort
+		err  string
+	}{
+		{
+			name: "unknown_field",
+			sort: []domain.Sort{{Field: "pt.name; select 1"}},
+			err:  "pt.name; select 1: unknown sort field",
+		},
+		{
+			name: "duplicate_field",
+			sort: []domain.Sort{{Field: "name"}, {Field: "name", Direction: SortDesc}},
+			err:  "name: duplicate sort field",
+		},
+		{
+			name: "unknown_direction",
+			sort: []domain.Sort{{Field: "name", Direction: "up"}},
+			err:  `name: sort direction "up" is not supported`,
+		},
+		{
+			name: "unknown_nulls",
+			sort: []domain.Sort{{Field: "name", Nulls: "middle"}},
+			err:  `name: nulls placement "middle" is not supported`,
+		},
+		{
+			name: "too_many_keys",
+			sort: []domain.Sort{{Field: "id"}, {Field: "name"}, {Field: "age"}, {Field: "gender"}, {Field: "created_at"}, {Field: "id"}},
+			err:  "sort: more than 5 sort keys",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := b.compileSort(tt.sort)
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}